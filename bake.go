@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type DirectionalLight struct {
+	dir   [3]float32
+	color [3]float32
+}
+
+// Collects each occurrence of a repeatable command line flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ";")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// Parse a light definition of the form "dir=x,y,z color=r,g,b", the direction points
+// from the surface towards the light and the colour defaults to white.
+func ParseDirectionalLight(s string) (DirectionalLight, error) {
+	var light DirectionalLight = DirectionalLight{color: [3]float32{1, 1, 1}}
+	values, err := ParseKeyVectors(s)
+	if err != nil {
+		return light, err
+	}
+	for key, vec := range values {
+		switch key {
+		case "dir":
+			light.dir = vec
+		case "color":
+			light.color = vec
+		default:
+			return light, fmt.Errorf("unknown light property %q", key)
+		}
+	}
+	if _, ok := values["dir"]; !ok {
+		return light, errors.New("light has no dir")
+	}
+	var length float32 = float32(math.Sqrt(float64(light.dir[0]*light.dir[0] + light.dir[1]*light.dir[1] + light.dir[2]*light.dir[2])))
+	if length == 0 {
+		return light, errors.New("light dir has zero length")
+	}
+	light.dir[0] /= length
+	light.dir[1] /= length
+	light.dir[2] /= length
+	return light, nil
+}
+
+// Bake Lambertian shading from the lights into the vertex colours. Each vertex uses the average of
+// the normals and material diffuse colours of the face corners which reference it.
+func (m *Mesh) BakeLighting(lights []DirectionalLight) error {
+	if len(m.normals) == 0 {
+		Logf(LOG_ERROR, "Error: Baking lighting requires normals.\n")
+		return errors.New("no normals to bake lighting with")
+	}
+
+	vertexNormals := make([]Normal, len(m.vertices))
+	vertexDiffuse := make([][3]float32, len(m.vertices))
+	vertexUse := make([]float32, len(m.vertices))
+	for i := range m.faces {
+		var diffuse [3]float32 = [3]float32{1, 1, 1}
+		if len(m.materials) > 0 {
+			diffuse = m.materials[m.faces[i].materialID].diffuse
+		}
+		for j := 0; j < int(m.faces[i].edges); j++ {
+			vidx := m.faces[i].v[j]
+			n := m.normals[m.faces[i].n[j]]
+			vertexNormals[vidx].X += n.X
+			vertexNormals[vidx].Y += n.Y
+			vertexNormals[vidx].Z += n.Z
+			vertexDiffuse[vidx][0] += diffuse[0]
+			vertexDiffuse[vidx][1] += diffuse[1]
+			vertexDiffuse[vidx][2] += diffuse[2]
+			vertexUse[vidx]++
+		}
+	}
+
+	for i := range m.vertices {
+		var r, g, b float32 = 0, 0, 0
+		if vertexUse[i] > 0 {
+			n := vertexNormals[i]
+			if n.X != 0 || n.Y != 0 || n.Z != 0 {
+				n.normalize()
+			}
+			for _, light := range lights {
+				var intensity float32 = n.X*light.dir[0] + n.Y*light.dir[1] + n.Z*light.dir[2]
+				if intensity <= 0 {
+					continue
+				}
+				r += intensity * light.color[0] * vertexDiffuse[i][0] / vertexUse[i]
+				g += intensity * light.color[1] * vertexDiffuse[i][1] / vertexUse[i]
+				b += intensity * light.color[2] * vertexDiffuse[i][2] / vertexUse[i]
+			}
+		}
+		m.vertices[i].A = 1.0
+		m.vertices[i].R = r
+		m.vertices[i].G = g
+		m.vertices[i].B = b
+	}
+	m.vertexType |= VERTEX_COLOR
+
+	Logf(LOG_INFO, "Baked lighting from %d lights into %d vertices.\n", len(lights), len(m.vertices))
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBakeLightingColoursVertices(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"in.obj": "mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nusemtl paint\nf 1//1 2//1 3//1\n",
+		"in.mtl": "newmtl paint\nKd 0.5 1 1\n",
+	})
+	// The second light is behind the face and adds nothing.
+	file := readOutput(t, convertFile(t, dir, "in.obj", "-bake-light", "dir=0,0,2 color=1,0.5,1", "-bake-light", "dir=0,0,-1"))
+
+	if file.header.vertexType&VERTEX_COLOR == 0 {
+		t.Fatal("the output has no vertex colours")
+	}
+	for i, v := range file.vertices {
+		if !closeTo(float64(v.R), 0.5, 1e-6) || !closeTo(float64(v.G), 0.5, 1e-6) || !closeTo(float64(v.B), 1, 1e-6) || v.A != 1 {
+			t.Errorf("vertex %d has colour %g,%g,%g,%g, want 0.5,0.5,1,1", i, v.R, v.G, v.B, v.A)
+		}
+	}
+}
+
+func TestBakeLightingNeedsNormals(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"})
+	resetCommandLine()
+	if err := Convert([]string{"-bake-light", "dir=0,0,1", filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx")}); err == nil {
+		t.Error("baking a mesh without normals succeeded")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const benchmarkOBJ = "testdata/sphere.obj"
+
+// Read the benchmark mesh with its quads split into triangles and return its geometry.
+func loadBenchmarkMesh(b *testing.B) Geometry {
+	b.Helper()
+	resetCommandLine()
+	m := NewMesh()
+	file, err := os.Open(benchmarkOBJ)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	if err := m.ProcessOBJFile(file); err != nil {
+		b.Fatal(err)
+	}
+	for i := range m.faces {
+		if m.faces[i].edges == 4 {
+			m.ConvertQuadToTriangles(&m.faces[i])
+		}
+	}
+	return m.TakeGeometry()
+}
+
+// Copy the geometry into a new mesh, the passes change the faces in place so each run needs
+// its own copy.
+func restoreMesh(g Geometry) *Mesh {
+	m := NewMesh()
+	m.vertices, m.normals, m.textureCoords = slices.Clone(g.vertices), slices.Clone(g.normals), slices.Clone(g.textureCoords)
+	m.polylines, m.points = slices.Clone(g.polylines), slices.Clone(g.points)
+	m.faces = make([]Face, len(g.faces))
+	for i, f := range g.faces {
+		f.v, f.n, f.t, f.uv = slices.Clone(f.v), slices.Clone(f.n), slices.Clone(f.t), slices.Clone(f.uv)
+		m.faces[i] = f
+	}
+	return m
+}
+
+func BenchmarkDeDupe(b *testing.B) {
+	mesh := loadBenchmarkMesh(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		m := restoreMesh(mesh)
+		b.StartTimer()
+		m.DeDupe(0.0001, 0.001, 0.00001)
+	}
+}
+
+func BenchmarkOptimiseMesh(b *testing.B) {
+	mesh := loadBenchmarkMesh(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		m := restoreMesh(mesh)
+		b.StartTimer()
+		m.OptimiseMesh(MORTON_RESOLUTION)
+	}
+}
+
+func BenchmarkRitterBoundingSphere(b *testing.B) {
+	mesh := loadBenchmarkMesh(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		RitterBoundingSphere(mesh.vertices)
+	}
+}
+
+func BenchmarkConvert(b *testing.B) {
+	output := filepath.Join(b.TempDir(), "out.mshx")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resetCommandLine()
+		if err := Convert([]string{"-d", "-mo", benchmarkOBJ, output}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
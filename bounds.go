@@ -1,76 +1,293 @@
-package main
-
-import (
-	"math"
-)
-
-// Distance computes the Euclidean distance between two points
-func Distance(a, b Vertex) float64 {
-	dx, dy, dz := float64(a.X-b.X), float64(a.Y-b.Y), float64(a.Z-b.Z)
-	return math.Sqrt(dx*dx + dy*dy + dz*dz)
-}
-
-// Find the farthest point from a given reference point
-func FarthestPoint(points []Vertex, ref Vertex) Vertex {
-	var farthest Vertex
-	maxDist := -1.0
-	for _, p := range points {
-		dist := Distance(ref, p)
-		if dist > maxDist {
-			maxDist = dist
-			farthest = p
-		}
-	}
-	return farthest
-}
-
-// Compute bounding sphere using Ritter's Algorithm
-func RitterBoundingSphere(points []Vertex) (center Vertex, radius float64) {
-	if len(points) == 0 {
-		return Vertex{}, 0
-	}
-
-	// Step 1: Pick an arbitrary point P0
-	p0 := points[0]
-
-	// Step 2: Find P1, the farthest point from P0
-	p1 := FarthestPoint(points, p0)
-
-	// Step 3: Find P2, the farthest point from P1
-	p2 := FarthestPoint(points, p1)
-
-	// Step 4: Compute initial sphere
-	center = Vertex{
-		X: (p1.X + p2.X) / 2,
-		Y: (p1.Y + p2.Y) / 2,
-		Z: (p1.Z + p2.Z) / 2,
-		W: 1.0,
-		A: 0,
-		R: 0,
-		G: 0,
-		B: 0}
-	radius = Distance(p1, p2) / 2
-
-	// Step 5: Expand sphere if needed
-	for _, p := range points {
-		dist := Distance(center, p)
-		if dist > radius {
-			// Compute new sphere to include p
-			newRadius := (radius + dist) / 2
-			ratio := (newRadius - radius) / dist
-
-			center = Vertex{
-				X: center.X + float32(float64(p.X-center.X)*ratio),
-				Y: center.Y + float32(float64(p.Y-center.Y)*ratio),
-				Z: center.Z + float32(float64(p.Z-center.Z)*ratio),
-				W: 1.0,
-				A: 0,
-				R: 0,
-				G: 0,
-				B: 0}
-			radius = newRadius
-		}
-	}
-
-	return center, radius
-}
+package main
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// Distance computes the Euclidean distance between two points
+func Distance(a, b Vertex) float64 {
+	dx, dy, dz := float64(a.X-b.X), float64(a.Y-b.Y), float64(a.Z-b.Z)
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// Distance between the double precision positions kept with -precise.
+func PreciseDistance(a, b Vertex) float64 {
+	dx, dy, dz := a.precise[0]-b.precise[0], a.precise[1]-b.precise[1], a.precise[2]-b.precise[2]
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// Find the minimum and maximum extents of the points along each axis
+func MinMax(points []Vertex) (min, max Vertex) {
+	if len(points) == 0 {
+		return Vertex{}, Vertex{}
+	}
+	min = points[0]
+	max = points[0]
+	for _, p := range points {
+		min.X = float32(math.Min(float64(min.X), float64(p.X)))
+		min.Y = float32(math.Min(float64(min.Y), float64(p.Y)))
+		min.Z = float32(math.Min(float64(min.Z), float64(p.Z)))
+		max.X = float32(math.Max(float64(max.X), float64(p.X)))
+		max.Y = float32(math.Max(float64(max.Y), float64(p.Y)))
+		max.Z = float32(math.Max(float64(max.Z), float64(p.Z)))
+	}
+	return min, max
+}
+
+// Split the range [0, count) into at most GOMAXPROCS chunks and process the chunks concurrently,
+// the chunk number passed to work is below GOMAXPROCS and increases with the range start
+func ParallelChunks(count int, work func(chunk, start, end int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > count {
+		workers = count
+	}
+	if workers <= 1 {
+		work(0, 0, count)
+		return
+	}
+	var wg sync.WaitGroup
+	size := (count + workers - 1) / workers
+	for c := 0; c*size < count; c++ {
+		wg.Add(1)
+		go func(c, start, end int) {
+			defer wg.Done()
+			work(c, start, end)
+		}(c, c*size, min((c+1)*size, count))
+	}
+	wg.Wait()
+}
+
+// Find the farthest point from a given reference point, ties resolve to the lowest index
+func FarthestPoint(points []Vertex, ref Vertex) Vertex {
+	workers := runtime.GOMAXPROCS(0)
+	bestIdx := make([]int, workers)
+	bestDist := make([]float64, workers)
+	for w := range bestIdx {
+		bestIdx[w] = -1
+	}
+	ParallelChunks(len(points), func(w, start, end int) {
+		idx, maxDist := -1, -1.0
+		for i := start; i < end; i++ {
+			dist := Distance(ref, points[i])
+			if dist > maxDist {
+				maxDist = dist
+				idx = i
+			}
+		}
+		bestIdx[w], bestDist[w] = idx, maxDist
+	})
+
+	var farthest Vertex
+	maxDist := -1.0
+	for w := range bestIdx {
+		if bestIdx[w] >= 0 && bestDist[w] > maxDist {
+			maxDist = bestDist[w]
+			farthest = points[bestIdx[w]]
+		}
+	}
+	return farthest
+}
+
+// Compute bounding sphere using Ritter's Algorithm
+func RitterBoundingSphere(points []Vertex) (center Vertex, radius float64) {
+	if len(points) == 0 {
+		return Vertex{}, 0
+	}
+
+	// Step 1: Pick an arbitrary point P0
+	p0 := points[0]
+
+	// Step 2: Find P1, the farthest point from P0
+	p1 := FarthestPoint(points, p0)
+
+	// Step 3: Find P2, the farthest point from P1
+	p2 := FarthestPoint(points, p1)
+
+	// Step 4: Compute initial sphere
+	center = Vertex{
+		X: (p1.X + p2.X) / 2,
+		Y: (p1.Y + p2.Y) / 2,
+		Z: (p1.Z + p2.Z) / 2,
+		W: 1.0,
+		A: 0,
+		R: 0,
+		G: 0,
+		B: 0}
+	radius = Distance(p1, p2) / 2
+
+	// Step 5: Expand sphere if needed
+	for _, p := range points {
+		dist := Distance(center, p)
+		if dist > radius {
+			// Compute new sphere to include p
+			newRadius := (radius + dist) / 2
+			ratio := (newRadius - radius) / dist
+
+			center = Vertex{
+				X: center.X + float32(float64(p.X-center.X)*ratio),
+				Y: center.Y + float32(float64(p.Y-center.Y)*ratio),
+				Z: center.Z + float32(float64(p.Z-center.Z)*ratio),
+				W: 1.0,
+				A: 0,
+				R: 0,
+				G: 0,
+				B: 0}
+			radius = newRadius
+		}
+	}
+
+	return center, radius
+}
+
+type sphere64 struct {
+	c [3]float64
+	r float64
+}
+
+func (s sphere64) contains(p [3]float64) bool {
+	dx, dy, dz := p[0]-s.c[0], p[1]-s.c[1], p[2]-s.c[2]
+	return math.Sqrt(dx*dx+dy*dy+dz*dz) <= s.r*(1+1e-9)+1e-12
+}
+
+func dist64(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// Smallest sphere with both points on its surface
+func sphereFrom2(a, b [3]float64) sphere64 {
+	return sphere64{[3]float64{(a[0] + b[0]) / 2, (a[1] + b[1]) / 2, (a[2] + b[2]) / 2}, dist64(a, b) / 2}
+}
+
+// Smallest sphere with all three points on its surface
+func sphereFrom3(p0, p1, p2 [3]float64) sphere64 {
+	ax, ay, az := p1[0]-p0[0], p1[1]-p0[1], p1[2]-p0[2]
+	bx, by, bz := p2[0]-p0[0], p2[1]-p0[1], p2[2]-p0[2]
+	nx, ny, nz := crossProduct(ax, ay, az, bx, by, bz)
+	n2 := nx*nx + ny*ny + nz*nz
+	if n2 < 1e-18 {
+		// Collinear, the two farthest points define the sphere
+		s := sphereFrom2(p0, p1)
+		if t := sphereFrom2(p0, p2); t.r > s.r {
+			s = t
+		}
+		if t := sphereFrom2(p1, p2); t.r > s.r {
+			s = t
+		}
+		return s
+	}
+	a2 := ax*ax + ay*ay + az*az
+	b2 := bx*bx + by*by + bz*bz
+	ux, uy, uz := crossProduct(a2*bx-b2*ax, a2*by-b2*ay, a2*bz-b2*az, nx, ny, nz)
+	c := [3]float64{p0[0] + ux/(2*n2), p0[1] + uy/(2*n2), p0[2] + uz/(2*n2)}
+	return sphere64{c, dist64(c, p0)}
+}
+
+// Smallest sphere with all four points on its surface
+func sphereFrom4(p0, p1, p2, p3 [3]float64) sphere64 {
+	ax, ay, az := p1[0]-p0[0], p1[1]-p0[1], p1[2]-p0[2]
+	bx, by, bz := p2[0]-p0[0], p2[1]-p0[1], p2[2]-p0[2]
+	cx, cy, cz := p3[0]-p0[0], p3[1]-p0[1], p3[2]-p0[2]
+	cbx, cby, cbz := crossProduct(bx, by, bz, cx, cy, cz)
+	det := dotProduct(ax, ay, az, cbx, cby, cbz)
+	if math.Abs(det) < 1e-18 {
+		// Coplanar, use the smallest sphere through three of the points which holds the fourth
+		var pts = [4][3]float64{p0, p1, p2, p3}
+		var best sphere64 = sphere64{r: math.Inf(1)}
+		for skip := 0; skip < 4; skip++ {
+			var tri [][3]float64
+			for i := 0; i < 4; i++ {
+				if i != skip {
+					tri = append(tri, pts[i])
+				}
+			}
+			s := sphereFrom3(tri[0], tri[1], tri[2])
+			if s.contains(pts[skip]) && s.r < best.r {
+				best = s
+			}
+		}
+		return best
+	}
+	a2 := ax*ax + ay*ay + az*az
+	b2 := bx*bx + by*by + bz*bz
+	c2 := cx*cx + cy*cy + cz*cz
+	acx, acy, acz := crossProduct(cx, cy, cz, ax, ay, az)
+	abx, aby, abz := crossProduct(ax, ay, az, bx, by, bz)
+	c := [3]float64{
+		p0[0] + (a2*cbx+b2*acx+c2*abx)/(2*det),
+		p0[1] + (a2*cby+b2*acy+c2*aby)/(2*det),
+		p0[2] + (a2*cbz+b2*acz+c2*abz)/(2*det)}
+	return sphere64{c, dist64(c, p0)}
+}
+
+// Compute the minimum bounding sphere using Welzl's algorithm, written iteratively
+// as nested loops over a shuffled copy of the points to avoid deep recursion.
+func WelzlBoundingSphere(points []Vertex) (center Vertex, radius float64) {
+	if len(points) == 0 {
+		return Vertex{}, 0
+	}
+
+	pts := make([][3]float64, len(points))
+	for i, p := range points {
+		pts[i] = [3]float64{float64(p.X), float64(p.Y), float64(p.Z)}
+	}
+	// Shuffle with a fixed seed so the expected linear run time holds and results are repeatable
+	rng := rand.New(rand.NewSource(1))
+	rng.Shuffle(len(pts), func(i, j int) { pts[i], pts[j] = pts[j], pts[i] })
+
+	s := sphere64{pts[0], 0}
+	for i := 1; i < len(pts); i++ {
+		if s.contains(pts[i]) {
+			continue
+		}
+		s = sphere64{pts[i], 0}
+		for j := 0; j < i; j++ {
+			if s.contains(pts[j]) {
+				continue
+			}
+			s = sphereFrom2(pts[i], pts[j])
+			for k := 0; k < j; k++ {
+				if s.contains(pts[k]) {
+					continue
+				}
+				s = sphereFrom3(pts[i], pts[j], pts[k])
+				for l := 0; l < k; l++ {
+					if s.contains(pts[l]) {
+						continue
+					}
+					s = sphereFrom4(pts[i], pts[j], pts[k], pts[l])
+				}
+			}
+		}
+	}
+
+	center = Vertex{
+		X: float32(s.c[0]),
+		Y: float32(s.c[1]),
+		Z: float32(s.c[2]),
+		W: 1.0,
+		A: 0,
+		R: 0,
+		G: 0,
+		B: 0}
+	return center, s.r
+}
+
+func (m *Mesh) GenerateBoundingSphere() {
+	var boundingSphere func([]Vertex) (Vertex, float64) = RitterBoundingSphere
+	if *spherePtr == "welzl" {
+		boundingSphere = WelzlBoundingSphere
+	}
+	center, radius := boundingSphere(m.vertices)
+	m.boundSphere.center = center
+	m.boundSphere.radius = float32(radius)
+	Logf(LOG_INFO, "Generated Bounding Sphere: %v\n", m.boundSphere)
+}
+
+func (m *Mesh) GenerateBoundingBox() {
+	m.boundBox.min, m.boundBox.max = MinMax(m.vertices)
+	Logf(LOG_INFO, "Generated Bounding Box: %v %v\n", m.boundBox.min, m.boundBox.max)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func closeTo(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestScaleDoublesBoundingSphere(t *testing.T) {
+	unit := convertOBJ(t, cubeOBJ)
+	scaled := convertOBJ(t, cubeOBJ, "-scale", "2")
+
+	if !closeTo(float64(scaled.header.sphere.radius), 2*float64(unit.header.sphere.radius), 1e-5) {
+		t.Errorf("scaled radius %g, want twice %g", scaled.header.sphere.radius, unit.header.sphere.radius)
+	}
+	c := scaled.header.sphere.center
+	if !closeTo(float64(c.X), 1, 1e-5) || !closeTo(float64(c.Y), 1, 1e-5) || !closeTo(float64(c.Z), 1, 1e-5) {
+		t.Errorf("scaled sphere centre %g,%g,%g, want 1,1,1", c.X, c.Y, c.Z)
+	}
+	for i, v := range scaled.vertices {
+		u := unit.vertices[i]
+		if v.X != 2*u.X || v.Y != 2*u.Y || v.Z != 2*u.Z {
+			t.Errorf("vertex %d is %g,%g,%g, want twice %g,%g,%g", i, v.X, v.Y, v.Z, u.X, u.Y, u.Z)
+		}
+	}
+}
+
+func TestNonUniformScaleRenormalizesNormals(t *testing.T) {
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nvn 1 1 0\nf 1//1 2//1 3//1\n"
+	file := convertOBJ(t, obj, "-scalexyz", "2,1,1")
+	if len(file.normals) != 1 {
+		t.Fatalf("got %d normals, want 1", len(file.normals))
+	}
+	// Normals scale by the inverse, 1/2,1,0 normalized.
+	n := file.normals[0]
+	want := [3]float64{1 / math.Sqrt(5), 2 / math.Sqrt(5), 0}
+	if !closeTo(float64(n.X), want[0], 1e-5) || !closeTo(float64(n.Y), want[1], 1e-5) || !closeTo(float64(n.Z), want[2], 1e-5) {
+		t.Errorf("normal %g,%g,%g, want %v", n.X, n.Y, n.Z, want)
+	}
+}
+
+func TestBoundingBoxEnclosesMeshTightly(t *testing.T) {
+	obj := "v -1 2 3\nv 4 -5 6\nv 7 8 -9\nv 0.5 0.5 0.5\nf 1 2 3\nf 2 3 4\n"
+	file := convertOBJ(t, obj)
+
+	box := file.header.box
+	if [3]float32{box.min.X, box.min.Y, box.min.Z} != [3]float32{-1, -5, -9} {
+		t.Errorf("box min %g,%g,%g, want -1,-5,-9", box.min.X, box.min.Y, box.min.Z)
+	}
+	if [3]float32{box.max.X, box.max.Y, box.max.Z} != [3]float32{7, 8, 6} {
+		t.Errorf("box max %g,%g,%g, want 7,8,6", box.max.X, box.max.Y, box.max.Z)
+	}
+	for i, v := range file.vertices {
+		if v.X < box.min.X || v.Y < box.min.Y || v.Z < box.min.Z || v.X > box.max.X || v.Y > box.max.Y || v.Z > box.max.Z {
+			t.Errorf("vertex %d at %g,%g,%g is outside the box", i, v.X, v.Y, v.Z)
+		}
+	}
+}
+
+// Points spread through a box, with a fixed seed so every run sees the same points.
+func randomPoints(count int, seed int64) []Vertex {
+	r := rand.New(rand.NewSource(seed))
+	points := make([]Vertex, count)
+	for i := range points {
+		points[i] = Vertex{X: r.Float32()*20 - 10, Y: r.Float32()*6 - 3, Z: r.Float32() * 2, W: 1}
+	}
+	return points
+}
+
+func TestWelzlSphereNoLargerThanRitter(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		points := randomPoints(500, seed)
+		_, ritter := RitterBoundingSphere(points)
+		center, welzl := WelzlBoundingSphere(points)
+		if welzl > ritter*(1+1e-6) {
+			t.Errorf("seed %d: Welzl radius %g is larger than Ritter radius %g", seed, welzl, ritter)
+		}
+		for i, p := range points {
+			if d := Distance(center, p); d > welzl*(1+1e-5) {
+				t.Errorf("seed %d: point %d is %g from the Welzl centre, outside radius %g", seed, i, d, welzl)
+				break
+			}
+		}
+	}
+}
+
+func TestFarthestPointTiesBreakOnLowestIndex(t *testing.T) {
+	points := randomPoints(1000, 7)
+	for i := range points {
+		points[i].X, points[i].Y, points[i].Z = points[i].X*0.1, points[i].Y*0.1, points[i].Z*0.1
+	}
+	// Equally far points, the first of them must win with any number of workers.
+	for _, i := range []int{100, 400, 900} {
+		points[i] = Vertex{X: 50, W: 1, R: float32(i)}
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	for _, workers := range []int{1, 2, 3, 8} {
+		runtime.GOMAXPROCS(workers)
+		if got := FarthestPoint(points, Vertex{}); got.R != 100 {
+			t.Errorf("%d workers picked point %g, want 100", workers, got.R)
+		}
+	}
+}
+
+func BenchmarkFarthestPoint1M(b *testing.B) {
+	points := randomPoints(1000000, 1)
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	for _, workers := range slices.Compact([]int{1, runtime.NumCPU()}) {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			runtime.GOMAXPROCS(workers)
+			for i := 0; i < b.N; i++ {
+				FarthestPoint(points, points[0])
+			}
+		})
+	}
+}
+
+func TestQuantizeCentroidStaysOnTheGrid(t *testing.T) {
+	tests := []struct {
+		c, min, max float32
+		want        uint32
+	}{
+		{0, 0, 1, 0},
+		{0.5, 0, 1, 512},
+		{1, 0, 1, MORTON_RESOLUTION - 1},
+		{2, 0, 1, MORTON_RESOLUTION - 1},
+		{-1, 0, 1, 0},
+		{3, 3, 3, 0},
+		{float32(math.NaN()), 0, 1, 0},
+	}
+	for _, test := range tests {
+		if got := quantizeCentroid(test.c, test.min, test.max, MORTON_RESOLUTION); got != test.want {
+			t.Errorf("quantizeCentroid(%g, %g, %g) = %d, want %d", test.c, test.min, test.max, got, test.want)
+		}
+	}
+}
+
+func TestPlanarMeshGivesNoNaN(t *testing.T) {
+	// Every vertex has z = 0, so the mesh has no extent along z.
+	var flat strings.Builder
+	for _, line := range strings.Split(gridOBJ(4), "\n") {
+		var x, y, z float32
+		if _, err := fmt.Sscanf(line, "v %g %g %g", &x, &y, &z); err == nil {
+			line = fmt.Sprintf("v %g %g 0", x, y)
+		}
+		flat.WriteString(line + "\n")
+	}
+	obj := flat.String()
+	for _, args := range [][]string{{"-mo"}, {"-align-pca", "x"}, {"-align-pca", "z", "-mo", "-center"}} {
+		file := convertOBJ(t, obj, args...)
+		values := []float32{file.header.sphere.center.X, file.header.sphere.center.Y, file.header.sphere.center.Z, file.header.sphere.radius,
+			file.header.box.min.X, file.header.box.min.Y, file.header.box.min.Z, file.header.box.max.X, file.header.box.max.Y, file.header.box.max.Z}
+		for _, v := range file.vertices {
+			values = append(values, v.X, v.Y, v.Z)
+		}
+		for _, v := range values {
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				t.Errorf("%v wrote %g for a planar mesh", args, v)
+				break
+			}
+		}
+		if len(file.faces) != 32 {
+			t.Errorf("%v wrote %d faces, want 32", args, len(file.faces))
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A formatted element line with the values it was formatted from, rounded as they are printed
+// so the numeric order and the text agree.
+type canonicalLine struct {
+	text   string
+	values []float64
+}
+
+// Format a value with six decimals. Negative values which round to zero are printed as
+// 0.000000, the same as positive zero.
+func canonicalNumber(v float32) string {
+	s := strconv.FormatFloat(float64(v), 'f', 6, 32)
+	if s == "-0.000000" {
+		return "0.000000"
+	}
+	return s
+}
+
+func makeCanonicalLine(keyword string, values ...float32) canonicalLine {
+	line := canonicalLine{text: keyword}
+	for _, v := range values {
+		s := canonicalNumber(v)
+		f, _ := strconv.ParseFloat(s, 64)
+		line.text += " " + s
+		line.values = append(line.values, f)
+	}
+	return line
+}
+
+// Order lines by their values, comparing the first value then the next and so on.
+func compareCanonicalLines(a, b canonicalLine) int {
+	if c := slices.Compare(a.values, b.values); c != 0 {
+		return c
+	}
+	return strings.Compare(a.text, b.text)
+}
+
+// Sort the lines numerically, merging identical lines, and return the sorted text along with
+// the new 1-based index of each original line.
+func canonicalOrder(lines []canonicalLine) ([]string, []int) {
+	sorted := slices.Clone(lines)
+	slices.SortFunc(sorted, compareCanonicalLines)
+	sorted = slices.CompactFunc(sorted, func(a, b canonicalLine) bool { return a.text == b.text })
+	text := make([]string, len(sorted))
+	lookup := make(map[string]int, len(sorted))
+	for i, l := range sorted {
+		text[i] = l.text
+		lookup[l.text] = i + 1
+	}
+	remap := make([]int, len(lines))
+	for i, l := range lines {
+		remap[i] = lookup[l.text]
+	}
+	return text, remap
+}
+
+// An element line of indices, ordered by the indices.
+func makeIndexLine(keyword string, indices []int, text string) canonicalLine {
+	line := canonicalLine{text: keyword + text}
+	for _, i := range indices {
+		line.values = append(line.values, float64(i))
+	}
+	return line
+}
+
+func writeCanonicalLines(writer *bufio.Writer, lines []canonicalLine) {
+	slices.SortFunc(lines, compareCanonicalLines)
+	for _, l := range lines {
+		fmt.Fprintln(writer, l.text)
+	}
+}
+
+// Write the mesh as an OBJ file with a fixed number format and a deterministic ordering of every
+// element, so that the same mesh always produces the same text regardless of the source ordering.
+func (m *Mesh) WriteCanonicalOBJ(outputFile io.Writer) error {
+	writer := bufio.NewWriter(outputFile)
+
+	// Vertices are sorted by position, then by any colour or w.
+	vertexLines := make([]canonicalLine, len(m.vertices))
+	for i, v := range m.vertices {
+		if m.vertexType&VERTEX_COLOR != 0 {
+			vertexLines[i] = makeCanonicalLine("v", v.X, v.Y, v.Z, v.R, v.G, v.B)
+		} else if m.vertexType&VERTEX_W != 0 {
+			vertexLines[i] = makeCanonicalLine("v", v.X, v.Y, v.Z, v.W)
+		} else {
+			vertexLines[i] = makeCanonicalLine("v", v.X, v.Y, v.Z)
+		}
+	}
+	normalLines := make([]canonicalLine, len(m.normals))
+	for i, n := range m.normals {
+		normalLines[i] = makeCanonicalLine("vn", n.X, n.Y, n.Z)
+	}
+	uvLines := make([]canonicalLine, len(m.textureCoords))
+	for i, t := range m.textureCoords {
+		if m.vertexType&UV_W != 0 {
+			uvLines[i] = makeCanonicalLine("vt", t.U, t.V, t.W)
+		} else {
+			uvLines[i] = makeCanonicalLine("vt", t.U, t.V)
+		}
+	}
+	sortedVertices, vertexRemap := canonicalOrder(vertexLines)
+	sortedNormals, normalRemap := canonicalOrder(normalLines)
+	sortedUVs, uvRemap := canonicalOrder(uvLines)
+
+	// Faces are grouped by material and each face starts from its lowest vertex index,
+	// keeping the winding order intact.
+	faceLines := make(map[string][]canonicalLine)
+	for i := range m.faces {
+		f := &m.faces[i]
+		var first int = 0
+		for j := 1; j < int(f.edges); j++ {
+			if vertexRemap[f.v[j]] < vertexRemap[f.v[first]] {
+				first = j
+			}
+		}
+		var sb strings.Builder
+		var indices []int
+		for k := 0; k < int(f.edges); k++ {
+			j := (first + k) % int(f.edges)
+			fmt.Fprintf(&sb, " %d", vertexRemap[f.v[j]])
+			indices = append(indices, vertexRemap[f.v[j]])
+			if len(f.uv) > 0 && len(f.n) > 0 {
+				fmt.Fprintf(&sb, "/%d/%d", uvRemap[f.uv[j]], normalRemap[f.n[j]])
+				indices = append(indices, uvRemap[f.uv[j]], normalRemap[f.n[j]])
+			} else if len(f.uv) > 0 {
+				fmt.Fprintf(&sb, "/%d", uvRemap[f.uv[j]])
+				indices = append(indices, uvRemap[f.uv[j]])
+			} else if len(f.n) > 0 {
+				fmt.Fprintf(&sb, "//%d", normalRemap[f.n[j]])
+				indices = append(indices, normalRemap[f.n[j]])
+			}
+		}
+		faceLines[f.materialName] = append(faceLines[f.materialName], makeIndexLine("f", indices, sb.String()))
+	}
+
+	// The material libraries come first so the usemtl lines below resolve.
+	if len(m.materialLibraries) > 0 {
+		libraries := slices.Clone(m.materialLibraries)
+		slices.Sort(libraries)
+		fmt.Fprintf(writer, "mtllib %s\n", strings.Join(libraries, " "))
+	}
+	for _, l := range sortedVertices {
+		fmt.Fprintln(writer, l)
+	}
+	for _, l := range sortedUVs {
+		fmt.Fprintln(writer, l)
+	}
+	for _, l := range sortedNormals {
+		fmt.Fprintln(writer, l)
+	}
+	var materialNames []string
+	for name := range faceLines {
+		materialNames = append(materialNames, name)
+	}
+	slices.Sort(materialNames)
+	for _, name := range materialNames {
+		if name != "" {
+			fmt.Fprintf(writer, "usemtl %s\n", name)
+		}
+		writeCanonicalLines(writer, faceLines[name])
+	}
+
+	// Line and point elements follow the faces, sorted the same way.
+	var elementLines []canonicalLine
+	for i := range m.polylines {
+		var sb strings.Builder
+		var indices []int
+		for j := range m.polylines[i].v {
+			fmt.Fprintf(&sb, " %d", vertexRemap[m.polylines[i].v[j]])
+			indices = append(indices, vertexRemap[m.polylines[i].v[j]])
+			if len(m.polylines[i].uv) > 0 {
+				fmt.Fprintf(&sb, "/%d", uvRemap[m.polylines[i].uv[j]])
+				indices = append(indices, uvRemap[m.polylines[i].uv[j]])
+			}
+		}
+		elementLines = append(elementLines, makeIndexLine("l", indices, sb.String()))
+	}
+	writeCanonicalLines(writer, elementLines)
+	var pointLines []canonicalLine
+	for i := range m.points {
+		v := vertexRemap[m.points[i].v]
+		pointLines = append(pointLines, makeIndexLine("p", []int{v}, fmt.Sprintf(" %d", v)))
+	}
+	writeCanonicalLines(writer, pointLines)
+
+	if err := writer.Flush(); err != nil {
+		Logf(LOG_ERROR, "Error flushing writer: %v\n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalOBJIgnoresSourceOrder(t *testing.T) {
+	mtl := "newmtl red\nKd 1 0 0\nnewmtl blue\nKd 0 0 1\n"
+	first := `mtllib mats.mtl
+v 0 0 0
+v 10 0 0
+v 9 -2 0
+v -1 0.5 0
+v 2 -0 1
+vt 0 0
+vt 1 0
+vt 1 1
+usemtl red
+f 1/1 2/2 3/3
+f 1/1 3/2 4/3
+usemtl blue
+f 2/1 5/2 3/3
+`
+	// The same mesh with the vertices and texture coords shuffled, the faces in another order
+	// starting from other corners, negative zeros and different number formatting.
+	second := `mtllib mats.mtl
+vt 1.0 1.0
+vt 0.000 -0.0
+vt 1 0
+v -1.0 0.50 -0.0
+v 2.0000001 0 1
+v 9.0 -2.0 0.0
+v 1e1 0 0
+v -0 -0 -0
+usemtl blue
+f 2/3 3/1 4/2
+usemtl red
+f 1/1 5/2 3/3
+f 3/1 5/2 4/3
+`
+	dir := writeFiles(t, map[string]string{"first.obj": first, "second.obj": second, "mats.mtl": mtl})
+	a := convertFile(t, dir, "first.obj", "-format", "obj-canonical")
+	b := convertFile(t, dir, "second.obj", "-format", "obj-canonical")
+	if !bytes.Equal(a, b) {
+		t.Fatalf("canonical output differs:\n%s\n---\n%s", a, b)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(a)), "\n")
+	if lines[0] != "mtllib mats.mtl" {
+		t.Errorf("first line %q, want the mtllib line", lines[0])
+	}
+	if strings.Contains(string(a), "-0.000000") {
+		t.Errorf("negative zero in the output:\n%s", a)
+	}
+
+	// The vertices are in numeric rather than text order.
+	var xs []float64
+	for _, l := range lines {
+		if fields := strings.Fields(l); fields[0] == "v" {
+			x, _ := strconv.ParseFloat(fields[1], 64)
+			xs = append(xs, x)
+		}
+	}
+	want := []float64{-1, 0, 2, 9, 10}
+	if len(xs) != len(want) {
+		t.Fatalf("got %d vertices, want %d", len(xs), len(want))
+	}
+	for i := range want {
+		if xs[i] != want[i] {
+			t.Errorf("vertex x values %v, want %v", xs, want)
+			break
+		}
+	}
+}
+
+func TestCanonicalNumber(t *testing.T) {
+	tests := []struct {
+		value float32
+		want  string
+	}{
+		{0, "0.000000"},
+		{float32(math.Copysign(0, -1)), "0.000000"},
+		{-0.0000001, "0.000000"},
+		{-0.000001, "-0.000001"},
+		{1.5, "1.500000"},
+	}
+	for _, test := range tests {
+		if got := canonicalNumber(test.value); got != test.want {
+			t.Errorf("canonicalNumber(%g) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Create the flag set of a subcommand, its usage is printed to the log.
+func subcommandFlags(command string, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(logOutput, "Usage: objconv "+command+" "+usage)
+		fmt.Fprintln(logOutput, "Flags:")
+		flags.SetOutput(logOutput)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Parse the OBJ file and report every problem found without writing anything.
+func (m *Mesh) ValidateOBJ(inputFile *os.File) error {
+	m.ProgressPhase("parsing")
+	objReader, err := DecompressInput(inputFile, m.inputFileName)
+	if err != nil {
+		return err
+	}
+	err = m.ProcessOBJFile(objReader)
+	if err != nil {
+		return err
+	}
+	m.ProgressPhase("validating")
+	err = m.ValidateMesh()
+	m.ProgressDone()
+	return err
+}
+
+// objconv validate [flags] <input file>
+func ValidateCommand(arguments []string) error {
+	flags := subcommandFlags("validate", "[flags] <input file>")
+	defineMessageFlags(flags)
+	defineReadFlags(flags)
+	defineQuadFlags(flags)
+	flags.Parse(arguments)
+	SetLogLevel()
+	Logf(LOG_INFO, "-- OBJ file converter v0.1 --\n")
+	if *planarTolPtr < 0 || *planarTolPtr > 1 {
+		Logf(LOG_ERROR, "Error: -planartol must be between 0 and 1.\n")
+		return errors.New("invalid command line")
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("invalid command line")
+	}
+
+	m := NewMesh()
+	m.inputFileName = flags.Arg(0)
+	inputFile, err := OpenInput(m.inputFileName)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+	return m.ValidateOBJ(inputFile)
+}
+
+// objconv inspect [-full] <file.mshx>, prints the header, section counts and materials of an
+// MSHX file as key=value lines.
+func InspectCommand(arguments []string) error {
+	flags := subcommandFlags("inspect", "[flags] <file.mshx>")
+	fullPtr := flags.Bool("full", false, "Load the whole file, verifying the checksum and counting the material ranges and vertex splits")
+	flags.Parse(arguments)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("invalid command line")
+	}
+
+	inputFile, err := OpenInput(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+	var file *MSHXFile
+	if *fullPtr {
+		file, err = ReadMSHX(inputFile)
+	} else {
+		file, err = ReadMSHXSummary(inputFile)
+	}
+	if err != nil {
+		Logf(LOG_ERROR, "Error reading %s: %v\n", flags.Arg(0), err)
+		return err
+	}
+
+	h := &file.header
+	fmt.Fprintf(logOutput, "magic=MSHX\n")
+	fmt.Fprintf(logOutput, "version=%d\n", h.version)
+	fmt.Fprintf(logOutput, "byte_order=%v\n", h.byteOrder)
+	fmt.Fprintf(logOutput, "vertices=%d\n", h.vertexCount)
+	fmt.Fprintf(logOutput, "normals=%d\n", h.normalCount)
+	fmt.Fprintf(logOutput, "tangents=%d\n", h.tangentCount)
+	fmt.Fprintf(logOutput, "uvs=%d\n", h.uvCount)
+	if h.vertexType&TRIANGLE_STRIPS != 0 {
+		fmt.Fprintf(logOutput, "triangle_strips=%d\n", h.faceCount)
+	} else {
+		fmt.Fprintf(logOutput, "faces=%d\n", h.faceCount)
+	}
+	fmt.Fprintf(logOutput, "materials=%d\n", h.materialCount)
+	fmt.Fprintf(logOutput, "lines=%d\n", h.lineCount)
+	fmt.Fprintf(logOutput, "points=%d\n", h.pointCount)
+	if h.version >= 13 {
+		fmt.Fprintf(logOutput, "lods=%d\n", h.lodCount)
+	}
+	fmt.Fprintf(logOutput, "vertex_type=0x%08x\n", h.vertexType)
+	fmt.Fprintf(logOutput, "index_type=%d\n", h.indexType)
+	fmt.Fprintf(logOutput, "unit=%d\n", h.unit)
+	if h.vertexType&NO_BOUND_SPHERE == 0 {
+		fmt.Fprintf(logOutput, "sphere_center=%g,%g,%g\n", h.sphere.center.X, h.sphere.center.Y, h.sphere.center.Z)
+		fmt.Fprintf(logOutput, "sphere_radius=%g\n", h.sphere.radius)
+	}
+	fmt.Fprintf(logOutput, "aabb_min=%g,%g,%g\n", h.box.min.X, h.box.min.Y, h.box.min.Z)
+	fmt.Fprintf(logOutput, "aabb_max=%g,%g,%g\n", h.box.max.X, h.box.max.Y, h.box.max.Z)
+	if h.vertexType&VERTEX_QUANTIZED != 0 {
+		fmt.Fprintf(logOutput, "position_scale=%g,%g,%g\n", h.positionScale[0], h.positionScale[1], h.positionScale[2])
+		fmt.Fprintf(logOutput, "position_bias=%g,%g,%g\n", h.positionBias[0], h.positionBias[1], h.positionBias[2])
+	}
+	for i := range file.materials {
+		if h.version >= 12 {
+			fmt.Fprintf(logOutput, "material_%d_name=%s\n", i, file.materials[i].name)
+		}
+		fmt.Fprintf(logOutput, "material_%d_texture=%s\n", i, file.materials[i].texture)
+	}
+	if *fullPtr {
+		fmt.Fprintf(logOutput, "checksum=%t\n", h.vertexType&FILE_CHECKSUM != 0)
+		fmt.Fprintf(logOutput, "material_ranges=%d\n", len(file.materialRanges))
+		fmt.Fprintf(logOutput, "vertex_splits=%d\n", len(file.vertexSplits))
+		for i, r := range file.lodRanges {
+			fmt.Fprintf(logOutput, "lod_%d_faces=%d,%d\n", i, r.firstFace, r.faceCount)
+			fmt.Fprintf(logOutput, "lod_%d_distance=%g\n", i, r.switchDistance)
+		}
+	}
+	return nil
+}
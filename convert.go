@@ -0,0 +1,642 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Open the named input file, - selects stdin.
+func OpenInput(name string) (*os.File, error) {
+	if name == "-" {
+		return os.Stdin, nil
+	}
+	inputFile, err := os.Open(name)
+	if err != nil {
+		Logf(LOG_ERROR, "Error opening file %s: %v\n", name, err)
+		return nil, err
+	}
+	return inputFile, nil
+}
+
+// Wrap a file in a gzip reader when it starts with the gzip magic, so .obj.gz and .mtl.gz files
+// are read the same as plain ones, and convert it to UTF-8 from the -encoding.
+func DecompressInput(r io.Reader, name string) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return DecodeInput(buffered), nil
+	}
+	gzipReader, err := gzip.NewReader(buffered)
+	if err != nil {
+		Logf(LOG_ERROR, "Error reading gzip file %s: %v\n", name, err)
+		return nil, err
+	}
+	Logf(LOG_VERBOSE, "Decompressing %s\n", name)
+	return DecodeInput(gzipReader), nil
+}
+
+// Run a conversion using the command line settings, any error has already been reported
+// by the time it is returned.
+func Convert(arguments []string) error {
+	inputFileNames, outputFileName, ok := ParseCommandLine(arguments)
+	if !ok {
+		return errors.New("invalid command line")
+	}
+	if *batchPtr != "" {
+		return ConvertBatch(*batchPtr)
+	}
+	return NewMesh().ConvertFile(inputFileNames, outputFileName)
+}
+
+// Convert each file matching the pattern as if it had been given on its own, carrying on past
+// failures and listing how every file went at the end.
+func ConvertBatch(pattern string) error {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		Logf(LOG_ERROR, "Error: Bad -batch pattern %s: %v\n", pattern, err)
+		return err
+	}
+	if len(matches) == 0 {
+		Logf(LOG_ERROR, "Error: No files match %s.\n", pattern)
+		return errors.New("no files to convert")
+	}
+
+	results := make([]error, len(matches))
+	var failed int = 0
+	for i, name := range matches {
+		Logf(LOG_INFO, "-- %s (%d of %d) --\n", name, i+1, len(matches))
+		var outputFileName string
+		if !*validatePtr {
+			outputFileName, results[i] = OutputName(name, *outDirPtr)
+		}
+		if results[i] == nil {
+			results[i] = NewMesh().ConvertFile([]string{name}, outputFileName)
+		}
+		if results[i] != nil {
+			failed++
+		}
+	}
+
+	// The summary is the result of the run so it is shown even with -silent.
+	for i, name := range matches {
+		if results[i] != nil {
+			fmt.Fprintf(logOutput, "FAILED %s: %v\n", name, results[i])
+		} else {
+			fmt.Fprintf(logOutput, "ok     %s\n", name)
+		}
+	}
+	fmt.Fprintf(logOutput, "%d of %d files succeeded.\n", len(matches)-failed, len(matches))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(matches))
+	}
+	return nil
+}
+
+// Convert inputFileNames into outputFileName with the options from the command line, into an
+// empty mesh so nothing is kept from an earlier conversion in the same process.
+func (m *Mesh) ConvertFile(inputFileNames []string, outputFileName string) error {
+	var err error
+	var inputFile *os.File
+	var outputFile *os.File
+
+	// Open input and output files, - selects stdin or stdout.
+	m.inputFileName = inputFileNames[0]
+	inputFile, err = OpenInput(m.inputFileName)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+
+	// Validation only reads the input, the output file is never created.
+	if *validatePtr {
+		return m.ValidateOBJ(inputFile)
+	}
+
+	if outputFileName == "-" {
+		outputFile = os.Stdout
+	} else {
+		if *outDirPtr != "" {
+			err = os.MkdirAll(*outDirPtr, 0755)
+			if err != nil {
+				Logf(LOG_ERROR, "Error creating directory %s: %v\n", *outDirPtr, err)
+				return err
+			}
+		}
+		outputFile, err = os.Create(outputFileName)
+		if err != nil {
+			Logf(LOG_ERROR, "Error creating file %s: %v\n", outputFileName, err)
+			return err
+		}
+		defer outputFile.Close()
+	}
+	var output io.Writer = outputFile
+	var gzipWriter *gzip.Writer
+	if *gzOutPtr {
+		gzipWriter = gzip.NewWriter(outputFile)
+		output = gzipWriter
+	}
+	// Write the end of the gzip stream once the output is complete, then close the file since a
+	// full disk can still fail the writes the system had buffered.
+	closeOutput := func() error {
+		if gzipWriter != nil {
+			if err := gzipWriter.Close(); err != nil {
+				Logf(LOG_ERROR, "Error compressing file %s: %v\n", outputFileName, err)
+				return err
+			}
+		}
+		if outputFile != os.Stdout {
+			if err := outputFile.Close(); err != nil {
+				Logf(LOG_ERROR, "Error closing file %s: %v\n", outputFileName, err)
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Large files can be converted without loading them, at the cost of all processing options.
+	if *streamPtr {
+		err = CheckStreamFlags(m.inputFileName)
+		if err != nil {
+			return err
+		}
+		err = m.StreamConvert(inputFile, output)
+		if err != nil {
+			return err
+		}
+		err = closeOutput()
+		if err != nil {
+			return err
+		}
+		Logf(LOG_INFO, "Done.\n")
+		return nil
+	}
+
+	// Parse in the OBJ files. Each file is parsed and its indices checked on its own, then
+	// appended to the files before it.
+	for i, name := range inputFileNames {
+		m.ProgressPhase("parsing")
+		var earlier Geometry
+		if i > 0 {
+			earlier = m.TakeGeometry()
+			m.inputFileName = name
+			inputFile, err = OpenInput(m.inputFileName)
+			if err != nil {
+				return err
+			}
+			defer inputFile.Close()
+			m.curMaterialName, m.curTextureMap, m.curObjectName = "", "", ""
+		}
+		objReader, err := DecompressInput(inputFile, m.inputFileName)
+		if err != nil {
+			return err
+		}
+		err = m.ProcessOBJFile(objReader)
+		if err != nil {
+			return err
+		}
+
+		// Ensure all face indices are within range before anything dereferences them.
+		m.ProgressPhase("validating")
+		err = m.ValidateFaceIndices()
+		if err != nil {
+			return err
+		}
+		err = m.ValidateElementIndices()
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			m.AppendGeometry(earlier)
+		}
+	}
+	if len(inputFileNames) > 1 {
+		Logf(LOG_INFO, "Merged %d input files into %d vertices and %d faces.\n", len(inputFileNames), len(m.vertices), len(m.faces))
+	}
+	// An empty mesh is still converted, every pass handles having nothing to do.
+	if len(m.faces) == 0 && len(m.polylines) == 0 && len(m.points) == 0 {
+		inputNames := strings.Join(inputFileNames, ", ")
+		if len(m.vertices) == 0 {
+			Logf(LOG_WARN, "Warning: %s has no geometry, writing an empty mesh.\n", inputNames)
+		} else {
+			Logf(LOG_WARN, "Warning: %s has %d vertices but no faces, lines or points.\n", inputNames, len(m.vertices))
+		}
+	}
+
+	// Velocities must be taken while the vertices are still in file order.
+	if *pose2Ptr != "" {
+		err = m.ApplyPose2(*pose2Ptr)
+		if err != nil {
+			return err
+		}
+	}
+	err = m.ValidateFaceAttributes()
+	if err != nil {
+		return err
+	}
+
+	// Only export the requested objects, which also drops anything the other objects used.
+	if *objectsPtr != "" {
+		err = m.FilterObjects(strings.Split(*objectsPtr, ","))
+		if err != nil {
+			return err
+		}
+	} else if !*keepUnusedPtr && (len(m.faces) > 0 || len(m.polylines) > 0 || len(m.points) > 0) {
+		// Without any elements the vertices are all there is, so they are left alone.
+		m.PruneAttributes()
+	}
+
+	// Convert to the target coordinate system before anything depends on the orientation.
+	if *yzUpPtr {
+		m.YUpToZUp()
+	}
+	if *flipWindingPtr {
+		m.FlipWinding()
+	}
+
+	// Validate Quad Face Structure.
+	var i int = 0
+	for i < len(m.faces) {
+
+		Logf(LOG_DEBUG, "Processing Face %d\n", i)
+		m.ProgressUpdate()
+
+		if m.faces[i].edges == 4 && *qPtr != 3 {
+			FakeQuadCheck(&m.faces[i])
+		}
+
+		// Cmd line option, force all quads to triangle conversion
+		if m.faces[i].edges == 4 && *qPtr == 3 {
+			bent := *quadNormalsPtr && !m.quadPlanar(&m.faces[i])
+			m.ConvertQuadToTriangles(&m.faces[i])
+			if bent {
+				m.FlattenFaceNormals(&m.faces[i])
+				m.FlattenFaceNormals(&m.faces[len(m.faces)-1])
+			}
+		} else if m.faces[i].edges == 4 && *qPtr > 0 {
+			err = m.ValidateQuad(&m.faces[i])
+			if err != nil {
+				// Keep the valid quads and convert only the invalid ones to triangles, -q 2
+				// warns about each one.
+				if *qPtr == 2 {
+					Logf(LOG_WARN, "Line %d: %v - converting to triangles.\n", m.faces[i].line, err)
+				} else {
+					Logf(LOG_VERBOSE, "Line %d: %v - converting to triangles.\n", m.faces[i].line, err)
+				}
+				bent := *quadNormalsPtr && !m.quadPlanar(&m.faces[i])
+				m.ConvertQuadToTriangles(&m.faces[i])
+				if bent {
+					m.FlattenFaceNormals(&m.faces[i])
+					m.FlattenFaceNormals(&m.faces[len(m.faces)-1])
+				}
+			} else {
+				Logf(LOG_DEBUG, "[ok]\n")
+			}
+		}
+
+		i++
+	}
+
+	// Process material names to index values.
+	if *materialOrderPtr != "" {
+		err = m.SortMaterials(*materialOrderPtr)
+		if err != nil {
+			return err
+		}
+	}
+	Logf(LOG_DEBUG, "Faces before mesh optimsation:\n")
+	for i := range m.faces {
+		m.faces[i].materialID = m.ResolveMaterial(m.faces[i].materialName)
+		Logf(LOG_DEBUG, "%v\n", m.faces[i])
+	}
+	if *flattenMaterialsPtr {
+		m.FlattenMaterials()
+	}
+	if *linearizePtr {
+		m.LinearizeMaterials()
+	}
+
+	// Apply any scaling before the bounds are generated.
+	var scale [3]float32 = [3]float32{float32(*scalePtr), float32(*scalePtr), float32(*scalePtr)}
+	if *scaleXYZPtr != "" {
+		axis, err := ParseVector3(*scaleXYZPtr)
+		if err != nil {
+			Logf(LOG_ERROR, "Error: Invalid -scalexyz value: %v\n", err)
+			return err
+		}
+		scale[0] *= axis[0]
+		scale[1] *= axis[1]
+		scale[2] *= axis[2]
+	}
+	m.meshUnit = m.fileUnit
+	if *fromUnitPtr != "" {
+		m.meshUnit = ParseUnit(*fromUnitPtr)
+		if m.meshUnit == UNIT_UNKNOWN {
+			Logf(LOG_ERROR, "Error: Unknown -from-unit %s.\n", *fromUnitPtr)
+			return errors.New("unknown from unit")
+		}
+	}
+	if *toUnitPtr != "" {
+		toUnit := ParseUnit(*toUnitPtr)
+		if toUnit == UNIT_UNKNOWN {
+			Logf(LOG_ERROR, "Error: Unknown -to-unit %s.\n", *toUnitPtr)
+			return errors.New("unknown to unit")
+		}
+		if m.meshUnit == UNIT_UNKNOWN {
+			Logf(LOG_ERROR, "Error: -to-unit requires -from-unit or a units comment in the OBJ file.\n")
+			return errors.New("no source unit")
+		}
+		var factor float32 = float32(unitMeters[m.meshUnit] / unitMeters[toUnit])
+		scale[0] *= factor
+		scale[1] *= factor
+		scale[2] *= factor
+		m.meshUnit = toUnit
+	}
+	if scale[0] == 0 || scale[1] == 0 || scale[2] == 0 {
+		Logf(LOG_ERROR, "Error: Scale factors must be non-zero.\n")
+		return errors.New("zero scale factor")
+	}
+	if scale != [3]float32{1, 1, 1} {
+		m.ScaleMesh(scale[0], scale[1], scale[2])
+	}
+
+	// Rotate the mesh onto its principal axes.
+	if *alignPCAPtr != "" {
+		var axis int = strings.Index("xyz", *alignPCAPtr)
+		if len(*alignPCAPtr) != 1 || axis < 0 {
+			Logf(LOG_ERROR, "Error: Invalid -align-pca axis %q, expected x, y or z.\n", *alignPCAPtr)
+			return errors.New("invalid align-pca axis")
+		}
+		err = m.AlignPCA(axis)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Move the mesh, the bounds are generated afterwards so they match the new position.
+	if *centerPtr {
+		m.CenterMesh()
+	}
+	if *centerBasePtr {
+		// After -yzup the mesh stands on the xy plane.
+		var up int = 1
+		if *yzUpPtr {
+			up = 2
+		}
+		m.CenterMeshToBase(up)
+	}
+	if *translatePtr != "" {
+		offset, err := ParseVector3(*translatePtr)
+		if err != nil {
+			Logf(LOG_ERROR, "Error: Invalid -translate value: %v\n", err)
+			return err
+		}
+		m.TranslateMesh(float64(offset[0]), float64(offset[1]), float64(offset[2]))
+	}
+
+	// Generate normals from the final positions, ahead of baking which uses them. Welding
+	// always regenerates them so the normals are smooth across the closed seams.
+	if *weldPtr > 0 {
+		m.WeldVertices(*weldPtr)
+	}
+	if *smoothPtr != "" {
+		lambda, iterations, _ := ParseSmooth(*smoothPtr)
+		err = m.SmoothMesh(lambda, iterations)
+		if err != nil {
+			return err
+		}
+	}
+	if *genNormalsPtr || *weldPtr > 0 || *smoothPtr != "" {
+		err = m.GenerateNormals(*creaseAnglePtr)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Project texture coords from the final positions.
+	if *genUVPtr != "" {
+		err = m.GenerateUVs(*genUVPtr)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Bake lighting into the vertex colours.
+	if len(bakeLights) > 0 {
+		var lights []DirectionalLight
+		for _, l := range bakeLights {
+			light, err := ParseDirectionalLight(l)
+			if err != nil {
+				Logf(LOG_ERROR, "Error: Invalid -bake-light value: %v\n", err)
+				return err
+			}
+			lights = append(lights, light)
+		}
+		err = m.BakeLighting(lights)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Generate the bounding volumes.
+	m.ProgressPhase("bounds")
+	if *noBoundsPtr {
+		m.vertexType |= NO_BOUND_SPHERE
+	} else {
+		m.GenerateBoundingSphere()
+	}
+	m.GenerateBoundingBox()
+
+	// If required, de-dupe vertices, uvs and normals
+	if *dPtr {
+		m.ProgressPhase("dedupe")
+		m.DeDupe(0.0001, *normalAnglePtr, 0.00001)
+	}
+	if *dedupeFacesPtr {
+		m.RemoveDuplicateFaces()
+	}
+
+	// Simplify once the split vertices have been merged, so texture seams do not count as
+	// boundaries. The bounds still hold as decimation only removes vertices.
+	if *decimatePtr > 0 {
+		m.ProgressPhase("decimate")
+		err = m.DecimateMesh(*decimatePtr)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Report any holes in the mesh.
+	if *holesPtr {
+		m.ReportHoles()
+	}
+
+	m.meshStats.strideBefore = m.StrideDistance()
+	Logf(LOG_INFO, "Total vertex stride distance:  %d\n", m.meshStats.strideBefore)
+	m.meshStats.acmrBefore = m.SimulateVertexCache(*maxCachePtr)
+	Logf(LOG_INFO, "Average cache miss ratio (%d entry FIFO): %.3f\n", *maxCachePtr, m.meshStats.acmrBefore)
+
+	// Optimize the mesh data.
+	if *moPtr {
+		Logf(LOG_DEBUG, "Faces after mesh optimsation:\n")
+		m.ProgressPhase("optimising")
+		m.OptimiseMesh(MORTON_RESOLUTION)
+		for i := range m.faces {
+			Logf(LOG_DEBUG, "%v\n", m.faces[i])
+		}
+	}
+
+	// Order the faces front to back for a known camera.
+	if *sortDepthPtr != "" {
+		camera, err := ParseKeyVectors(*sortDepthPtr)
+		if err != nil {
+			Logf(LOG_ERROR, "Error: Invalid -sort-depth value: %v\n", err)
+			return err
+		}
+		dir, ok := camera["dir"]
+		if !ok || (dir[0] == 0 && dir[1] == 0 && dir[2] == 0) {
+			Logf(LOG_ERROR, "Error: -sort-depth requires a non-zero dir.\n")
+			return errors.New("invalid sort-depth direction")
+		}
+		m.SortFacesByDepth(camera["cam"], dir)
+	}
+
+	// Draw one material at a time, the vertex splits refer to faces by index so progressive
+	// meshes keep their order.
+	if *groupMaterialsPtr {
+		if *progressivePtr > 0 {
+			Logf(LOG_WARN, "Warning: -group-materials is not supported with -progressive, keeping the face order.\n")
+		} else {
+			m.GroupFacesByMaterial()
+		}
+	}
+
+	m.meshStats.strideAfter = m.StrideDistance()
+	Logf(LOG_INFO, "Total vertex stride distance:  %d\n", m.meshStats.strideAfter)
+	m.meshStats.acmrAfter = m.SimulateVertexCache(*maxCachePtr)
+	Logf(LOG_INFO, "Average cache miss ratio (%d entry FIFO): %.3f\n", *maxCachePtr, m.meshStats.acmrAfter)
+
+	// The levels of detail are appended once the faces are in their final order, any material
+	// ranges describe the full detail faces only.
+	if m.objLOD > 0 && *lodsPtr == 0 {
+		Logf(LOG_INFO, "The OBJ file sets lod %d, use -lods to write levels of detail.\n", m.objLOD)
+	}
+	if *lodsPtr > 0 {
+		if *progressivePtr > 0 || *stripsPtr || *formatPtr != "mshx" {
+			Logf(LOG_WARN, "Warning: -lods is only supported for mshx output without -progressive or -triangulate-strip, no levels of detail are written.\n")
+		} else {
+			m.ProgressPhase("lods")
+			err = m.BuildLODs(*lodsPtr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Collapse the mesh down to a base mesh and record the vertex splits to refine it.
+	if *progressivePtr > 0 {
+		err = m.BuildProgressiveMesh(int(float64(len(m.faces)) * *progressivePtr))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Collapse to a single index stream where the attributes are per-vertex.
+	if *autoUnifyPtr {
+		if *progressivePtr > 0 {
+			Logf(LOG_WARN, "Warning: -auto-unify is not supported with -progressive, keeping separate index streams.\n")
+		} else {
+			m.UnifyIndices()
+		}
+	}
+
+	// Always use a single index stream, splitting vertices as needed.
+	if (*unifyPtr || *stripsPtr) && !*interleavePtr {
+		if *progressivePtr > 0 {
+			Logf(LOG_WARN, "Warning: -unify and -triangulate-strip are not supported with -progressive, keeping separate index streams.\n")
+		} else if m.indexType == INDEX_SEPARATE {
+			m.SplitVertices()
+		}
+	}
+
+	// Interleave the attributes into the vertex records, splitting vertices as needed.
+	if *interleavePtr {
+		if *progressivePtr > 0 {
+			Logf(LOG_WARN, "Warning: -interleave is not supported with -progressive, keeping separate index streams.\n")
+		} else if *formatPtr != "mshx" {
+			Logf(LOG_WARN, "Warning: -interleave only applies to mshx output.\n")
+		} else {
+			m.SplitVertices()
+			m.indexType = INDEX_INTERLEAVED
+		}
+	}
+
+	// Tangents are generated once the index layout is final, so they follow any vertex splits.
+	if *genTangentsPtr {
+		if *progressivePtr > 0 {
+			Logf(LOG_WARN, "Warning: -gentangents is not supported with -progressive, no tangents are written.\n")
+		} else {
+			err = m.GenerateTangents()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Replace the triangle list with strips.
+	if *stripsPtr && *progressivePtr == 0 {
+		if *formatPtr != "mshx" {
+			Logf(LOG_WARN, "Warning: -triangulate-strip only applies to mshx output.\n")
+		} else {
+			err = m.BuildTriangleStrips()
+			if err != nil {
+				return err
+			}
+			m.vertexType |= TRIANGLE_STRIPS
+		}
+	}
+
+	// Store the positions as 16-bit integers, only the MSHX format has a quantized form.
+	if *quantizePtr {
+		if *formatPtr != "mshx" {
+			Logf(LOG_WARN, "Warning: -quantize only applies to mshx output, writing float positions.\n")
+		} else {
+			m.QuantizePositions()
+		}
+	}
+
+	// Write the output file.
+	m.ProgressPhase("writing")
+	Logf(LOG_INFO, "Writing output file...\n")
+	if *formatPtr == "obj-canonical" {
+		err = m.WriteCanonicalOBJ(output)
+		if err != nil {
+			return err
+		}
+	} else if *formatPtr == "ply" || *formatPtr == "ply-binary" {
+		err = m.WritePLY(output, *formatPtr == "ply-binary")
+		if err != nil {
+			return err
+		}
+	} else {
+		err = m.WriteOutput(output)
+		if err != nil {
+			return err
+		}
+	}
+	err = closeOutput()
+	if err != nil {
+		return err
+	}
+	m.ProgressDone()
+	if *statsPtr {
+		m.PrintStats()
+	}
+	Logf(LOG_INFO, "Done.\n")
+	return nil
+}
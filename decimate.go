@@ -0,0 +1,297 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"errors"
+	"math"
+	"slices"
+)
+
+// Symmetric 4x4 error quadric of a vertex, stored as its upper triangle a², ab, ac, ad, b², bc,
+// bd, c², cd, d² for the planes ax+by+cz+d=0 of the faces around it.
+type quadric [10]float64
+
+func (q *quadric) addPlane(a, b, c, d, weight float64) {
+	q[0] += weight * a * a
+	q[1] += weight * a * b
+	q[2] += weight * a * c
+	q[3] += weight * a * d
+	q[4] += weight * b * b
+	q[5] += weight * b * c
+	q[6] += weight * b * d
+	q[7] += weight * c * c
+	q[8] += weight * c * d
+	q[9] += weight * d * d
+}
+
+func (q *quadric) add(o *quadric) {
+	for i := range q {
+		q[i] += o[i]
+	}
+}
+
+// Sum of the squared distances from the position to the planes of the quadric.
+func (q *quadric) error(v Vertex) float64 {
+	x, y, z := float64(v.X), float64(v.Y), float64(v.Z)
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z + q[9]
+}
+
+// A candidate collapse of vertex remove into vertex keep, valid while neither vertex has
+// changed since it was queued.
+type decimateCollapse struct {
+	keep, remove        uint32
+	cost                float64
+	keepStamp, remStamp uint32
+}
+
+type decimateHeap []decimateCollapse
+
+func (h decimateHeap) Len() int           { return len(h) }
+func (h decimateHeap) Less(i, j int) bool { return h[i].cost < h[j].cost }
+func (h decimateHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *decimateHeap) Push(x any)        { *h = append(*h, x.(decimateCollapse)) }
+func (h *decimateHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// Unnormalised normal of a triangle given as three vertex indices.
+func (m *Mesh) triangleNormal(a, b, c uint32) (float64, float64, float64) {
+	va, vb, vc := m.vertices[a], m.vertices[b], m.vertices[c]
+	return crossProduct(float64(vb.X-va.X), float64(vb.Y-va.Y), float64(vb.Z-va.Z), float64(vc.X-va.X), float64(vc.Y-va.Y), float64(vc.Z-va.Z))
+}
+
+// Reduce the triangle count to ratio of the original with quadric error edge collapses. Each
+// collapse merges one vertex into a neighbour which keeps its position, so the surviving face
+// corners keep their own normals and texture coords. Vertices on an open boundary, a non-manifold
+// edge, an edge between two materials or used by a line or point element are never removed,
+// and collapses which would fold a face over or make the surface non-manifold are skipped.
+func (m *Mesh) DecimateMesh(ratio float64) error {
+	originalFaces := len(m.faces)
+	collapses, err := m.collapseEdges(int(float64(originalFaces)*ratio), nil)
+	if err != nil {
+		Logf(LOG_ERROR, "Error: -decimate requires a triangle mesh, use -q 3 to convert quads.\n")
+		return err
+	}
+
+	Logf(LOG_INFO, "Decimated to %d of %d triangles (target %d) with %d edge collapses.\n", len(m.faces), originalFaces, int(float64(originalFaces)*ratio), collapses)
+
+	// Drop the vertices, normals and texture coords only the collapsed faces used.
+	m.PruneAttributes()
+	return nil
+}
+
+// Returned by collapseEdges for a mesh with faces other than triangles, the caller reports it
+// naming its own option.
+var errNotTriangles = errors.New("edge collapses require a triangle mesh")
+
+// Called after each collapse with the face corners moved from vertex remove to vertex keep as
+// face and corner index pairs, and the faces which the collapse removed. The faces are indexed
+// as they were before any collapse and the removed ones are left as they were.
+type collapseFunc func(keep, remove uint32, corners [][2]uint32, removed []uint32)
+
+// Collapse edges until there are at most target faces, leaving the vertex list as it is, and
+// return the number of collapses. Each collapse is passed to onCollapse if it is not nil.
+func (m *Mesh) collapseEdges(target int, onCollapse collapseFunc) (int, error) {
+	for i := range m.faces {
+		if m.faces[i].edges != 3 {
+			return 0, errNotTriangles
+		}
+	}
+	// Lock the vertices whose removal would move a boundary.
+	type edgeInfo struct {
+		count    int
+		material uint32
+		mixed    bool
+	}
+	edgeFaces := make(map[Edge]*edgeInfo)
+	for i := range m.faces {
+		for j := 0; j < 3; j++ {
+			e := MakeEdge(m.faces[i].v[j], m.faces[i].v[(j+1)%3])
+			info, ok := edgeFaces[e]
+			if !ok {
+				info = &edgeInfo{material: m.faces[i].materialID}
+				edgeFaces[e] = info
+			}
+			info.count++
+			if info.material != m.faces[i].materialID {
+				info.mixed = true
+			}
+		}
+	}
+	locked := make([]bool, len(m.vertices))
+	for e, info := range edgeFaces {
+		if info.count != 2 || info.mixed {
+			locked[e.a] = true
+			locked[e.b] = true
+		}
+	}
+	m.ForEachElementVertex(func(v uint32) { locked[v] = true })
+
+	quadrics := make([]quadric, len(m.vertices))
+	vertexFaces := make([][]uint32, len(m.vertices))
+	alive := make([]bool, len(m.faces))
+	for i := range m.faces {
+		alive[i] = true
+		f := &m.faces[i]
+		nx, ny, nz := m.triangleNormal(f.v[0], f.v[1], f.v[2])
+		length := math.Sqrt(dotProduct(nx, ny, nz, nx, ny, nz))
+		if length > 0 {
+			a, b, c := nx/length, ny/length, nz/length
+			p := m.vertices[f.v[0]]
+			d := -dotProduct(a, b, c, float64(p.X), float64(p.Y), float64(p.Z))
+			// Weight each plane by the face area so small slivers count for little.
+			for j := 0; j < 3; j++ {
+				quadrics[f.v[j]].addPlane(a, b, c, d, length/2)
+			}
+		}
+		for j := 0; j < 3; j++ {
+			vertexFaces[f.v[j]] = append(vertexFaces[f.v[j]], uint32(i))
+		}
+	}
+
+	stamps := make([]uint32, len(m.vertices))
+	removed := make([]bool, len(m.vertices))
+	queue := &decimateHeap{}
+	push := func(keep, remove uint32) {
+		if locked[remove] || keep == remove {
+			return
+		}
+		q := quadrics[keep]
+		q.add(&quadrics[remove])
+		heap.Push(queue, decimateCollapse{keep, remove, q.error(m.vertices[keep]), stamps[keep], stamps[remove]})
+	}
+	// Queue the edges in a fixed order rather than map order so equal costs collapse the same
+	// way on every run.
+	sortedEdges := make([]Edge, 0, len(edgeFaces))
+	for e := range edgeFaces {
+		sortedEdges = append(sortedEdges, e)
+	}
+	slices.SortFunc(sortedEdges, func(x, y Edge) int {
+		if x.a != y.a {
+			return cmp.Compare(x.a, y.a)
+		}
+		return cmp.Compare(x.b, y.b)
+	})
+	for _, e := range sortedEdges {
+		push(e.a, e.b)
+		push(e.b, e.a)
+	}
+
+	// The distinct vertices sharing an alive face with v.
+	neighbours := func(v uint32) []uint32 {
+		var result []uint32
+		for _, fi := range vertexFaces[v] {
+			if !alive[fi] {
+				continue
+			}
+			for _, w := range m.faces[fi].v {
+				if w != v && !slices.Contains(result, w) {
+					result = append(result, w)
+				}
+			}
+		}
+		return result
+	}
+
+	// Check the collapse keeps the surface manifold and does not turn any face over.
+	valid := func(keep, remove uint32) bool {
+		var opposite []uint32
+		for _, fi := range vertexFaces[remove] {
+			if !alive[fi] {
+				continue
+			}
+			f := &m.faces[fi]
+			if slices.Contains(f.v, keep) {
+				for _, w := range f.v {
+					if w != keep && w != remove {
+						opposite = append(opposite, w)
+					}
+				}
+				continue
+			}
+			var moved [3]uint32
+			for j := 0; j < 3; j++ {
+				moved[j] = f.v[j]
+				if moved[j] == remove {
+					moved[j] = keep
+				}
+			}
+			ax, ay, az := m.triangleNormal(f.v[0], f.v[1], f.v[2])
+			bx, by, bz := m.triangleNormal(moved[0], moved[1], moved[2])
+			if (bx == 0 && by == 0 && bz == 0) || dotProduct(ax, ay, az, bx, by, bz) <= 0 {
+				return false
+			}
+		}
+		// The link condition, the only neighbours the two vertices share are the corners
+		// opposite the edge.
+		keepNeighbours := neighbours(keep)
+		for _, w := range neighbours(remove) {
+			if w != keep && slices.Contains(keepNeighbours, w) && !slices.Contains(opposite, w) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var faceCount int = len(m.faces)
+	var collapses int = 0
+	for faceCount > target && queue.Len() > 0 {
+		c := heap.Pop(queue).(decimateCollapse)
+		if removed[c.keep] || removed[c.remove] || c.keepStamp != stamps[c.keep] || c.remStamp != stamps[c.remove] {
+			continue
+		}
+		if !valid(c.keep, c.remove) {
+			continue
+		}
+		var corners [][2]uint32
+		var removedFaces []uint32
+		for _, fi := range vertexFaces[c.remove] {
+			if !alive[fi] {
+				continue
+			}
+			f := &m.faces[fi]
+			if slices.Contains(f.v, c.keep) {
+				alive[fi] = false
+				faceCount--
+				removedFaces = append(removedFaces, fi)
+				continue
+			}
+			for j := 0; j < 3; j++ {
+				if f.v[j] == c.remove {
+					f.v[j] = c.keep
+					corners = append(corners, [2]uint32{fi, uint32(j)})
+				}
+			}
+			vertexFaces[c.keep] = append(vertexFaces[c.keep], fi)
+		}
+		if onCollapse != nil {
+			onCollapse(c.keep, c.remove, corners, removedFaces)
+		}
+		removed[c.remove] = true
+		quadrics[c.keep].add(&quadrics[c.remove])
+		stamps[c.keep]++
+		collapses++
+
+		// The cost of every edge around the kept vertex has changed.
+		for _, w := range neighbours(c.keep) {
+			push(c.keep, w)
+			push(w, c.keep)
+		}
+	}
+
+	// Drop the collapsed faces.
+	var newFaces []Face
+	for i := range m.faces {
+		if alive[i] {
+			newFaces = append(newFaces, m.faces[i])
+		}
+	}
+	m.faces = newFaces
+	return collapses, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// The grid of gridOBJ with a normal and a texture coord of its own on every vertex.
+func texturedGridOBJ(n int) string {
+	var b strings.Builder
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fmt.Fprintf(&b, "v %d %d %g\n", x, y, float64((x*7+y*3)%5)*0.1)
+			fmt.Fprintf(&b, "vn 0 0 1\n")
+			fmt.Fprintf(&b, "vt %g %g\n", float64(x)/float64(n), float64(y)/float64(n))
+		}
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			a := y*(n+1) + x + 1
+			fmt.Fprintf(&b, "f %d/%d/%d %d/%d/%d %d/%d/%d\n", a, a, a, a+1, a+1, a+1, a+n+2, a+n+2, a+n+2)
+			fmt.Fprintf(&b, "f %d/%d/%d %d/%d/%d %d/%d/%d\n", a, a, a, a+n+2, a+n+2, a+n+2, a+n+1, a+n+1, a+n+1)
+		}
+	}
+	return b.String()
+}
+
+func TestDecimateReachesTargetAndKeepsBoundary(t *testing.T) {
+	const n = 8
+	file := convertOBJ(t, texturedGridOBJ(n), "-decimate", "0.5")
+
+	if target := n * n; len(file.faces) > target || len(file.faces) == 0 {
+		t.Errorf("decimated to %d faces, want at most the target of %d", len(file.faces), target)
+	}
+
+	// Every vertex on the edge of the grid is still there.
+	boundary := make(map[[2]float32]bool)
+	for _, v := range file.vertices {
+		if v.X == 0 || v.X == n || v.Y == 0 || v.Y == n {
+			boundary[[2]float32{v.X, v.Y}] = true
+		}
+	}
+	if len(boundary) != 4*n {
+		t.Errorf("%d of the %d boundary vertices remain", len(boundary), 4*n)
+	}
+
+	// Nothing the collapsed faces alone used is written.
+	usedVertices, usedNormals, usedUVs := make(map[uint32]bool), make(map[uint32]bool), make(map[uint32]bool)
+	for _, f := range file.faces {
+		for j := range f.v {
+			usedVertices[f.v[j]] = true
+		}
+		for j := range f.n {
+			usedNormals[f.n[j]] = true
+		}
+		for j := range f.uv {
+			usedUVs[f.uv[j]] = true
+		}
+	}
+	if len(usedVertices) != len(file.vertices) {
+		t.Errorf("%d vertices written, only %d used", len(file.vertices), len(usedVertices))
+	}
+	if len(usedNormals) != len(file.normals) {
+		t.Errorf("%d normals written, only %d used", len(file.normals), len(usedNormals))
+	}
+	if len(usedUVs) != len(file.textureCoords) {
+		t.Errorf("%d texture coords written, only %d used", len(file.textureCoords), len(usedUVs))
+	}
+}
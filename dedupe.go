@@ -0,0 +1,468 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// Remove any vertices, normals, uvs and materials which are no longer referenced by a face,
+// line or point and rebase the indices to match.
+func (m *Mesh) PruneUnreferenced() {
+	m.PruneAttributes()
+
+	// Materials are referenced by name until after this point so only the table needs rebuilding.
+	usedMaterials := make(map[string]bool)
+	for i := range m.faces {
+		usedMaterials[m.faces[i].materialName] = true
+	}
+	var newMaterials []Material
+	m.materialMap = make(map[string]uint32)
+	for i := range m.materials {
+		if usedMaterials[m.materials[i].name] {
+			newMaterials = append(newMaterials, m.materials[i])
+			m.materialMap[m.materials[i].name] = uint32(len(newMaterials) - 1)
+		}
+	}
+	m.materials = newMaterials
+}
+
+// Remove any vertices, normals and uvs which are not referenced by a face, line or point and
+// rebase the indices to match.
+func (m *Mesh) PruneAttributes() {
+	vertexRemap := make([]int, len(m.vertices))
+	normalRemap := make([]int, len(m.normals))
+	uvRemap := make([]int, len(m.textureCoords))
+	for i := range m.faces {
+		for j := 0; j < len(m.faces[i].v); j++ {
+			vertexRemap[m.faces[i].v[j]] = 1
+		}
+		for j := 0; j < len(m.faces[i].n); j++ {
+			normalRemap[m.faces[i].n[j]] = 1
+		}
+		for j := 0; j < len(m.faces[i].uv); j++ {
+			uvRemap[m.faces[i].uv[j]] = 1
+		}
+	}
+	m.ForEachElementVertex(func(v uint32) { vertexRemap[v] = 1 })
+	m.ForEachElementUV(func(uv uint32) { uvRemap[uv] = 1 })
+
+	var newVertices []Vertex
+	for i := range m.vertices {
+		if vertexRemap[i] == 1 {
+			vertexRemap[i] = len(newVertices)
+			newVertices = append(newVertices, m.vertices[i])
+		}
+	}
+	var newNormals []Normal
+	for i := range m.normals {
+		if normalRemap[i] == 1 {
+			normalRemap[i] = len(newNormals)
+			newNormals = append(newNormals, m.normals[i])
+		}
+	}
+	var newTextureCoords []TextureCoord
+	for i := range m.textureCoords {
+		if uvRemap[i] == 1 {
+			uvRemap[i] = len(newTextureCoords)
+			newTextureCoords = append(newTextureCoords, m.textureCoords[i])
+		}
+	}
+
+	for i := range m.faces {
+		for j := 0; j < len(m.faces[i].v); j++ {
+			m.faces[i].v[j] = uint32(vertexRemap[m.faces[i].v[j]])
+		}
+		for j := 0; j < len(m.faces[i].n); j++ {
+			m.faces[i].n[j] = uint32(normalRemap[m.faces[i].n[j]])
+		}
+		for j := 0; j < len(m.faces[i].uv); j++ {
+			m.faces[i].uv[j] = uint32(uvRemap[m.faces[i].uv[j]])
+		}
+	}
+	m.RemapElements(func(v uint32) uint32 { return uint32(vertexRemap[v]) }, func(uv uint32) uint32 { return uint32(uvRemap[uv]) })
+
+	Logf(LOG_INFO, "Pruned %d unreferenced vertices, %d normals, %d texture coords.\n", len(m.vertices)-len(newVertices), len(m.normals)-len(newNormals), len(m.textureCoords)-len(newTextureCoords))
+	m.vertices = newVertices
+	m.normals = newNormals
+	m.textureCoords = newTextureCoords
+}
+
+// Find, for every element, the later elements which match it. Elements are bucketed into a
+// spatial hash with the given cell size so only neighbouring cells are compared, and the
+// comparisons are split across GOMAXPROCS goroutines. Each candidate list is in ascending order.
+func FindDuplicates(count int, key func(i int) [3]float64, cell float64, match func(i, j int) bool) [][]int {
+	buckets := make(map[[3]int64][]int)
+	cellOf := func(i int) [3]int64 {
+		// A zero cell size would divide by zero, so everything shares one cell instead.
+		if cell <= 0 {
+			return [3]int64{}
+		}
+		k := key(i)
+		return [3]int64{int64(math.Floor(k[0] / cell)), int64(math.Floor(k[1] / cell)), int64(math.Floor(k[2] / cell))}
+	}
+	for i := 0; i < count; i++ {
+		c := cellOf(i)
+		buckets[c] = append(buckets[c], i)
+	}
+
+	candidates := make([][]int, count)
+	ParallelChunks(count, func(_, start, end int) {
+		for i := start; i < end; i++ {
+			c := cellOf(i)
+			for dx := int64(-1); dx <= 1; dx++ {
+				for dy := int64(-1); dy <= 1; dy++ {
+					for dz := int64(-1); dz <= 1; dz++ {
+						for _, j := range buckets[[3]int64{c[0] + dx, c[1] + dy, c[2] + dz}] {
+							if j > i && match(i, j) {
+								candidates[i] = append(candidates[i], j)
+							}
+						}
+					}
+				}
+			}
+			slices.Sort(candidates[i])
+		}
+	})
+	return candidates
+}
+
+// Redirect each duplicate to the first element that matched it and return the new index of
+// every element once the duplicates are removed, along with the number of duplicates.
+func MergeDuplicates(candidates [][]int, flushed []bool, skip func(i int) bool) ([]uint32, int) {
+	var dupes int = 0
+	redirect := make([]int, len(candidates))
+	for i := range redirect {
+		redirect[i] = -1
+	}
+	for i := range candidates {
+		if skip(i) {
+			continue
+		}
+		for _, j := range candidates[i] {
+			if redirect[j] < 0 {
+				redirect[j] = i
+			}
+			// An element matched by several earlier ones is still only one duplicate.
+			if !flushed[j] {
+				flushed[j] = true
+				dupes++
+			}
+		}
+	}
+
+	remap := make([]uint32, len(candidates))
+	var next uint32 = 0
+	for i := range candidates {
+		if !flushed[i] {
+			remap[i] = next
+			next++
+		}
+	}
+	for i := range candidates {
+		if flushed[i] && redirect[i] >= 0 {
+			remap[i] = remap[redirect[i]]
+		}
+	}
+	return remap, dupes
+}
+
+// Merge vertices closer than vT, normals less than normalAngle degrees apart and texture coords
+// whose components all differ by less than uvT.
+func (m *Mesh) DeDupe(vT, normalAngle, uvT float64) {
+
+	// Vertices
+	vertexFlushed := make([]bool, len(m.vertices))
+	for i := range m.vertices {
+		vertexFlushed[i] = m.vertices[i].flushed
+	}
+	candidates := FindDuplicates(len(m.vertices), func(i int) [3]float64 {
+		return m.vertices[i].position()
+	}, vT, func(i, j int) bool {
+		// Coincident vertices with their own colour or motion are kept apart.
+		a, b := &m.vertices[i], &m.vertices[j]
+		if a.W != b.W || a.A != b.A || a.R != b.R || a.G != b.G || a.B != b.B || a.velocity != b.velocity {
+			return false
+		}
+		if *precisePtr {
+			return PreciseDistance(*a, *b) < vT
+		}
+		dx := a.X - b.X
+		dy := a.Y - b.Y
+		dz := a.Z - b.Z
+		return math.Sqrt(float64(dx*dx+dy*dy+dz*dz)) < vT
+	})
+	vertexRemap, dupeV := MergeDuplicates(candidates, vertexFlushed, func(i int) bool {
+		return vertexFlushed[i]
+	})
+
+	// Normals
+	normalFlushed := make([]bool, len(m.normals))
+	for i := range m.normals {
+		normalFlushed[i] = m.normals[i].flushed
+	}
+	// Normals are unit length, so ones within the angle are within its chord of each other.
+	cosLimit := math.Cos(normalAngle * math.Pi / 180)
+	chord := math.Max(2*math.Sin(normalAngle*math.Pi/360), 1e-9)
+	candidates = FindDuplicates(len(m.normals), func(i int) [3]float64 {
+		return [3]float64{float64(m.normals[i].X), float64(m.normals[i].Y), float64(m.normals[i].Z)}
+	}, chord, func(i, j int) bool {
+		ax, ay, az := float64(m.normals[i].X), float64(m.normals[i].Y), float64(m.normals[i].Z)
+		bx, by, bz := float64(m.normals[j].X), float64(m.normals[j].Y), float64(m.normals[j].Z)
+		length := math.Sqrt(dotProduct(ax, ay, az, ax, ay, az) * dotProduct(bx, by, bz, bx, by, bz))
+		return length > 0 && dotProduct(ax, ay, az, bx, by, bz)/length >= cosLimit
+	})
+	normalRemap, dupeN := MergeDuplicates(candidates, normalFlushed, func(i int) bool {
+		return normalFlushed[i]
+	})
+
+	// UVS
+	uvFlushed := make([]bool, len(m.textureCoords))
+	for i := range m.textureCoords {
+		uvFlushed[i] = m.textureCoords[i].flushed
+	}
+	candidates = FindDuplicates(len(m.textureCoords), func(i int) [3]float64 {
+		return [3]float64{float64(m.textureCoords[i].U), float64(m.textureCoords[i].V), float64(m.textureCoords[i].W)}
+	}, uvT, func(i, j int) bool {
+		du := math.Abs(float64(m.textureCoords[i].U - m.textureCoords[j].U))
+		dv := math.Abs(float64(m.textureCoords[i].V - m.textureCoords[j].V))
+		dw := math.Abs(float64(m.textureCoords[i].W - m.textureCoords[j].W))
+		return du < uvT && dv < uvT && dw < uvT
+	})
+	uvRemap, dupeU := MergeDuplicates(candidates, uvFlushed, func(i int) bool {
+		return uvFlushed[i]
+	})
+
+	// Remap the faces and remove the duplicates
+	for i := range m.faces {
+		for j := range m.faces[i].v {
+			m.faces[i].v[j] = vertexRemap[m.faces[i].v[j]]
+		}
+		for j := range m.faces[i].n {
+			m.faces[i].n[j] = normalRemap[m.faces[i].n[j]]
+		}
+		for j := range m.faces[i].uv {
+			m.faces[i].uv[j] = uvRemap[m.faces[i].uv[j]]
+		}
+	}
+	m.RemapElements(func(v uint32) uint32 { return vertexRemap[v] }, func(uv uint32) uint32 { return uvRemap[uv] })
+	var newVertices []Vertex
+	for i := range m.vertices {
+		if !vertexFlushed[i] {
+			newVertices = append(newVertices, m.vertices[i])
+		}
+	}
+	m.vertices = newVertices
+	var newNormals []Normal
+	for i := range m.normals {
+		if !normalFlushed[i] {
+			newNormals = append(newNormals, m.normals[i])
+		}
+	}
+	m.normals = newNormals
+	var newTextureCoords []TextureCoord
+	for i := range m.textureCoords {
+		if !uvFlushed[i] {
+			newTextureCoords = append(newTextureCoords, m.textureCoords[i])
+		}
+	}
+	m.textureCoords = newTextureCoords
+
+	Logf(LOG_INFO, "Removed %d duplicate vertices.\n", dupeV)
+	Logf(LOG_INFO, "Removed %d duplicate normals.\n", dupeN)
+	Logf(LOG_INFO, "Removed %d duplicate texture coords.\n", dupeU)
+	m.meshStats.duplicateVertices = dupeV
+	m.meshStats.duplicateNormals = dupeN
+	m.meshStats.duplicateUVs = dupeU
+
+}
+
+// Merge vertices closer than tolerance by position alone, unlike DeDupe which leaves vertices
+// with different normals apart, so seams close up once the normals are regenerated.
+func (m *Mesh) WeldVertices(tolerance float64) {
+	flushed := make([]bool, len(m.vertices))
+	candidates := FindDuplicates(len(m.vertices), func(i int) [3]float64 {
+		return m.vertices[i].position()
+	}, tolerance, func(i, j int) bool {
+		if *precisePtr {
+			return PreciseDistance(m.vertices[i], m.vertices[j]) < tolerance
+		}
+		return Distance(m.vertices[i], m.vertices[j]) < tolerance
+	})
+	remap, _ := MergeDuplicates(candidates, flushed, func(i int) bool {
+		return flushed[i]
+	})
+	for i := range m.faces {
+		for j := range m.faces[i].v {
+			m.faces[i].v[j] = remap[m.faces[i].v[j]]
+		}
+	}
+	m.RemapElements(func(v uint32) uint32 { return remap[v] }, nil)
+	var newVertices []Vertex
+	for i := range m.vertices {
+		if !flushed[i] {
+			newVertices = append(newVertices, m.vertices[i])
+		}
+	}
+	Logf(LOG_INFO, "Welded %d vertices into %d.\n", len(m.vertices), len(newVertices))
+	m.vertices = newVertices
+}
+
+// If every vertex is always used with the same normal and texture coord then the attributes are
+// really per-vertex, so reorder them to match the vertices and use the vertex index for all three.
+func (m *Mesh) UnifyIndices() bool {
+	normalOf := make([]int64, len(m.vertices))
+	uvOf := make([]int64, len(m.vertices))
+	for i := range m.vertices {
+		normalOf[i] = -1
+		uvOf[i] = -1
+	}
+	for i := range m.faces {
+		for j := 0; j < int(m.faces[i].edges); j++ {
+			vidx := m.faces[i].v[j]
+			if len(m.faces[i].n) > 0 {
+				if normalOf[vidx] >= 0 && normalOf[vidx] != int64(m.faces[i].n[j]) {
+					Logf(LOG_INFO, "Vertex %d has more than one normal, keeping separate index streams.\n", vidx)
+					return false
+				}
+				normalOf[vidx] = int64(m.faces[i].n[j])
+			}
+			if len(m.faces[i].uv) > 0 {
+				if uvOf[vidx] >= 0 && uvOf[vidx] != int64(m.faces[i].uv[j]) {
+					Logf(LOG_INFO, "Vertex %d has more than one texture coord, keeping separate index streams.\n", vidx)
+					return false
+				}
+				uvOf[vidx] = int64(m.faces[i].uv[j])
+			}
+		}
+	}
+	for i := range m.polylines {
+		for j, uv := range m.polylines[i].uv {
+			vidx := m.polylines[i].v[j]
+			if uvOf[vidx] >= 0 && uvOf[vidx] != int64(uv) {
+				Logf(LOG_INFO, "Vertex %d has more than one texture coord, keeping separate index streams.\n", vidx)
+				return false
+			}
+			uvOf[vidx] = int64(uv)
+		}
+	}
+
+	if len(m.normals) > 0 {
+		newNormals := make([]Normal, len(m.vertices))
+		for i := range m.vertices {
+			if normalOf[i] >= 0 {
+				newNormals[i] = m.normals[normalOf[i]]
+			}
+		}
+		m.normals = newNormals
+	}
+	if len(m.textureCoords) > 0 {
+		newTextureCoords := make([]TextureCoord, len(m.vertices))
+		for i := range m.vertices {
+			if uvOf[i] >= 0 {
+				newTextureCoords[i] = m.textureCoords[uvOf[i]]
+			}
+		}
+		m.textureCoords = newTextureCoords
+	}
+	for i := range m.faces {
+		if len(m.faces[i].n) > 0 {
+			copy(m.faces[i].n, m.faces[i].v)
+		}
+		if len(m.faces[i].uv) > 0 {
+			copy(m.faces[i].uv, m.faces[i].v)
+		}
+	}
+	for i := range m.polylines {
+		copy(m.polylines[i].uv, m.polylines[i].v)
+	}
+	m.indexType = 1
+	Logf(LOG_INFO, "Unified vertex, normal and texture coord indices.\n")
+	return true
+}
+
+// Give every unique combination of vertex, normal and texture coord its own vertex so a single
+// index addresses all three, the normals and texture coords become per-vertex. A position used
+// with several normals or texture coords is duplicated once for each, so the vertex count grows.
+func (m *Mesh) SplitVertices() {
+	type corner struct {
+		v, n, uv uint32
+	}
+	const none uint32 = math.MaxUint32
+	var hasNormals bool = len(m.normals) > 0
+	var hasUVs bool = len(m.textureCoords) > 0
+	index := make(map[corner]uint32)
+	var newVertices []Vertex
+	var newNormals []Normal
+	var newTextureCoords []TextureCoord
+	add := func(c corner) uint32 {
+		if idx, ok := index[c]; ok {
+			return idx
+		}
+		idx := uint32(len(newVertices))
+		index[c] = idx
+		newVertices = append(newVertices, m.vertices[c.v])
+		// Line and point elements have no normal, their vertices get a zero normal.
+		if hasNormals {
+			var n Normal
+			if c.n != none {
+				n = m.normals[c.n]
+			}
+			newNormals = append(newNormals, n)
+		}
+		if hasUVs {
+			var uv TextureCoord
+			if c.uv != none {
+				uv = m.textureCoords[c.uv]
+			}
+			newTextureCoords = append(newTextureCoords, uv)
+		}
+		return idx
+	}
+
+	for i := range m.faces {
+		f := &m.faces[i]
+		for j := 0; j < int(f.edges); j++ {
+			c := corner{f.v[j], none, none}
+			if len(f.n) > 0 {
+				c.n = f.n[j]
+			}
+			if len(f.uv) > 0 {
+				c.uv = f.uv[j]
+			}
+			idx := add(c)
+			f.v[j] = idx
+			if len(f.n) > 0 {
+				f.n[j] = idx
+			}
+			if len(f.uv) > 0 {
+				f.uv[j] = idx
+			}
+		}
+	}
+	for i := range m.polylines {
+		l := &m.polylines[i]
+		for j := range l.v {
+			c := corner{l.v[j], none, none}
+			if len(l.uv) > 0 {
+				c.uv = l.uv[j]
+			}
+			l.v[j] = add(c)
+			if len(l.uv) > 0 {
+				l.uv[j] = l.v[j]
+			}
+		}
+	}
+	for i := range m.points {
+		m.points[i].v = add(corner{m.points[i].v, none, none})
+	}
+
+	Logf(LOG_INFO, "Split %d vertices into %d unique vertex, normal and texture coord combinations.\n", len(m.vertices), len(newVertices))
+	m.vertices = newVertices
+	if hasNormals {
+		m.normals = newNormals
+	}
+	if hasUVs {
+		m.textureCoords = newTextureCoords
+	}
+	m.indexType = 1
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A polyline from an OBJ 'l' element, uv is empty when the corners have no texture coords.
+type Polyline struct {
+	v          []uint32
+	uv         []uint32
+	objectName string
+	line       int
+}
+
+// A single vertex from an OBJ 'p' element.
+type Point struct {
+	v          uint32
+	objectName string
+	line       int
+}
+
+// Parse an OBJ element index, a negative index counts back from the last of the count entries
+// defined so far.
+func ParseElementIndex(value string, count int) (uint32, error) {
+	idx, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if idx < 0 {
+		return uint32(count + idx), nil
+	}
+	return uint32(idx) - 1, nil
+}
+
+// Parse an 'l v1/vt1 v2/vt2 ...' line, the same index format as a face without normals.
+// vertexCount and uvCount are the vertices and texture coords defined before the line.
+func ParseLineElement(line string, lineParts []string, lineNumber int, vertexCount, uvCount int) (Polyline, error) {
+	var polyline Polyline
+	if len(lineParts) < 3 {
+		Logf(LOG_ERROR, "Error: Line element on line %d has fewer than 2 vertices.\n", lineNumber)
+		return polyline, fmt.Errorf("line element on line %d is too short", lineNumber)
+	}
+	for i := 1; i < len(lineParts); i++ {
+		vertParts := strings.Split(lineParts[i], "/")
+		if len(vertParts) > 2 {
+			return polyline, errors.New("invalid vertex index format on line element")
+		}
+		idx, err := ParseElementIndex(vertParts[0], vertexCount)
+		if err != nil {
+			return polyline, fmt.Errorf("invalid vertex index: %v", err)
+		}
+		polyline.v = append(polyline.v, idx)
+		if len(vertParts) == 2 && vertParts[1] != "" {
+			idx, err := ParseElementIndex(vertParts[1], uvCount)
+			if err != nil {
+				return polyline, fmt.Errorf("invalid texture index: %v", err)
+			}
+			polyline.uv = append(polyline.uv, idx)
+		}
+	}
+	if len(polyline.uv) != 0 && len(polyline.uv) != len(polyline.v) {
+		Logf(LOG_ERROR, "Error: Line element on line %d mixes corners with and without texture coords: %s\n", lineNumber, line)
+		return polyline, fmt.Errorf("inconsistent line element format on line %d", lineNumber)
+	}
+	polyline.line = lineNumber
+	return polyline, nil
+}
+
+// Parse a 'p v1 v2 ...' line into one point per vertex, vertexCount is the vertices defined
+// before the line.
+func ParsePointElement(line string, lineParts []string, lineNumber int, vertexCount int) ([]Point, error) {
+	var result []Point
+	for i := 1; i < len(lineParts); i++ {
+		idx, err := ParseElementIndex(lineParts[i], vertexCount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid point index on line %d: %v", lineNumber, err)
+		}
+		result = append(result, Point{v: idx, line: lineNumber})
+	}
+	return result, nil
+}
+
+// Check every line and point index refers to an entry that exists in the parsed data.
+func (m *Mesh) ValidateElementIndices() error {
+	for i := range m.polylines {
+		for _, idx := range m.polylines[i].v {
+			if idx >= uint32(len(m.vertices)) {
+				Logf(LOG_ERROR, "Error: Line element on line %d references vertex %d, but only %d are defined.\n", m.polylines[i].line, int32(idx)+1, len(m.vertices))
+				return fmt.Errorf("line element on line %d has out of range vertex index", m.polylines[i].line)
+			}
+		}
+		for _, idx := range m.polylines[i].uv {
+			if idx >= uint32(len(m.textureCoords)) {
+				Logf(LOG_ERROR, "Error: Line element on line %d references texture coord %d, but only %d are defined.\n", m.polylines[i].line, int32(idx)+1, len(m.textureCoords))
+				return fmt.Errorf("line element on line %d has out of range texture coord index", m.polylines[i].line)
+			}
+		}
+	}
+	for i := range m.points {
+		if m.points[i].v >= uint32(len(m.vertices)) {
+			Logf(LOG_ERROR, "Error: Point element on line %d references vertex %d, but only %d are defined.\n", m.points[i].line, int32(m.points[i].v)+1, len(m.vertices))
+			return fmt.Errorf("point element on line %d has out of range vertex index", m.points[i].line)
+		}
+	}
+	return nil
+}
+
+// Keep only the line and point elements belonging to one of the named objects.
+func (m *Mesh) FilterElements(names []string) {
+	m.polylines = slices.DeleteFunc(m.polylines, func(l Polyline) bool {
+		return !slices.Contains(names, l.objectName)
+	})
+	m.points = slices.DeleteFunc(m.points, func(p Point) bool {
+		return !slices.Contains(names, p.objectName)
+	})
+}
+
+// Call fn for every vertex index used by a line or point element.
+func (m *Mesh) ForEachElementVertex(fn func(v uint32)) {
+	for i := range m.polylines {
+		for _, v := range m.polylines[i].v {
+			fn(v)
+		}
+	}
+	for i := range m.points {
+		fn(m.points[i].v)
+	}
+}
+
+// Call fn for every texture coord index used by a line element.
+func (m *Mesh) ForEachElementUV(fn func(uv uint32)) {
+	for i := range m.polylines {
+		for _, uv := range m.polylines[i].uv {
+			fn(uv)
+		}
+	}
+}
+
+// Rewrite the line and point indices after the vertices or texture coords have been reordered,
+// a nil remap leaves those indices unchanged.
+func (m *Mesh) RemapElements(vertexRemap func(v uint32) uint32, uvRemap func(uv uint32) uint32) {
+	for i := range m.polylines {
+		for j := range m.polylines[i].v {
+			if vertexRemap != nil {
+				m.polylines[i].v[j] = vertexRemap(m.polylines[i].v[j])
+			}
+		}
+		for j := range m.polylines[i].uv {
+			if uvRemap != nil {
+				m.polylines[i].uv[j] = uvRemap(m.polylines[i].uv[j])
+			}
+		}
+	}
+	if vertexRemap != nil {
+		for i := range m.points {
+			m.points[i].v = vertexRemap(m.points[i].v)
+		}
+	}
+}
+
+func (m *Mesh) writePolyline(writer *bufio.Writer, byteOrder binary.ByteOrder, l *Polyline) {
+	var hasUV uint8 = 0
+	if len(l.uv) > 0 && m.indexType == 0 {
+		hasUV = 1
+	}
+	binary.Write(writer, byteOrder, uint32(len(l.v)))
+	binary.Write(writer, byteOrder, hasUV)
+	binary.Write(writer, byteOrder, l.v)
+	if hasUV != 0 {
+		binary.Write(writer, byteOrder, l.uv)
+	}
+}
+
+func writePoint(writer *bufio.Writer, byteOrder binary.ByteOrder, p *Point) {
+	binary.Write(writer, byteOrder, p.v)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// Characters of Windows-1252 bytes 0x80 - 0x9F, the five bytes it leaves undefined map to the
+// C1 control with the same value as Latin-1 does. Bytes from 0xA0 are the same in both.
+var windows1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// Converts a single byte encoding to UTF-8 as it is read.
+type decodingReader struct {
+	r       io.Reader
+	cp1252  bool
+	raw     [4096]byte
+	decoded []byte
+	pending []byte
+	err     error
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		var n int
+		n, d.err = d.r.Read(d.raw[:])
+		d.decoded = d.decoded[:0]
+		for _, b := range d.raw[:n] {
+			if b < 0x80 {
+				d.decoded = append(d.decoded, b)
+			} else if d.cp1252 && b < 0xA0 {
+				d.decoded = utf8.AppendRune(d.decoded, windows1252[b-0x80])
+			} else {
+				d.decoded = utf8.AppendRune(d.decoded, rune(b))
+			}
+		}
+		d.pending = d.decoded
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// Convert the input to UTF-8 from the -encoding given, UTF-8 input is passed through as it is.
+func DecodeInput(r io.Reader) io.Reader {
+	switch *encodingPtr {
+	case "latin1":
+		return &decodingReader{r: r}
+	case "windows-1252":
+		return &decodingReader{r: r, cp1252: true}
+	}
+	return r
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var dPtr *bool
+var precisePtr *bool
+var keepUnusedPtr *bool
+var moPtr *bool
+var qPtr *int
+var lePtr *bool
+var bePtr *bool
+var silentPtr *bool
+var vPtr *bool
+var vvPtr *bool
+var objectsPtr *string
+var progressivePtr *float64
+var scalePtr *float64
+var scaleXYZPtr *string
+var bakeLights stringList
+var sanitizeNamesPtr *bool
+var centerPtr *bool
+var centerBasePtr *bool
+var alignPCAPtr *string
+var formatPtr *string
+var outDirPtr *string
+var batchPtr *string
+var spherePtr *string
+var clampIndicesPtr *string
+var autoUnifyPtr *bool
+var fromUnitPtr *string
+var holesPtr *bool
+var sortDepthPtr *string
+var pose2Ptr *string
+var streamPtr *bool
+var progressPtr *bool
+var validatePtr *bool
+var statsPtr *bool
+var flipWindingPtr *bool
+var yzUpPtr *bool
+var genNormalsPtr *bool
+var creaseAnglePtr *float64
+var normalAnglePtr *float64
+var dedupeFacesPtr *bool
+var materialOrderPtr *string
+var planarTolPtr *float64
+var noConvexPtr *bool
+var weldPtr *float64
+var groupMaterialsPtr *bool
+var quantizePtr *bool
+var noBoundsPtr *bool
+var maxCachePtr *int
+var maxLinePtr *int
+var interleavePtr *bool
+var unifyPtr *bool
+var stripsPtr *bool
+var linearizePtr *bool
+var genTangentsPtr *bool
+var quadNormalsPtr *bool
+var decimatePtr *float64
+var lodsPtr *int
+var genUVPtr *string
+var encodingPtr *string
+var smoothPtr *string
+var flattenMaterialsPtr *bool
+var gzOutPtr *bool
+var toUnitPtr *string
+var translatePtr *string
+
+// The flags of the convert subcommand.
+var convertFlags *flag.FlagSet
+
+// Define the flags of the convert subcommand on a new flag set.
+func DefineFlags() {
+	convertFlags = flag.NewFlagSet("convert", flag.ExitOnError)
+	defineMessageFlags(convertFlags)
+	defineReadFlags(convertFlags)
+	defineQuadFlags(convertFlags)
+	lePtr = convertFlags.Bool("le", false, "Output data as little endian")
+	bePtr = convertFlags.Bool("be", false, "Output data as big endian")
+	moPtr = convertFlags.Bool("mo", false, "Optimise mesh data")
+	maxCachePtr = convertFlags.Int("maxcache", 32, "Number of entries in the simulated FIFO vertex cache used to report the average cache miss ratio")
+	dPtr = convertFlags.Bool("d", false, "Remove duplicate vertices/normals/uvs")
+	precisePtr = convertFlags.Bool("precise", false, "Keep positions in double precision while converting and round them to float only when writing, for meshes far from the origin")
+	keepUnusedPtr = convertFlags.Bool("keepunused", false, "Keep vertices, normals and uvs which no face, line or point refers to instead of removing them")
+	sanitizeNamesPtr = convertFlags.Bool("sanitize-names", false, "Replace characters in material names which are not letters, digits, '-', '_' or '.' with '_'")
+	objectsPtr = convertFlags.String("objects", "", "Comma separated list of object/group names to export, all objects are exported if empty")
+	scalePtr = convertFlags.Float64("scale", 1.0, "Uniformly scale all vertex positions by this factor")
+	scaleXYZPtr = convertFlags.String("scalexyz", "", "Scale vertex positions per axis as x,y,z, applied after -scale")
+	alignPCAPtr = convertFlags.String("align-pca", "", "Rotate the mesh about its centroid so its principal axis lies along x, y or z")
+	centerPtr = convertFlags.Bool("center", false, "Move the centre of the mesh bounding box to the origin")
+	centerBasePtr = convertFlags.Bool("center-origin-to-base", false, "Move the mesh so its lowest point is at y=0 (z=0 with -yzup) and its bounding box is centred on the other axes, for a pivot at the base")
+	translatePtr = convertFlags.String("translate", "", "Offset all vertex positions by x,y,z, applied after -center")
+	convertFlags.Var(&bakeLights, "bake-light", "Bake a directional light into the vertex colours as \"dir=x,y,z color=r,g,b\", may be repeated")
+	decimatePtr = convertFlags.Float64("decimate", 0, "Reduce the triangle count to this fraction of the original with quadric error edge collapses, keeping open and material boundaries [0.0 - 1.0], 0=disabled")
+	lodsPtr = convertFlags.Int("lods", 0, "Append this many levels of detail after the faces, each with half the triangles of the one before, and write a table of their face ranges and switch distances")
+	progressivePtr = convertFlags.Float64("progressive", 0, "Output a progressive mesh whose base mesh is decimated as with -decimate to this fraction of the original faces, keeping open and material boundaries [0.0 - 1.0], 0=disabled")
+	qPtr = convertFlags.Int("q", 0, "0=No quad validation, 1=Validate quad faces, keep the valid quads and convert the non-planar or concave ones to triangles, 2=As 1 and warn about each quad converted, 3=Convert all quad faces to triangles")
+	quadNormalsPtr = convertFlags.Bool("quadnormals", false, "Give each triangle of a non-planar quad split by -q 1, 2 or 3 a flat normal from its own geometry instead of the quad's corner normals")
+	flipWindingPtr = convertFlags.Bool("flipwinding", false, "Reverse the corner order of every face and flip the normals to match")
+	yzUpPtr = convertFlags.Bool("yzup", false, "Convert a Y-up mesh to Z-up by rotating 90 degrees about the x axis")
+	weldPtr = convertFlags.Float64("weld", 0, "Merge vertices closer than this distance whatever their normals and texture coords, then regenerate the normals as with -gennormals. Runs before -d and -mo, so -mo orders the welded mesh, 0=disabled")
+	smoothPtr = convertFlags.String("smooth", "", "Laplacian smoothing as \"lambda,iterations\", each iteration moves the vertices lambda of the way to the average of their neighbours, keeping boundary vertices, then regenerates the normals")
+	genNormalsPtr = convertFlags.Bool("gennormals", false, "Replace the normals with ones generated from the faces, split along edges sharper than -creaseangle")
+	genUVPtr = convertFlags.String("genuv", "", "Generate texture coords over the bounding box for a mesh without any: planar or box projection")
+	genTangentsPtr = convertFlags.Bool("gentangents", false, "Generate a tangent and bitangent for each face corner from the normals and texture coords")
+	normalAnglePtr = convertFlags.Float64("normalangle", 0.001, "Angle in degrees below which -d merges two normals")
+	creaseAnglePtr = convertFlags.Float64("creaseangle", 30, "Angle in degrees between faces above which -gennormals keeps a hard edge")
+	dedupeFacesPtr = convertFlags.Bool("dedupe-faces", false, "Remove faces using the same vertices in the same winding as another face, runs after -d")
+	quantizePtr = convertFlags.Bool("quantize", false, "Store positions as 16-bit integers normalized over the bounding box of the vertices, with the scale and bias in the header")
+	groupMaterialsPtr = convertFlags.Bool("group-materials", false, "Stable sort the faces by material after -mo and -sort-depth and write a table of the face range for each material")
+	flattenMaterialsPtr = convertFlags.Bool("flatten-materials", false, "Draw every face with the first material used by a face, leaving a single material, so per-material colours and textures are lost")
+	linearizePtr = convertFlags.Bool("linearize", false, "Convert the diffuse, specular, ambient and emissive material colours from sRGB to linear")
+	materialOrderPtr = convertFlags.String("material-order", "", "Order of the materials: empty for the order they are defined in, name to sort by name with used materials first, or a file listing one material name per line")
+	statsPtr = convertFlags.Bool("stats", false, "Print a summary of the converted mesh as key=value lines")
+	validatePtr = convertFlags.Bool("validate", false, "Deprecated, use objconv validate. Only check the OBJ file for problems as the validate subcommand does, no output file is written")
+	streamPtr = convertFlags.Bool("stream", false, "Convert in several passes over the OBJ file without holding the mesh in memory. Every element is written as read, unused ones included as with -keepunused, and the bounding sphere is looser. Only output options such as -le, -be and -silent may be combined with it")
+	pose2Ptr = convertFlags.String("pose2", "", "Second pose OBJ with the same vertices, the per-vertex position deltas are stored as velocities")
+	sortDepthPtr = convertFlags.String("sort-depth", "", "Sort faces front to back for a camera given as \"cam=x,y,z dir=x,y,z\"")
+	holesPtr = convertFlags.Bool("holes", false, "Check the mesh is watertight and report any hole boundaries, use with -d for meshes with split vertices")
+	fromUnitPtr = convertFlags.String("from-unit", "", "Unit of the OBJ positions (mm, cm, m, inch, foot), defaults to a '# units = ' comment in the OBJ")
+	toUnitPtr = convertFlags.String("to-unit", "", "Unit to convert the positions to (mm, cm, m, inch, foot)")
+	stripsPtr = convertFlags.Bool("triangulate-strip", false, "Write the faces as triangle strips, the faces must be triangles (use -q 3) and a single index stream is used as with -unify")
+	unifyPtr = convertFlags.Bool("unify", false, "Use a single index stream, splitting vertices used with more than one normal or texture coord")
+	interleavePtr = convertFlags.Bool("interleave", false, "Write one vertex record per unique position, normal and texture coord combination with the normal and texture coord inline, and a single index per face corner")
+	autoUnifyPtr = convertFlags.Bool("auto-unify", false, "Use a single index stream when every vertex always has the same normal and texture coord")
+	clampIndicesPtr = convertFlags.String("clamp-indices", "error", "Handling of out of range face indices: error, clamp, wrap or drop (drop the face)")
+	noBoundsPtr = convertFlags.Bool("nobounds", false, "Skip the bounding sphere, its header fields are written as zero and flagged as absent")
+	spherePtr = convertFlags.String("sphere", "ritter", "Bounding sphere algorithm: ritter (fast) or welzl (exact minimum)")
+	gzOutPtr = convertFlags.Bool("gzout", false, "Compress the output file with gzip, inspect and the MSHX reader decompress it transparently")
+	outDirPtr = convertFlags.String("outdir", "", "Name the output after the first input file and write it to this directory, every argument is then an input file")
+	batchPtr = convertFlags.String("batch", "", "Convert every file matching this glob pattern on its own, naming the outputs after the inputs, in -outdir if given")
+	formatPtr = convertFlags.String("format", "mshx", "Output format: mshx, obj-canonical (sorted fixed precision OBJ for version control), ply or ply-binary")
+}
+
+// The flags for the messages printed, shared by the convert and validate subcommands.
+func defineMessageFlags(flags *flag.FlagSet) {
+	silentPtr = flags.Bool("silent", false, "Do not output any messages other than errors")
+	vPtr = flags.Bool("v", false, "Print per-element detail such as material properties")
+	vvPtr = flags.Bool("vv", false, "Print every parsed element and face, implies -v")
+	progressPtr = flags.Bool("progress", false, "Show a periodically updated status line while converting")
+}
+
+// The flags for reading OBJ and MTL files, shared by the convert and validate subcommands.
+func defineReadFlags(flags *flag.FlagSet) {
+	encodingPtr = flags.String("encoding", "utf-8", "Character encoding of the OBJ and MTL files: utf-8, latin1 or windows-1252, converted to UTF-8 for names and texture paths")
+	maxLinePtr = flags.Int("maxline", 64, "Longest line accepted in OBJ and MTL files in MiB, some exporters write a whole mesh of faces on one line, 0=no limit")
+}
+
+// The quad validation flags, shared by the convert and validate subcommands.
+func defineQuadFlags(flags *flag.FlagSet) {
+	planarTolPtr = flags.Float64("planartol", 0.999, "Minimum dot product between the normals of the two halves of a quad for it to count as planar [0.0 - 1.0]")
+	noConvexPtr = flags.Bool("noconvex", false, "Skip the convexity test when validating quads")
+}
+
+// Parse the arguments of the convert subcommand, returning the input files and the output file
+// to convert them into.
+func ParseCommandLine(arguments []string) (inputFileNames []string, outputFileName string, ok bool) {
+	convertFlags.Parse(arguments)
+	if convertFlags.Arg(1) == "-" {
+		logOutput = os.Stderr
+	}
+	SetLogLevel()
+	Logf(LOG_INFO, "-- OBJ file converter v0.1 --\n")
+
+	if *clampIndicesPtr != "error" && *clampIndicesPtr != "clamp" && *clampIndicesPtr != "wrap" && *clampIndicesPtr != "drop" {
+		Logf(LOG_ERROR, "Error: Unknown -clamp-indices mode %s.\n", *clampIndicesPtr)
+		return nil, "", false
+	}
+	if *spherePtr != "ritter" && *spherePtr != "welzl" {
+		Logf(LOG_ERROR, "Error: Unknown bounding sphere algorithm %s.\n", *spherePtr)
+		return nil, "", false
+	}
+	if *planarTolPtr < 0 || *planarTolPtr > 1 {
+		Logf(LOG_ERROR, "Error: -planartol must be between 0 and 1.\n")
+		return nil, "", false
+	}
+	if *normalAnglePtr < 0 || *normalAnglePtr >= 180 {
+		Logf(LOG_ERROR, "Error: -normalangle must be at least 0 and below 180 degrees.\n")
+		return nil, "", false
+	}
+	if *maxCachePtr < 1 {
+		Logf(LOG_ERROR, "Error: -maxcache must be at least 1.\n")
+		return nil, "", false
+	}
+	if *decimatePtr < 0 || *decimatePtr > 1 {
+		Logf(LOG_ERROR, "Error: -decimate must be between 0 and 1.\n")
+		return nil, "", false
+	}
+	if *centerPtr && *centerBasePtr {
+		Logf(LOG_ERROR, "Error: -center and -center-origin-to-base cannot be combined.\n")
+		return nil, "", false
+	}
+	if *encodingPtr != "utf-8" && *encodingPtr != "latin1" && *encodingPtr != "windows-1252" {
+		Logf(LOG_ERROR, "Error: Unknown -encoding %s, use utf-8, latin1 or windows-1252.\n", *encodingPtr)
+		return nil, "", false
+	}
+	if *smoothPtr != "" {
+		if _, _, err := ParseSmooth(*smoothPtr); err != nil {
+			Logf(LOG_ERROR, "Error: Invalid -smooth value: %v\n", err)
+			return nil, "", false
+		}
+	}
+	if *genUVPtr != "" && *genUVPtr != "planar" && *genUVPtr != "box" {
+		Logf(LOG_ERROR, "Error: Unknown -genuv projection %s, use planar or box.\n", *genUVPtr)
+		return nil, "", false
+	}
+	if *lodsPtr < 0 {
+		Logf(LOG_ERROR, "Error: -lods must not be negative.\n")
+		return nil, "", false
+	}
+	if *quadNormalsPtr && *qPtr < 1 {
+		Logf(LOG_WARN, "Warning: -quadnormals only applies to quads split with -q 1, 2 or 3.\n")
+	}
+	if *maxLinePtr < 0 {
+		Logf(LOG_ERROR, "Error: -maxline must not be negative.\n")
+		return nil, "", false
+	}
+	if *formatPtr != "mshx" && *formatPtr != "obj-canonical" && *formatPtr != "ply" && *formatPtr != "ply-binary" {
+		Logf(LOG_ERROR, "Error: Unknown output format %s.\n", *formatPtr)
+		return nil, "", false
+	}
+
+	// Handle endianness flags.
+	if *lePtr && *bePtr {
+		Logf(LOG_ERROR, "Error: Cannot specify both little and big endian.\n")
+		return nil, "", false
+	} else if !*lePtr && !*bePtr {
+		Logf(LOG_WARN, "Warning: No endianness specified. Defaulting to little endian.\n")
+		*lePtr = true
+	}
+
+	// Get command line arguments for input and output file.
+	var args []string = convertFlags.Args()
+	var argCount int = len(args)
+
+	if *validatePtr {
+		Logf(LOG_WARN, "Warning: -validate is deprecated, use objconv validate <input file> instead.\n")
+	}
+	if *validatePtr && *streamPtr {
+		Logf(LOG_ERROR, "Error: -validate cannot be combined with -stream.\n")
+		return nil, "", false
+	}
+	if *batchPtr != "" {
+		if argCount > 0 {
+			Logf(LOG_ERROR, "Error: -batch reads the files matching its pattern, no file arguments can be given.\n")
+			return nil, "", false
+		}
+		return nil, "", true
+	}
+	if argCount < 1 {
+		fmt.Fprintln(logOutput, "Usage: objconv [convert] [flags] <input file>... [<output file>]")
+		fmt.Fprintln(logOutput, "       objconv [convert] [flags] -batch <pattern>")
+		fmt.Fprintln(logOutput, "       objconv validate [flags] <input file>")
+		fmt.Fprintln(logOutput, "       objconv inspect <file.mshx>")
+		fmt.Fprintln(logOutput, "Use - as the input or output file to read from stdin or write to stdout.")
+		fmt.Fprintln(logOutput, "Without an output file the output is named after the input, cube.obj converts to cube.mshx.")
+		fmt.Fprintln(logOutput, "Flags:")
+		convertFlags.SetOutput(logOutput)
+		convertFlags.PrintDefaults()
+		return nil, "", false
+	}
+
+	// Every argument before the output file is an input, they are merged into one mesh. A single
+	// argument or -outdir leaves the output to be named after the first input.
+	inputFileNames = args
+	if argCount > 1 && *outDirPtr == "" {
+		inputFileNames = args[:argCount-1]
+		outputFileName = args[argCount-1]
+	}
+	if outputFileName == "" && !*validatePtr {
+		if inputFileNames[0] == "-" {
+			Logf(LOG_ERROR, "Error: An output file must be given when reading from stdin.\n")
+			return nil, "", false
+		}
+		var err error
+		outputFileName, err = OutputName(inputFileNames[0], *outDirPtr)
+		if err != nil {
+			return nil, "", false
+		}
+	}
+	if len(inputFileNames) > 1 && (*validatePtr || *streamPtr) {
+		Logf(LOG_ERROR, "Error: -validate and -stream read a single input file.\n")
+		return nil, "", false
+	}
+	if len(inputFileNames) > 1 && slices.Contains(inputFileNames, "-") {
+		Logf(LOG_ERROR, "Error: stdin can only be read when it is the only input file.\n")
+		return nil, "", false
+	}
+	return inputFileNames, outputFileName, true
+}
+
+// Name the output after the input file, replacing its extension with the one for -format and
+// adding .gz for -gzout. The output goes beside the input unless an output directory is given.
+func OutputName(inputName string, outDir string) (string, error) {
+	base := strings.TrimSuffix(inputName, ".gz")
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	if outDir != "" {
+		base = filepath.Join(outDir, filepath.Base(base))
+	}
+	var extension string = ".mshx"
+	switch *formatPtr {
+	case "obj-canonical":
+		extension = ".canonical.obj"
+	case "ply", "ply-binary":
+		extension = ".ply"
+	}
+	if *gzOutPtr {
+		extension += ".gz"
+	}
+	outputName := base + extension
+	if filepath.Clean(outputName) == filepath.Clean(inputName) {
+		Logf(LOG_ERROR, "Error: The output would overwrite the input file %s, give an output file.\n", inputName)
+		return "", errors.New("output overwrites input")
+	}
+	Logf(LOG_INFO, "Writing to %s\n", outputName)
+	return outputName, nil
+}
+
+// Parse a comma separated x,y,z vector.
+func ParseVector3(s string) ([3]float32, error) {
+	var result [3]float32
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return result, fmt.Errorf("expected x,y,z but got %q", s)
+	}
+	for i := 0; i < 3; i++ {
+		f, err := strconv.ParseFloat(strings.TrimSpace(parts[i]), 32)
+		if err != nil {
+			return result, fmt.Errorf("invalid vector component %q: %v", parts[i], err)
+		}
+		result[i] = float32(f)
+	}
+	return result, nil
+}
+
+// Parse space separated key=x,y,z pairs such as "dir=0,1,0 color=1,1,1".
+func ParseKeyVectors(s string) (map[string][3]float32, error) {
+	result := make(map[string][3]float32)
+	for _, part := range strings.Fields(s) {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return result, fmt.Errorf("expected key=value but got %q", part)
+		}
+		vec, err := ParseVector3(value)
+		if err != nil {
+			return result, err
+		}
+		result[key] = vec
+	}
+	return result, nil
+}
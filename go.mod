@@ -1,3 +1,3 @@
-module main
+module objconv
 
 go 1.23.6
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"slices"
+)
+
+// The faces using one material, faces [firstFace, firstFace+faceCount) after grouping.
+type MaterialRange struct {
+	firstFace uint32
+	faceCount uint32
+}
+
+// Stable sort the faces by material so each material is drawn from one contiguous range,
+// keeping the cache optimised order within a material, and build the range table.
+func (m *Mesh) GroupFacesByMaterial() {
+	slices.SortStableFunc(m.faces, func(a, b Face) int {
+		if a.materialID < b.materialID {
+			return -1
+		} else if a.materialID > b.materialID {
+			return 1
+		}
+		return 0
+	})
+	m.materialRanges = make([]MaterialRange, len(m.materials))
+	for i := range m.faces {
+		id := m.faces[i].materialID
+		if id >= uint32(len(m.materialRanges)) {
+			continue
+		}
+		if m.materialRanges[id].faceCount == 0 {
+			m.materialRanges[id].firstFace = uint32(i)
+		}
+		m.materialRanges[id].faceCount++
+	}
+	Logf(LOG_INFO, "Grouped %d faces into %d material ranges\n", len(m.faces), len(m.materialRanges))
+}
+
+func (m *Mesh) writeMaterialRanges(writer *bufio.Writer, byteOrder binary.ByteOrder) {
+	writer.WriteString("MGRP")
+	binary.Write(writer, byteOrder, uint32(len(m.materialRanges)))
+	for i := range m.materialRanges {
+		binary.Write(writer, byteOrder, m.materialRanges[i].firstFace)
+		binary.Write(writer, byteOrder, m.materialRanges[i].faceCount)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"math"
+)
+
+// The faces of one level of detail, faces [firstFace, firstFace+faceCount), used when the
+// viewer is at least switchDistance from the centre of the bounding sphere.
+type LODRange struct {
+	firstFace      uint32
+	faceCount      uint32
+	switchDistance float32
+}
+
+// Append count levels of detail after the full mesh, each decimated to half the triangles of
+// the level before. The levels share the vertices so only the faces are repeated. Each level
+// switches in at twice the distance of the one before, starting from four times the bounding
+// radius, so the triangle count halves as the projected size of the mesh does.
+func (m *Mesh) BuildLODs(count int) error {
+	radius := float64(m.boundSphere.radius)
+	if m.vertexType&NO_BOUND_SPHERE != 0 {
+		radius = Distance(m.boundBox.min, m.boundBox.max) / 2
+	}
+
+	all := m.faces
+	m.lodRanges = []LODRange{{0, uint32(len(m.faces)), 0}}
+	previous := m.faces
+	for level := 1; level <= count; level++ {
+		m.faces = make([]Face, len(previous))
+		for i := range previous {
+			m.faces[i] = copyFace(previous[i])
+		}
+		collapses, err := m.collapseEdges(len(m.faces)/2, nil)
+		if err != nil {
+			Logf(LOG_ERROR, "Error: -lods requires a triangle mesh, use -q 3 to convert quads.\n")
+			m.faces = all
+			return err
+		}
+		distance := float32(radius * 2 * math.Pow(2, float64(level)))
+		m.lodRanges = append(m.lodRanges, LODRange{uint32(len(all)), uint32(len(m.faces)), distance})
+		Logf(LOG_INFO, "LOD %d: %d triangles after %d edge collapses, switching at distance %g.\n", level, len(m.faces), collapses, distance)
+		previous = m.faces
+		all = append(all, m.faces...)
+	}
+	m.faces = all
+	return nil
+}
+
+func (m *Mesh) writeLODRanges(writer *bufio.Writer, byteOrder binary.ByteOrder) {
+	writer.WriteString("LODS")
+	for i := range m.lodRanges {
+		binary.Write(writer, byteOrder, m.lodRanges[i].firstFace)
+		binary.Write(writer, byteOrder, m.lodRanges[i].faceCount)
+		binary.Write(writer, byteOrder, m.lodRanges[i].switchDistance)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLODChainReducesFaces(t *testing.T) {
+	original := convertOBJ(t, gridOBJ(8))
+	file := convertOBJ(t, gridOBJ(8), "-lods", "2")
+
+	// The table read back has the full mesh and each level after it, covering every face.
+	if file.header.lodCount != 3 || len(file.lodRanges) != 3 {
+		t.Fatalf("header has %d levels and %d were read, want the full mesh and 2 more", file.header.lodCount, len(file.lodRanges))
+	}
+	if r := file.lodRanges[0]; r.firstFace != 0 || int(r.faceCount) != len(original.faces) || r.switchDistance != 0 {
+		t.Errorf("level 0 is %+v, want all %d original faces from distance 0", r, len(original.faces))
+	}
+	var next uint32 = 0
+	for i, r := range file.lodRanges {
+		if r.firstFace != next {
+			t.Errorf("level %d starts at face %d, want %d straight after the level before", i, r.firstFace, next)
+		}
+		next = r.firstFace + r.faceCount
+		if i == 0 {
+			continue
+		}
+		previous := file.lodRanges[i-1]
+		if r.faceCount > previous.faceCount/2 || r.faceCount == 0 {
+			t.Errorf("level %d has %d faces, want at most half of the %d before", i, r.faceCount, previous.faceCount)
+		}
+		if r.switchDistance <= previous.switchDistance {
+			t.Errorf("level %d switches at %g, not beyond %g for the level before", i, r.switchDistance, previous.switchDistance)
+		}
+	}
+	if int(next) != len(file.faces) {
+		t.Errorf("the levels cover %d faces, but %d were written", next, len(file.faces))
+	}
+}
+
+func TestLODsNeedTriangles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": cubeOBJ})
+	resetCommandLine()
+	var log bytes.Buffer
+	logOutput = &log
+	if err := Convert([]string{"-lods", "1", filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx")}); err == nil {
+		t.Fatal("-lods converted a mesh of quads")
+	}
+	if !strings.Contains(log.String(), "-lods requires a triangle mesh") {
+		t.Errorf("the error does not name -lods, log %q", log.String())
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Message levels, a message is printed when its level is at or below the current log level.
+const (
+	LOG_ERROR   = 0 // Always printed, even with -silent
+	LOG_WARN    = 1
+	LOG_INFO    = 2 // Phase summaries, the default level
+	LOG_VERBOSE = 3 // Per-element detail such as material properties, -v
+	LOG_DEBUG   = 4 // Every parsed element and face, -vv
+)
+
+var logLevel int = LOG_INFO
+
+// Where messages are printed, stderr when the output file is stdout so they do not corrupt it.
+var logOutput io.Writer = os.Stdout
+
+// Set the log level from the -silent, -v and -vv flags.
+func SetLogLevel() {
+	switch {
+	case *silentPtr:
+		logLevel = LOG_ERROR
+	case *vvPtr:
+		logLevel = LOG_DEBUG
+	case *vPtr:
+		logLevel = LOG_VERBOSE
+	default:
+		logLevel = LOG_INFO
+	}
+}
+
+// Print a diagnostic message if the log level allows it.
+func Logf(level int, format string, args ...any) {
+	if level <= logLevel {
+		fmt.Fprintf(logOutput, format, args...)
+	}
+}
@@ -0,0 +1,1303 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Run as the converter itself when a test starts this binary as a child process.
+	if os.Getenv("OBJCONV_RUN_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	DefineFlags()
+	os.Exit(m.Run())
+}
+
+// Define the flags afresh on a new flag set and clear what an earlier command line left behind,
+// so each test converts as a fresh process would.
+func resetCommandLine() {
+	DefineFlags()
+	bakeLights = nil
+	logOutput = io.Discard
+}
+
+// Parse args as the converter's command line and return the input and output files.
+func parseCommandLine(t *testing.T, args ...string) ([]string, string) {
+	t.Helper()
+	resetCommandLine()
+	inputFileNames, outputFileName, ok := ParseCommandLine(args)
+	if !ok {
+		t.Fatalf("parsing the command line %v failed", args)
+	}
+	return inputFileNames, outputFileName
+}
+
+// Convert a file in dir with the flags given and return the bytes written.
+func convertFile(t *testing.T, dir string, input string, args ...string) []byte {
+	t.Helper()
+	resetCommandLine()
+	output := filepath.Join(dir, "out.mshx")
+	arguments := append(append([]string{}, args...), "-le", filepath.Join(dir, input), output)
+	if err := Convert(arguments); err != nil {
+		t.Fatalf("converting %s %v: %v", input, args, err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Convert the OBJ source with the flags given and read the MSHX file back.
+func convertOBJ(t *testing.T, obj string, args ...string) *MSHXFile {
+	t.Helper()
+	dir := writeFiles(t, map[string]string{"in.obj": obj})
+	return readOutput(t, convertFile(t, dir, "in.obj", args...))
+}
+
+func readOutput(t *testing.T, data []byte) *MSHXFile {
+	t.Helper()
+	file, err := ReadMSHX(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("reading the output back: %v", err)
+	}
+	return file
+}
+
+// Write the files into a new temporary directory and return its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMtllibRelativeToOBJ(t *testing.T) {
+	shared := writeFiles(t, map[string]string{"shared.mtl": "newmtl steel\nKd 0.5 0.5 0.5\n"})
+	assets := writeFiles(t, map[string]string{
+		"in.obj":          "mtllib in.mtl\nmtllib sub/more.mtl " + filepath.Join(shared, "shared.mtl") + "\nv 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl red\nf 1 2 3\n",
+		"in.mtl":          "newmtl red\nKd 1 0 0\n",
+		"sub/more.mtl":    "newmtl green\nKd 0 1 0\n",
+		"elsewhere/x.txt": "",
+	})
+
+	// Convert from a working directory which holds none of the material files.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join(assets, "elsewhere")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	inputFileNames, _ := parseCommandLine(t, "-le", "-silent", filepath.Join(assets, "in.obj"), "out.mshx")
+	m := NewMesh()
+	m.inputFileName = inputFileNames[0]
+	inputFile, err := os.Open(m.inputFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inputFile.Close()
+	if err := m.ProcessOBJFile(inputFile); err != nil {
+		t.Fatalf("processing %s: %v", m.inputFileName, err)
+	}
+
+	for _, name := range []string{"red", "green", "steel"} {
+		if _, ok := m.materialMap[name]; !ok {
+			t.Errorf("material %s was not loaded", name)
+		}
+	}
+}
+
+func TestFacesBeforeUsemtlGetDefaultMaterial(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"in.obj": "mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 1 0\nf 1 2 3\nusemtl red\nf 2 4 3\n",
+		"in.mtl": "newmtl red\nKd 1 0 0\n",
+	})
+	file := readOutput(t, convertFile(t, dir, "in.obj"))
+
+	if len(file.materials) != 2 {
+		t.Fatalf("got %d materials, want red and the default", len(file.materials))
+	}
+	before, after := file.faces[0].materialID, file.faces[1].materialID
+	if file.materials[after].diffuse != [3]float32{1, 0, 0} {
+		t.Errorf("face after usemtl uses diffuse %v, want red", file.materials[after].diffuse)
+	}
+	if before == after || file.materials[before].diffuse != [3]float32{1, 1, 1} {
+		t.Errorf("face before usemtl uses material %d with diffuse %v, want its own white default", before, file.materials[before].diffuse)
+	}
+}
+
+func TestDefaultMaterialWithoutMaterials(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"})
+	file := readOutput(t, convertFile(t, dir, "in.obj"))
+	if len(file.materials) != 1 || file.materials[0].name != DEFAULT_MATERIAL_NAME || file.faces[0].materialID != 0 {
+		t.Errorf("got materials %+v and material id %d, want only %s", file.materials, file.faces[0].materialID, DEFAULT_MATERIAL_NAME)
+	}
+}
+
+func TestCRLFLineEndings(t *testing.T) {
+	crlf := func(s string) string { return strings.ReplaceAll(s, "\n", "\r\n") }
+	dir := writeFiles(t, map[string]string{
+		"in.obj": crlf("mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\nusemtl brick\nf 1/1 2/2 3/3\n"),
+		"in.mtl": crlf("newmtl brick\nKd 0.5 0.25 0\nmap_Kd brick.png\n"),
+	})
+	file := readOutput(t, convertFile(t, dir, "in.obj"))
+
+	// A name keeping its \r would miss the material and add the default one.
+	if len(file.materials) != 1 {
+		t.Fatalf("got %d materials, want only brick", len(file.materials))
+	}
+	m := file.materials[file.faces[0].materialID]
+	if m.texture != "brick.png" {
+		t.Errorf("face uses texture %q, want brick.png", m.texture)
+	}
+	if m.diffuse != [3]float32{0.5, 0.25, 0} {
+		t.Errorf("brick has diffuse %v, want 0.5 0.25 0", m.diffuse)
+	}
+	if len(file.textureCoords) != 3 {
+		t.Errorf("got %d texture coords, want 3", len(file.textureCoords))
+	}
+}
+
+// An OBJ with a single polyline of corners vertices spread over one long line.
+func longLineOBJ(corners int) string {
+	var b strings.Builder
+	b.WriteString("v 0 0 0\nv 1 0 0\nv 0 1 0\nl")
+	for i := 0; i < corners; i++ {
+		fmt.Fprintf(&b, " %d", i%3+1)
+	}
+	b.WriteString("\nf 1 2 3\n")
+	return b.String()
+}
+
+func TestLinesLongerThan64KB(t *testing.T) {
+	texture := strings.Repeat("t", 100*1024) + ".png"
+	obj := "mtllib in.mtl\n" + longLineOBJ(40000) + "usemtl long\nf 1 2 3\n"
+	dir := writeFiles(t, map[string]string{
+		"in.obj":    obj,
+		"in.mtl":    "newmtl long\nmap_Kd " + texture + "\n",
+		"pose2.obj": "# " + strings.Repeat("c", 100*1024) + "\nv 0 0 1\nv 1 0 1\nv 0 1 1\n",
+	})
+	if len(longLineOBJ(40000)) < 64*1024 {
+		t.Fatal("the polyline line is not longer than 64KB")
+	}
+
+	file := readOutput(t, convertFile(t, dir, "in.obj", "-pose2", filepath.Join(dir, "pose2.obj")))
+	if len(file.polylines) != 1 || len(file.polylines[0].v) != 40000 {
+		t.Errorf("got %d polylines, want one of 40000 corners", len(file.polylines))
+	}
+	if len(file.faces) != 2 {
+		t.Errorf("got %d faces, want 2, parsing stopped at the long line", len(file.faces))
+	}
+	// The polyline and the first face come before usemtl and get the default material.
+	kept := slices.ContainsFunc(file.materials, func(m Material) bool { return m.texture == texture })
+	if len(file.materials) != 2 || !kept {
+		t.Errorf("the long texture path of the material was not kept")
+	}
+	if file.header.vertexType&VERTEX_VELOCITY == 0 || file.vertices[0].velocity != [3]float32{0, 0, 1} {
+		t.Errorf("the second pose after a long line was not read")
+	}
+
+	streamed := readOutput(t, convertFile(t, dir, "in.obj", "-stream"))
+	if len(streamed.faces) != 2 {
+		t.Errorf("-stream wrote %d faces, want 2", len(streamed.faces))
+	}
+}
+
+// A unit cube from 0,0,0 to 1,1,1 with its normals.
+const cubeOBJ = `v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 0 0 1
+v 1 0 1
+v 1 1 1
+v 0 1 1
+vn 0 0 -1
+vn 0 0 1
+vn 0 -1 0
+vn 0 1 0
+vn -1 0 0
+vn 1 0 0
+f 1//1 4//1 3//1 2//1
+f 5//2 6//2 7//2 8//2
+f 1//3 2//3 6//3 5//3
+f 4//4 8//4 7//4 3//4
+f 1//5 5//5 8//5 4//5
+f 2//6 3//6 7//6 6//6
+`
+
+func TestDeDupeMergesCoincidentVertices(t *testing.T) {
+	// Two triangles sharing an edge, each listing its own copies of the shared corners.
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nf 1 2 3\nf 4 5 6\n"
+	if file := convertOBJ(t, obj); len(file.vertices) != 6 {
+		t.Fatalf("got %d vertices without -d, want all 6", len(file.vertices))
+	}
+	file := convertOBJ(t, obj, "-d")
+	if len(file.vertices) != 4 {
+		t.Fatalf("got %d vertices with -d, want the 4 distinct positions", len(file.vertices))
+	}
+	if len(file.faces) != 2 {
+		t.Fatalf("got %d faces, want 2", len(file.faces))
+	}
+	shared := 0
+	for _, v := range file.faces[0].v {
+		if slices.Contains(file.faces[1].v, v) {
+			shared++
+		}
+	}
+	if shared != 2 {
+		t.Errorf("the faces share %d vertices, want the 2 of the common edge", shared)
+	}
+}
+
+func TestDeDupeKeepsDifferentColoursApart(t *testing.T) {
+	obj := "v 0 0 0 1 0 0\nv 1 0 0 1 0 0\nv 0 1 0 1 0 0\nv 1 0 0 0 0 1\nv 1 1 0 0 0 1\nv 0 1 0 0 0 1\nf 1 2 3\nf 4 5 6\n"
+	file := convertOBJ(t, obj, "-d")
+	if len(file.vertices) != 6 {
+		t.Errorf("got %d vertices, want 6 as the shared positions have different colours", len(file.vertices))
+	}
+	same := strings.ReplaceAll(obj, " 0 0 1\n", " 1 0 0\n")
+	if file := convertOBJ(t, same, "-d"); len(file.vertices) != 4 {
+		t.Errorf("got %d vertices, want 4 once the colours match", len(file.vertices))
+	}
+}
+
+func TestFilterObjectsKeepsOneObject(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"in.obj": `mtllib in.mtl
+o first
+v 0 0 0
+v 1 0 0
+v 0 1 0
+usemtl red
+f 1 2 3
+o second
+v 10 0 0
+v 11 0 0
+v 10 1 0
+usemtl green
+f 4 5 6
+o third
+v 20 0 0
+v 21 0 0
+v 20 1 0
+usemtl blue
+f 7 8 9
+`,
+		"in.mtl": "newmtl red\nKd 1 0 0\nnewmtl green\nKd 0 1 0\nnewmtl blue\nKd 0 0 1\n",
+	})
+	file := readOutput(t, convertFile(t, dir, "in.obj", "-objects", "second"))
+
+	if len(file.faces) != 1 {
+		t.Fatalf("got %d faces, want 1", len(file.faces))
+	}
+	if len(file.vertices) != 3 {
+		t.Fatalf("got %d vertices, want 3", len(file.vertices))
+	}
+	want := [][3]float32{{10, 0, 0}, {11, 0, 0}, {10, 1, 0}}
+	for corner, v := range file.faces[0].v {
+		got := file.vertices[v]
+		if [3]float32{got.X, got.Y, got.Z} != want[corner] {
+			t.Errorf("corner %d is at %v,%v,%v, want %v", corner, got.X, got.Y, got.Z, want[corner])
+		}
+	}
+	if len(file.materials) != 1 || file.materials[0].diffuse != [3]float32{0, 1, 0} {
+		t.Errorf("got materials %+v, want only green", file.materials)
+	}
+}
+
+func TestFilterObjectsUnknownName(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": "o only\nv 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"})
+	resetCommandLine()
+	err := Convert([]string{"-objects", "missing", filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx")})
+	if err == nil {
+		t.Fatal("converting with an unknown object name succeeded")
+	}
+}
+
+func TestParseFaceCornerFormats(t *testing.T) {
+	resetCommandLine()
+	tests := []struct {
+		line  string
+		valid bool
+	}{
+		{"f 1 2 3", true},
+		{"f 1/1 2/2 3/3", true},
+		{"f 1//1 2//2 3//3", true},
+		{"f 1/1/1 2/2/2 3/3/3 4/4/4", true},
+		{"f 1/1/1 2//2 3/3/3", false},
+		{"f 1/1/1 2/2 3/3/3", false},
+		{"f 1 2/2 3", false},
+		{"f 1//1 2 3//3 4//4", false},
+	}
+	for _, test := range tests {
+		face, err := ParseFace(test.line, strings.Fields(test.line), 7)
+		if test.valid && err != nil {
+			t.Errorf("%q: unexpected error %v", test.line, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%q: mixed corners were accepted with uv %v and normals %v", test.line, face.uv, face.n)
+		}
+	}
+}
+
+func TestMixedFaceCornersFailConversion(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\nvn 0 0 1\nf 1/1/1 2//1 3/3/1\n"})
+	resetCommandLine()
+	if err := Convert([]string{filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx")}); err == nil {
+		t.Fatal("an OBJ with mixed face corners converted without error")
+	}
+}
+
+func TestSanitizeNamesAppliesEverywhere(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"in.obj": "mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 1 0\nusemtl My/Mat 1\nf 1 2 3\nusemtl plain\nf 2 4 3\n",
+		"in.mtl": "newmtl My/Mat 1\nKd 1 0 0\nnewmtl plain\nKd 0 1 0\n",
+	})
+	file := readOutput(t, convertFile(t, dir, "in.obj", "-sanitize-names"))
+
+	names := map[string]uint32{}
+	for i, m := range file.materials {
+		names[m.name] = uint32(i)
+	}
+	id, ok := names["My_Mat_1"]
+	if !ok || len(names) != 2 {
+		t.Fatalf("got materials %v, want My_Mat_1 and plain", names)
+	}
+	if file.materials[id].diffuse != [3]float32{1, 0, 0} {
+		t.Errorf("My_Mat_1 has diffuse %v, want the colour of My/Mat 1", file.materials[id].diffuse)
+	}
+	if file.faces[0].materialID != id {
+		t.Errorf("first face uses material %d, want My_Mat_1 (%d)", file.faces[0].materialID, id)
+	}
+}
+
+func TestSanitizeNamesReportsCollisions(t *testing.T) {
+	resetCommandLine()
+	m := NewMesh()
+	*sanitizeNamesPtr = true
+	var log bytes.Buffer
+	logOutput = &log
+
+	if got := m.MaterialName("My/Mat 1"); got != "My_Mat_1" {
+		t.Errorf("My/Mat 1 sanitized to %q, want My_Mat_1", got)
+	}
+	if m.MaterialName("My/Mat 1"); log.Len() != 0 {
+		t.Errorf("using the same name again warned: %s", log.String())
+	}
+	if got := m.MaterialName("My Mat/1"); got != "My_Mat_1" {
+		t.Errorf("My Mat/1 sanitized to %q, want My_Mat_1", got)
+	}
+	if !strings.Contains(log.String(), "both sanitize to") {
+		t.Errorf("no collision warning, log was %q", log.String())
+	}
+}
+
+// Make a mesh of count vertices in which every position is used by two vertices, with a
+// triangle over each run of three vertices.
+func loadDuplicatedMesh(count int) *Mesh {
+	m := NewMesh()
+	points := randomPoints(count/2, 3)
+	m.vertices = make([]Vertex, 0, count)
+	for i := 0; i < count; i++ {
+		m.vertices = append(m.vertices, points[i%len(points)])
+	}
+	for i := 0; i+2 < count; i += 3 {
+		m.faces = append(m.faces, Face{edges: 3, v: []uint32{uint32(i), uint32(i + 1), uint32(i + 2)}})
+	}
+	return m
+}
+
+func TestDeDupeSameForAnyWorkerCount(t *testing.T) {
+	resetCommandLine()
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+
+	runtime.GOMAXPROCS(1)
+	m := loadDuplicatedMesh(3000)
+	m.DeDupe(0.0001, 0.001, 0.00001)
+	wantVertices, wantFaces := m.vertices, m.faces
+	if len(wantVertices) != 1500 {
+		t.Fatalf("%d vertices after dedupe, want 1500", len(wantVertices))
+	}
+
+	for _, workers := range []int{2, 3, 8} {
+		runtime.GOMAXPROCS(workers)
+		m = loadDuplicatedMesh(3000)
+		m.DeDupe(0.0001, 0.001, 0.00001)
+		if !slices.Equal(m.vertices, wantVertices) {
+			t.Errorf("%d workers kept different vertices", workers)
+		}
+		for i := range m.faces {
+			if !slices.Equal(m.faces[i].v, wantFaces[i].v) {
+				t.Errorf("%d workers: face %d uses %v, want %v", workers, i, m.faces[i].v, wantFaces[i].v)
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkDeDupe1M(b *testing.B) {
+	resetCommandLine()
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	for _, workers := range slices.Compact([]int{1, runtime.NumCPU()}) {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			runtime.GOMAXPROCS(workers)
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				m := loadDuplicatedMesh(1000000)
+				b.StartTimer()
+				m.DeDupe(0.0001, 0.001, 0.00001)
+			}
+		})
+	}
+}
+
+// Make a long thin strip of triangles in a shuffled order, which the bounding sphere fits
+// loosely.
+func loadShuffledStrip(length int) *Mesh {
+	m := NewMesh()
+	for x := 0; x <= length; x++ {
+		m.vertices = append(m.vertices, Vertex{X: float32(x), W: 1}, Vertex{X: float32(x), Y: 1, W: 1})
+	}
+	for x := 0; x < length; x++ {
+		a := uint32(2 * x)
+		m.faces = append(m.faces, Face{edges: 3, v: []uint32{a, a + 2, a + 1}}, Face{edges: 3, v: []uint32{a + 1, a + 2, a + 3}})
+	}
+	r := rand.New(rand.NewSource(5))
+	r.Shuffle(len(m.faces), func(i, j int) { m.faces[i], m.faces[j] = m.faces[j], m.faces[i] })
+	return m
+}
+
+func TestOptimiseMeshTightBoxBeatsSphereBox(t *testing.T) {
+	resetCommandLine()
+	m := loadShuffledStrip(2000)
+	center, radius := RitterBoundingSphere(m.vertices)
+	r := float32(radius)
+	m.optimiseMeshInBox(MORTON_RESOLUTION, Vertex{X: center.X - r, Y: center.Y - r, Z: center.Z - r}, Vertex{X: center.X + r, Y: center.Y + r, Z: center.Z + r})
+	sphereStride := m.StrideDistance()
+
+	m = loadShuffledStrip(2000)
+	shuffledStride := m.StrideDistance()
+	m.OptimiseMesh(MORTON_RESOLUTION)
+	tightStride := m.StrideDistance()
+
+	if tightStride > sphereStride {
+		t.Errorf("stride distance %d with the tight box is worse than %d with the sphere box", tightStride, sphereStride)
+	}
+	if tightStride >= shuffledStride {
+		t.Errorf("stride distance %d after optimising is no better than %d before", tightStride, shuffledStride)
+	}
+}
+
+func TestOptimiseMeshIgnoresBoundingSphere(t *testing.T) {
+	resetCommandLine()
+	m := loadShuffledStrip(100)
+	m.GenerateBoundingSphere()
+	m.OptimiseMesh(MORTON_RESOLUTION)
+	want := slices.Clone(m.faces)
+
+	// A degenerate sphere left behind must not change the order.
+	m = loadShuffledStrip(100)
+	m.boundSphere = BoundSphere{}
+	m.OptimiseMesh(MORTON_RESOLUTION)
+	for i := range m.faces {
+		if !slices.Equal(m.faces[i].v, want[i].v) {
+			t.Fatalf("face %d uses %v with no bounding sphere, want %v", i, m.faces[i].v, want[i].v)
+		}
+	}
+}
+
+func TestTwoMegabyteLine(t *testing.T) {
+	const corners = 1100000
+	obj := longLineOBJ(corners)
+	if len(obj) < 2*1024*1024 {
+		t.Fatalf("test line is only %d bytes", len(obj))
+	}
+	for _, maxLine := range []string{"64", "0"} {
+		file := convertOBJ(t, obj, "-maxline", maxLine)
+		if len(file.polylines) != 1 || len(file.polylines[0].v) != corners {
+			t.Errorf("-maxline %s: got %d polylines, want one of %d corners", maxLine, len(file.polylines), corners)
+		}
+		if len(file.faces) != 1 {
+			t.Errorf("-maxline %s: got %d faces, want the face after the long line", maxLine, len(file.faces))
+		}
+	}
+}
+
+func TestLineLongerThanMaxLine(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": longLineOBJ(1100000)})
+	resetCommandLine()
+	var log bytes.Buffer
+	logOutput = &log
+	err := Convert([]string{"-silent", "-maxline", "1", filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx")})
+	if err == nil {
+		t.Fatal("a 2MB line was accepted with -maxline 1")
+	}
+	if !strings.Contains(log.String(), "raise the limit with -maxline") {
+		t.Errorf("log %q does not suggest -maxline", log.String())
+	}
+}
+
+func TestScanErrorsAreReported(t *testing.T) {
+	for _, maxLine := range []int{64, 0} {
+		resetCommandLine()
+		m := NewMesh()
+		*maxLinePtr = maxLine
+		var log bytes.Buffer
+		logOutput = &log
+		m.inputFileName = "broken.obj"
+		err := m.ProcessOBJFile(io.MultiReader(strings.NewReader("v 0 0 0\n"), iotest.ErrReader(errors.New("device gone"))))
+		if err == nil {
+			t.Errorf("-maxline %d: a failing read was not returned", maxLine)
+		}
+		if !strings.Contains(log.String(), "Error reading file broken.obj: device gone") {
+			t.Errorf("-maxline %d: log %q does not report the read error", maxLine, log.String())
+		}
+	}
+}
+
+func TestByteLineReader(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	input := "first\r\n\n" + long + "\nlast"
+	l := &byteLineReader{r: bufio.NewReaderSize(strings.NewReader(input), 16)}
+	var got []string
+	for l.Scan() {
+		got = append(got, l.Text())
+	}
+	if err := l.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"first", "", long, "last"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got lines %q, want %q", got, want)
+	}
+}
+
+func TestUnreferencedAttributesArePruned(t *testing.T) {
+	// Vertex 2 and the second normal and texture coord are not used by the face.
+	obj := "v 0 0 0\nv 5 5 5\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nvn 1 0 0\nvt 0 0\nvt 0.5 0.5\nvt 1 0\nvt 0 1\nf 1/1/1 3/3/1 4/4/1\n"
+	file := convertOBJ(t, obj)
+	if len(file.vertices) != 3 || len(file.normals) != 1 || len(file.textureCoords) != 3 {
+		t.Fatalf("got %d vertices, %d normals and %d texture coords, want 3, 1 and 3", len(file.vertices), len(file.normals), len(file.textureCoords))
+	}
+	for i, v := range file.vertices {
+		if v.X == 5 {
+			t.Errorf("the dangling vertex was written as vertex %d", i)
+		}
+	}
+	if len(file.faces) != 1 || !slices.Equal(file.faces[0].v, []uint32{0, 1, 2}) {
+		t.Errorf("the face was not remapped onto the kept vertices: %v", file.faces)
+	}
+
+	kept := convertOBJ(t, obj, "-keepunused")
+	if len(kept.vertices) != 4 || len(kept.normals) != 2 || len(kept.textureCoords) != 4 {
+		t.Errorf("-keepunused wrote %d vertices, %d normals and %d texture coords, want 4, 2 and 4", len(kept.vertices), len(kept.normals), len(kept.textureCoords))
+	}
+}
+
+func TestPruneAttributesReportsCount(t *testing.T) {
+	resetCommandLine()
+	m := NewMesh()
+	var log bytes.Buffer
+	logOutput = &log
+	m.vertices = []Vertex{{W: 1}, {X: 5, W: 1}, {X: 1, W: 1}, {Y: 1, W: 1}}
+	m.faces = []Face{{edges: 3, v: []uint32{0, 2, 3}}}
+
+	m.PruneAttributes()
+	if !strings.Contains(log.String(), "Pruned 1 unreferenced vertices") {
+		t.Errorf("the pruned vertex was not reported, log was %q", log.String())
+	}
+}
+
+func TestProcessOBJFromReader(t *testing.T) {
+	resetCommandLine()
+	m := NewMesh()
+	libraries := map[string]string{"mats.mtl": "newmtl red\nKd 1 0 0\n"}
+	defer func(open func(string) (io.ReadCloser, error)) { OpenMaterialFile = open }(OpenMaterialFile)
+	OpenMaterialFile = func(name string) (io.ReadCloser, error) {
+		contents, ok := libraries[filepath.Base(name)]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return io.NopCloser(strings.NewReader(contents)), nil
+	}
+
+	obj := "mtllib mats.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 1 0\nusemtl red\nf 1 2 3\nf 2 4 3\n"
+	if err := m.ProcessOBJFile(strings.NewReader(obj)); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.vertices) != 4 || len(m.faces) != 2 {
+		t.Errorf("parsed %d vertices and %d faces, want 4 and 2", len(m.vertices), len(m.faces))
+	}
+	if len(m.materials) != 1 || m.materials[0].name != "red" || m.materials[0].diffuse != [3]float32{1, 0, 0} {
+		t.Errorf("materials %+v, want red from the library in memory", m.materials)
+	}
+}
+
+func TestRepeatedConversionsDoNotAccumulate(t *testing.T) {
+	first := "mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\nvn 0 0 1\nusemtl red\nf 1/1/1 2/2/1 3/3/1\n"
+	dir := writeFiles(t, map[string]string{
+		"first.obj":  first,
+		"second.obj": gridOBJ(4),
+		"in.mtl":     "newmtl red\nKd 1 0 0\n",
+	})
+	// Each file converted again after the other must not carry anything over from it.
+	var outputs [4][]byte
+	for i := range outputs {
+		outputs[i] = convertFile(t, dir, []string{"first.obj", "second.obj"}[i%2], "-d", "-mo")
+	}
+	if !bytes.Equal(outputs[0], outputs[2]) {
+		t.Error("converting first.obj after second.obj gave different output")
+	}
+	if !bytes.Equal(outputs[1], outputs[3]) {
+		t.Error("converting second.obj after first.obj gave different output")
+	}
+	if file := readOutput(t, outputs[3]); len(file.materials) != 1 || file.materials[0].name != DEFAULT_MATERIAL_NAME || len(file.faces) != 32 {
+		t.Errorf("second.obj has %d materials and %d faces, want only the default material and 32", len(file.materials), len(file.faces))
+	}
+}
+
+func TestProgressTimingRestartsEachConversion(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": cubeOBJ})
+	convertLogged(t, dir, "-progress")
+	time.Sleep(500 * time.Millisecond)
+
+	// The second conversion times itself from its own start, not from the first one's.
+	_, log := convertLogged(t, dir, "-progress")
+	elapsed := regexp.MustCompile(`elapsed=([0-9.]+)s`).FindAllStringSubmatch(log, -1)
+	if len(elapsed) == 0 {
+		t.Fatalf("no progress shown, log %q", log)
+	}
+	for _, e := range elapsed {
+		if seconds, _ := strconv.ParseFloat(e[1], 64); seconds >= 0.5 {
+			t.Errorf("the second conversion shows %ss elapsed, its timing carried on from the first", e[1])
+		}
+	}
+}
+
+func TestRelativeElementIndices(t *testing.T) {
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 1 0\nvt 0 0\nvt 1 0\nl -4/-2 -3/-1\nf 2/1 3/2 4/1\nv 2 2 0\np -1 -5\n"
+	for _, flags := range [][]string{nil, {"-stream"}} {
+		file := convertOBJ(t, obj, flags...)
+		if len(file.polylines) != 1 || !slices.Equal(file.polylines[0].v, []uint32{0, 1}) || !slices.Equal(file.polylines[0].uv, []uint32{0, 1}) {
+			t.Errorf("%v: got polylines %+v, want one over vertices 0 1 and texture coords 0 1", flags, file.polylines)
+		}
+		if len(file.points) != 2 || file.points[0].v != 4 || file.points[1].v != 0 {
+			t.Errorf("%v: got points %+v, want vertices 4 and 0", flags, file.points)
+		}
+	}
+}
+
+func TestIndexOnePastTheEndIsRejected(t *testing.T) {
+	for _, face := range []string{"f 1 2 4", "f 1/1 2/2 3/4", "f 1//1 2//1 3//2"} {
+		dir := writeFiles(t, map[string]string{"in.obj": "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\nvn 0 0 1\n" + face + "\n"})
+		resetCommandLine()
+		var log bytes.Buffer
+		logOutput = &log
+		if err := Convert([]string{filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx")}); err == nil {
+			t.Errorf("%q converted without error", face)
+		}
+		if !strings.Contains(log.String(), "Face on line 8 references") {
+			t.Errorf("%q: log %q does not report the face", face, log.String())
+		}
+	}
+}
+
+func TestConvertQuadToTrianglesSplitsTangentIndices(t *testing.T) {
+	resetCommandLine()
+	m := NewMesh()
+	m.vertices = []Vertex{{X: 0, Y: 0, W: 1}, {X: 1, Y: 0, W: 1}, {X: 1, Y: 1, W: 1}, {X: 0, Y: 1, W: 1}}
+	// Each tangent index is its vertex index plus 10, so a split corner shows up as a mismatch.
+	m.faces = []Face{{edges: 4, v: []uint32{0, 1, 2, 3}, t: []uint32{10, 11, 12, 13}}}
+	m.ConvertQuadToTriangles(&m.faces[0])
+
+	if len(m.faces) != 2 {
+		t.Fatalf("got %d faces, want the quad split in two", len(m.faces))
+	}
+	for i, f := range m.faces {
+		if f.edges != 3 || len(f.v) != 3 || len(f.t) != 3 {
+			t.Fatalf("face %d has %d edges, %d vertices and %d tangents, want 3 of each", i, f.edges, len(f.v), len(f.t))
+		}
+		for j := range f.v {
+			if f.t[j] != f.v[j]+10 {
+				t.Errorf("face %d corner %d has vertex %d and tangent %d, want tangent %d", i, j, f.v[j], f.t[j], f.v[j]+10)
+			}
+		}
+	}
+}
+
+func TestClampIndicesRecovers(t *testing.T) {
+	obj := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nf 1 2 3\nf 2 3 9\n"
+	for _, c := range []struct {
+		mode  string
+		faces [][]uint32
+	}{
+		{"clamp", [][]uint32{{0, 1, 2}, {1, 2, 3}}},
+		{"wrap", [][]uint32{{0, 1, 2}, {1, 2, 0}}},
+		{"drop", [][]uint32{{0, 1, 2}}},
+	} {
+		file := convertOBJ(t, obj, "-clamp-indices", c.mode, "-keepunused")
+		if len(file.faces) != len(c.faces) {
+			t.Errorf("-clamp-indices %s: got %d faces, want %d", c.mode, len(file.faces), len(c.faces))
+			continue
+		}
+		for i, f := range file.faces {
+			if !slices.Equal(f.v, c.faces[i]) {
+				t.Errorf("-clamp-indices %s: face %d uses %v, want %v", c.mode, i, f.v, c.faces[i])
+			}
+		}
+	}
+}
+
+func TestAutoUnify(t *testing.T) {
+	// Two triangles of a square, the shared corners use the same texture coords in both.
+	seamless := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 1 1\nvt 0 1\nf 1/1 2/2 3/3\nf 1/1 3/3 4/4\n"
+	file := convertOBJ(t, seamless, "-auto-unify")
+	if file.header.indexType != INDEX_UNIFIED {
+		t.Fatalf("index type %d, want unified", file.header.indexType)
+	}
+	if len(file.textureCoords) != len(file.vertices) {
+		t.Fatalf("got %d texture coords for %d vertices, want one each", len(file.textureCoords), len(file.vertices))
+	}
+	for i, v := range file.vertices {
+		if uv := file.textureCoords[i]; uv.U != v.X || uv.V != v.Y {
+			t.Errorf("vertex %d at %g,%g has texture coord %g,%g, want the same", i, v.X, v.Y, uv.U, uv.V)
+		}
+	}
+
+	// A seam gives the first corner of the second triangle its own texture coord.
+	seam := strings.Replace(seamless, "f 1/1 3/3 4/4", "vt 0.5 0.5\nf 1/5 3/3 4/4", 1)
+	file = convertOBJ(t, seam, "-auto-unify")
+	if file.header.indexType != INDEX_SEPARATE {
+		t.Errorf("index type %d at a texture seam, want separate", file.header.indexType)
+	}
+	if len(file.vertices) != 4 || len(file.textureCoords) != 5 {
+		t.Errorf("got %d vertices and %d texture coords, want 4 and 5", len(file.vertices), len(file.textureCoords))
+	}
+}
+
+func TestUndefinedUsemtlGetsDefaultMaterial(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"in.obj": "mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 1 0\nusemtl red\nf 1 2 3\nusemtl missing\nf 2 4 3\n",
+		"in.mtl": "newmtl red\nKd 1 0 0\n",
+	})
+	resetCommandLine()
+	var log bytes.Buffer
+	logOutput = &log
+	output := filepath.Join(dir, "out.mshx")
+	if err := Convert([]string{"-le", filepath.Join(dir, "in.obj"), output}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log.String(), "Material missing is not defined") {
+		t.Errorf("the undefined material was not reported, log was %q", log.String())
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := readOutput(t, data)
+	if len(file.materials) != 2 || len(file.faces) != 2 {
+		t.Fatalf("got %d materials and %d faces, want red and the default for 2 faces", len(file.materials), len(file.faces))
+	}
+	if got := file.materials[file.faces[0].materialID].diffuse; got != [3]float32{1, 0, 0} {
+		t.Errorf("the red face has diffuse %v", got)
+	}
+	if got := file.materials[file.faces[1].materialID].diffuse; got != [3]float32{1, 1, 1} {
+		t.Errorf("the face using the undefined material has diffuse %v, want the white default", got)
+	}
+}
+
+func TestTabsSeparateTokens(t *testing.T) {
+	spaced := writeFiles(t, map[string]string{
+		"in.obj": "mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\nusemtl red\nf 1/1 2/2 3/3\n",
+		"in.mtl": "newmtl red\nKd 1 0.5 0.25\n",
+	})
+	tabbed := writeFiles(t, map[string]string{
+		"in.obj": "mtllib\tin.mtl\nv\t0\t0 \t0\nv  1\t\t0 0\n\tv 0 1 0\nvt\t0\t0\nvt 1\t0\nvt\t0 1\nusemtl\tred\nf\t1/1\t2/2 \t3/3\t\n",
+		"in.mtl": "newmtl\tred\n\tKd\t1 \t0.5\t0.25\n",
+	})
+	want := convertFile(t, spaced, "in.obj")
+	if got := convertFile(t, tabbed, "in.obj"); !bytes.Equal(got, want) {
+		t.Error("tab separated lines converted differently from space separated ones")
+	}
+}
+
+func TestSortDepthOrdersFacesFrontToBack(t *testing.T) {
+	var obj strings.Builder
+	for _, z := range []int{5, 1, 3} {
+		fmt.Fprintf(&obj, "v 0 0 %d\nv 1 0 %d\nv 0 1 %d\n", z, z, z)
+	}
+	obj.WriteString("f 1 2 3\nf 4 5 6\nf 7 8 9\n")
+	for _, c := range []struct {
+		camera string
+		want   []float32
+	}{
+		{"cam=0,0,0 dir=0,0,1", []float32{1, 3, 5}},
+		{"cam=0,0,10 dir=0,0,-1", []float32{5, 3, 1}},
+	} {
+		file := convertOBJ(t, obj.String(), "-sort-depth", c.camera)
+		if len(file.faces) != 3 {
+			t.Fatalf("got %d faces, want 3", len(file.faces))
+		}
+		for i, f := range file.faces {
+			if z := file.vertices[f.v[0]].Z; z != c.want[i] {
+				t.Errorf("-sort-depth %q: face %d is at depth %g, want %g", c.camera, i, z, c.want[i])
+			}
+		}
+	}
+}
+
+func TestPose2VelocitiesAreThePoseDifferences(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"in.obj":    "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n",
+		"pose2.obj": "v 0.5 0 0\nv 1 2 0\nv 0 1 -3\n",
+	})
+	file := readOutput(t, convertFile(t, dir, "in.obj", "-pose2", filepath.Join(dir, "pose2.obj")))
+	if file.header.vertexType&VERTEX_VELOCITY == 0 {
+		t.Fatal("the output has no velocities")
+	}
+	want := map[[3]float32][3]float32{
+		{0, 0, 0}: {0.5, 0, 0},
+		{1, 0, 0}: {0, 2, 0},
+		{0, 1, 0}: {0, 0, -3},
+	}
+	if len(file.vertices) != len(want) {
+		t.Fatalf("got %d vertices, want %d", len(file.vertices), len(want))
+	}
+	for _, v := range file.vertices {
+		if got := v.velocity; got != want[[3]float32{v.X, v.Y, v.Z}] {
+			t.Errorf("vertex at %g,%g,%g has velocity %v, want %v", v.X, v.Y, v.Z, got, want[[3]float32{v.X, v.Y, v.Z}])
+		}
+	}
+}
+
+// Run the converter as a separate process, as a script would, and return its exit code.
+func runMain(t *testing.T, args ...string) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "OBJCONV_RUN_MAIN=1")
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return 0
+}
+
+func TestFailedConversionExitsNonZero(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"good.obj": "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n",
+		"bad.obj":  "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4\n",
+	})
+	if code := runMain(t, filepath.Join(dir, "good.obj"), filepath.Join(dir, "good.mshx")); code != 0 {
+		t.Errorf("a good conversion exited with %d", code)
+	}
+	for _, input := range []string{"bad.obj", "missing.obj"} {
+		if code := runMain(t, filepath.Join(dir, input), filepath.Join(dir, "out.mshx")); code == 0 {
+			t.Errorf("converting %s exited with 0", input)
+		}
+	}
+}
+
+func TestSubcommandsHaveTheirOwnFlags(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"good.obj": "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n",
+		"bad.obj":  "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4\n",
+	})
+	good, bad, output := filepath.Join(dir, "good.obj"), filepath.Join(dir, "bad.obj"), filepath.Join(dir, "good.mshx")
+	if code := runMain(t, "convert", "-le", good, output); code != 0 {
+		t.Fatalf("convert exited with %d", code)
+	}
+	for _, c := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"validate", good}, 0},
+		{[]string{"validate", bad}, 1},
+		{[]string{"validate", "-silent", "-planartol", "0.5", "-noconvex", "-maxline", "1", "-encoding", "latin1", good}, 0},
+		// Flags of the convert subcommand are unknown to the others.
+		{[]string{"validate", "-le", good}, 2},
+		{[]string{"inspect", "-full", output}, 0},
+		{[]string{"inspect", "-silent", output}, 2},
+	} {
+		if code := runMain(t, c.args...); code != c.want {
+			t.Errorf("objconv %v exited with %d, want %d", c.args, code, c.want)
+		}
+	}
+
+	// The deprecated -validate flag still validates without writing anything.
+	resetCommandLine()
+	var log bytes.Buffer
+	logOutput = &log
+	if err := Convert([]string{"-validate", good, filepath.Join(dir, "unwritten.mshx")}); err != nil {
+		t.Errorf("-validate failed on a good file: %v", err)
+	}
+	if !strings.Contains(log.String(), "-validate is deprecated") {
+		t.Errorf("-validate was not reported as deprecated, log %q", log.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unwritten.mshx")); !os.IsNotExist(err) {
+		t.Errorf("-validate wrote an output file")
+	}
+}
+
+func TestSilentPrintsNothing(t *testing.T) {
+	// The unused normal gives a warning as well as the usual progress messages.
+	dir := writeFiles(t, map[string]string{"in.obj": "v 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nf 1 2 3\n"})
+	for _, c := range []struct {
+		args  []string
+		quiet bool
+	}{
+		{nil, false},
+		{[]string{"-silent"}, true},
+		{[]string{"-silent", "-vv"}, true},
+	} {
+		resetCommandLine()
+		var log bytes.Buffer
+		logOutput = &log
+		args := append(append([]string{}, c.args...), filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx"))
+		if err := Convert(args); err != nil {
+			t.Fatal(err)
+		}
+		if quiet := log.Len() == 0; quiet != c.quiet {
+			t.Errorf("%v printed %q", c.args, log.String())
+		}
+	}
+
+	// Nothing reaches stdout or stderr from the process either.
+	cmd := exec.Command(os.Args[0], "-silent", filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx"))
+	cmd.Env = append(os.Environ(), "OBJCONV_RUN_MAIN=1")
+	if output, err := cmd.CombinedOutput(); err != nil || len(output) > 0 {
+		t.Errorf("-silent printed %q, error %v", output, err)
+	}
+}
+
+func TestQuadHalvesDotDegenerateQuad(t *testing.T) {
+	resetCommandLine()
+	m := NewMesh()
+	// Corners 0 and 1 coincide, so the first half has no area.
+	m.vertices = []Vertex{{W: 1}, {W: 1}, {X: 1, Y: 1, W: 1}, {Y: 1, W: 1}}
+	f := Face{edges: 4, v: []uint32{0, 1, 2, 3}}
+	if dot := m.quadHalvesDot(&f); dot != 0 {
+		t.Errorf("a degenerate quad gave %g, want 0", dot)
+	}
+	if m.quadPlanar(&f) {
+		t.Error("a degenerate quad counts as planar")
+	}
+	if err := m.ValidateQuad(&f); err == nil || strings.Contains(err.Error(), "NaN") {
+		t.Errorf("validating a degenerate quad gave %v", err)
+	}
+}
+
+func TestConcaveQuadSplitsAlongInsideDiagonal(t *testing.T) {
+	resetCommandLine()
+	m := NewMesh()
+	// Corner 1 is reflex, so the 0-2 diagonal runs outside the quad beneath it.
+	m.vertices = []Vertex{{X: 0, Y: 0, W: 1}, {X: 2, Y: 1, W: 1}, {X: 4, Y: 0, W: 1}, {X: 2, Y: 4, W: 1}}
+	m.faces = []Face{{edges: 4, v: []uint32{0, 1, 2, 3}}}
+	m.ConvertQuadToTriangles(&m.faces[0])
+
+	if len(m.faces) != 2 {
+		t.Fatalf("got %d faces, want the quad split in two", len(m.faces))
+	}
+	for i, f := range m.faces {
+		if !slices.Contains(f.v, 1) || !slices.Contains(f.v, 3) {
+			t.Errorf("face %d uses %v, want the 1-3 diagonal", i, f.v)
+		}
+		a, b, c := m.vertices[f.v[0]], m.vertices[f.v[1]], m.vertices[f.v[2]]
+		if area := (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X); area <= 0 {
+			t.Errorf("face %d uses %v, which faces away from the quad", i, f.v)
+		}
+	}
+}
+
+func TestValidQuadsAreKept(t *testing.T) {
+	// A flat square beside a square with one corner lifted well out of its plane.
+	obj := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nv 2 0 0\nv 3 0 0\nv 3 1 1\nv 2 1 0\n" +
+		"vt 0 0\nvt 1 0\nvt 1 1\nvt 0 1\nvn 0 0 1\n" +
+		"f 1/1/1 2/2/1 3/3/1 4/4/1\nf 5/1/1 6/2/1 7/3/1 8/4/1\n"
+	for _, q := range []string{"1", "2"} {
+		file := convertOBJ(t, obj, "-q", q)
+		if len(file.faces) != 3 {
+			t.Fatalf("-q %s: wrote %d faces, want the flat quad and the bent one split in two", q, len(file.faces))
+		}
+		var quads int = 0
+		for i, f := range file.faces {
+			if len(f.v) != int(f.edges) || len(f.n) != int(f.edges) || len(f.uv) != int(f.edges) {
+				t.Errorf("-q %s: face %d has %d edges with %d vertex, %d normal and %d texture coord indices", q, i, f.edges, len(f.v), len(f.n), len(f.uv))
+			}
+			if f.edges == 4 {
+				quads++
+				if !slices.Equal(f.v, []uint32{0, 1, 2, 3}) {
+					t.Errorf("-q %s: the quad uses vertices %v, want 0 1 2 3", q, f.v)
+				}
+			}
+		}
+		if quads != 1 {
+			t.Errorf("-q %s: wrote %d quads, want only the flat one", q, quads)
+		}
+	}
+}
+
+func TestTrailingCommentsAreIgnored(t *testing.T) {
+	plain := writeFiles(t, map[string]string{
+		"in.obj": "mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nusemtl red\nf 1//1 2//1 3//1\n",
+		"in.mtl": "newmtl red\nKd 1 0 0\nNs 10\n",
+	})
+	commented := writeFiles(t, map[string]string{
+		"in.obj": "mtllib in.mtl # materials\nv 0 0 0 # origin\nv 1 0 0#x\nv 0 1 0\t# y\nvn 0 0 1 # up\nusemtl red # the only one\nf 1//1 2//1 3//1 # 4//1\n",
+		"in.mtl": "newmtl red # plain red\nKd 1 0 0 # 0.5 0.5 0.5\nNs 10#0\n",
+	})
+	want := convertFile(t, plain, "in.obj")
+	if got := convertFile(t, commented, "in.obj"); !bytes.Equal(got, want) {
+		t.Error("lines with trailing comments converted differently from the same lines without them")
+	}
+
+	for line, want := range map[string]string{
+		"Kd 1 1 1 # white":       "Kd 1 1 1 ",
+		`usemtl "a#b" # comment`: `usemtl "a#b" `,
+		"# whole line":           "",
+		"f 1 2 3":                "f 1 2 3",
+	} {
+		if got := StripComment(line); got != want {
+			t.Errorf("StripComment(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestUnifySplitsVertexWithTwoNormals(t *testing.T) {
+	// Vertices 1 and 2 are on a hard edge, each face gives them its own normal.
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nv 0 0 1\nvn 0 0 1\nvn 0 1 0\nf 1//1 2//1 3//1\nf 2//2 1//2 4//2\n"
+	file := convertOBJ(t, obj, "-unify")
+	if file.header.indexType != INDEX_UNIFIED {
+		t.Fatalf("index type %d, want unified", file.header.indexType)
+	}
+	if len(file.vertices) != 6 || len(file.normals) != 6 {
+		t.Fatalf("got %d vertices and %d normals, want the 2 shared vertices split into 6 of each", len(file.vertices), len(file.normals))
+	}
+	for i, f := range file.faces {
+		want := [][3]float32{{0, 0, 1}, {0, 1, 0}}[i]
+		for j, v := range f.v {
+			if n := file.normals[v]; n.X != want[0] || n.Y != want[1] || n.Z != want[2] {
+				t.Errorf("face %d corner %d has normal %g,%g,%g, want %v", i, j, n.X, n.Y, n.Z, want)
+			}
+		}
+	}
+	if file.faces[0].v[0] == file.faces[1].v[1] || file.faces[0].v[1] == file.faces[1].v[0] {
+		t.Errorf("the faces %v and %v still share a vertex with different normals", file.faces[0].v, file.faces[1].v)
+	}
+}
+
+// Convert in.obj in dir, returning the file read back and everything logged.
+func convertLogged(t *testing.T, dir string, args ...string) (*MSHXFile, string) {
+	t.Helper()
+	resetCommandLine()
+	var log bytes.Buffer
+	logOutput = &log
+	output := filepath.Join(dir, "out.mshx")
+	if err := Convert(append(append([]string{}, args...), filepath.Join(dir, "in.obj"), output)); err != nil {
+		t.Fatalf("converting %v: %v, log %q", args, err, log.String())
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return readOutput(t, data), log.String()
+}
+
+func TestEmptyOBJWritesEmptyMesh(t *testing.T) {
+	for _, flags := range [][]string{nil, {"-mo", "-d", "-gennormals", "-gentangents", "-q", "3"}} {
+		dir := writeFiles(t, map[string]string{"in.obj": "# nothing here\n"})
+		file, log := convertLogged(t, dir, flags...)
+		if !strings.Contains(log, "has no geometry") {
+			t.Errorf("%v: an empty OBJ was not reported, log %q", flags, log)
+		}
+		if h := file.header; h.vertexCount != 0 || h.normalCount != 0 || h.uvCount != 0 || h.faceCount != 0 {
+			t.Errorf("%v: header has %d vertices, %d normals, %d texture coords and %d faces, want none", flags, h.vertexCount, h.normalCount, h.uvCount, h.faceCount)
+		}
+	}
+}
+
+func TestVerticesOnlyOBJ(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": "v 0 0 0\nv 1 0 0\nv 0 1 0\n"})
+	file, log := convertLogged(t, dir, "-keepunused")
+	if !strings.Contains(log, "has 3 vertices but no faces") {
+		t.Errorf("the missing faces were not reported, log %q", log)
+	}
+	if len(file.vertices) != 3 || len(file.faces) != 0 {
+		t.Errorf("got %d vertices and %d faces, want 3 and none", len(file.vertices), len(file.faces))
+	}
+	if box := file.header.box; box.max.X != 1 || box.max.Y != 1 {
+		t.Errorf("box %v to %v does not hold the vertices", box.min, box.max)
+	}
+}
+
+// Gzip the text.
+func gzipText(t *testing.T, text string) string {
+	t.Helper()
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestGzipInputMatchesPlainInput(t *testing.T) {
+	obj := "mtllib in.mtl\nusemtl red\n" + cubeOBJ
+	mtl := "newmtl red\nKd 1 0 0\n"
+	plain := writeFiles(t, map[string]string{"in.obj": obj, "in.mtl": mtl})
+	// The compressed OBJ also uses a compressed library, both are found by their magic bytes.
+	compressed := writeFiles(t, map[string]string{"in.obj.gz": gzipText(t, strings.Replace(obj, "in.mtl", "in.mtl.gz", 1)), "in.mtl.gz": gzipText(t, mtl)})
+	want := convertFile(t, plain, "in.obj")
+	if got := convertFile(t, compressed, "in.obj.gz"); !bytes.Equal(got, want) {
+		t.Error("converting the .obj.gz gave different output from the plain .obj")
+	}
+}
+
+func TestMergingFilesOffsetsIndices(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.obj":  "mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\nvn 0 0 1\nusemtl red\nf 1/1/1 2/2/1 3/3/1\n",
+		"b.obj":  "mtllib in.mtl\nv 5 0 0\nv 6 0 0\nv 5 1 0\nvt 0.5 0\nvt 1 0.5\nvt 0 0.5\nvn 0 1 0\nusemtl red\nf 3/3/1 1/1/1 2/2/1\n",
+		"in.mtl": "newmtl red\nKd 1 0 0\n",
+	})
+	resetCommandLine()
+	output := filepath.Join(dir, "out.mshx")
+	if err := Convert([]string{"-keepunused", filepath.Join(dir, "a.obj"), filepath.Join(dir, "b.obj"), output}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := readOutput(t, data)
+	if len(file.vertices) != 6 || len(file.textureCoords) != 6 || len(file.normals) != 2 || len(file.faces) != 2 {
+		t.Fatalf("got %d vertices, %d texture coords, %d normals and %d faces, want 6, 6, 2 and 2", len(file.vertices), len(file.textureCoords), len(file.normals), len(file.faces))
+	}
+	second := file.faces[1]
+	if !slices.Equal(second.v, []uint32{5, 3, 4}) || !slices.Equal(second.uv, []uint32{5, 3, 4}) || !slices.Equal(second.n, []uint32{1, 1, 1}) {
+		t.Errorf("the second file's face uses %v/%v/%v, want its indices moved past the first file's", second.v, second.uv, second.n)
+	}
+	if v := file.vertices[second.v[1]]; v.X != 5 || v.Y != 0 {
+		t.Errorf("the second file's first vertex is at %g,%g, want 5,0", v.X, v.Y)
+	}
+	if len(file.materials) != 1 || file.faces[0].materialID != file.faces[1].materialID {
+		t.Errorf("got %d materials, want red shared by both files", len(file.materials))
+	}
+}
+
+func TestRenderingAttributesAreIgnored(t *testing.T) {
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"
+	attributes := "bevel on\nc_interp off\nd_interp on\nlod 3\nshadow_obj shadow.obj\ntrace_obj trace.obj\n"
+	plain := writeFiles(t, map[string]string{"in.obj": obj})
+	with := writeFiles(t, map[string]string{"in.obj": attributes + obj})
+	want := convertFile(t, plain, "in.obj")
+	if got := convertFile(t, with, "in.obj"); !bytes.Equal(got, want) {
+		t.Error("the rendering attributes changed the output")
+	}
+
+	_, log := convertLogged(t, with, "-le")
+	if strings.Contains(log, "Warning") {
+		t.Errorf("the rendering attributes gave warnings, log %q", log)
+	}
+	if !strings.Contains(log, "sets lod 3") {
+		t.Errorf("the lod level was not reported as a hint, log %q", log)
+	}
+
+	for _, lod := range []string{"lod 200", "lod -1", "lod", "lod high"} {
+		_, log := convertLogged(t, writeFiles(t, map[string]string{"in.obj": lod + "\n" + obj}), "-le")
+		if !strings.Contains(log, "Warning: Line 1:") {
+			t.Errorf("%q was not reported, log %q", lod, log)
+		}
+	}
+}
+
+func TestOutputNamedAfterInput(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"cube.obj": cubeOBJ})
+	resetCommandLine()
+	if err := Convert([]string{"-le", filepath.Join(dir, "cube.obj")}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "cube.mshx"))
+	if err != nil {
+		t.Fatalf("cube.obj was not written as cube.mshx: %v", err)
+	}
+	if file := readOutput(t, data); len(file.vertices) != 8 {
+		t.Errorf("cube.mshx has %d vertices, want 8", len(file.vertices))
+	}
+
+	for _, c := range []struct {
+		input  string
+		args   []string
+		output string
+	}{
+		{"cube.obj", []string{"-gzout"}, "cube.mshx.gz"},
+		{"cube.obj.gz", nil, "cube.mshx"},
+		{"models/cube.obj", []string{"-outdir", "out"}, "out/cube.mshx"},
+		{"cube.obj", []string{"-format", "ply"}, "cube.ply"},
+	} {
+		_, outputFileName := parseCommandLine(t, append(c.args, c.input)...)
+		if outputFileName != filepath.FromSlash(c.output) {
+			t.Errorf("%v %s is written to %s, want %s", c.args, c.input, outputFileName, c.output)
+		}
+	}
+}
+
+func TestBatchMatchesSingleConversions(t *testing.T) {
+	// Each file has its own materials and counts, so anything one conversion left behind would
+	// show in the next file's output.
+	inputs := map[string]string{
+		"a.obj":  "mtllib in.mtl\nusemtl red\n" + cubeOBJ,
+		"b.obj":  gridOBJ(3),
+		"c.obj":  "mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nusemtl blue\nf 1 2 3\n",
+		"in.mtl": "newmtl red\nKd 1 0 0\nnewmtl blue\nKd 0 0 1\n",
+	}
+	dir := writeFiles(t, inputs)
+	resetCommandLine()
+	outDir := filepath.Join(dir, "batch")
+	if err := Convert([]string{"-le", "-outdir", outDir, "-batch", filepath.Join(dir, "*.obj")}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		got, err := os.ReadFile(filepath.Join(outDir, name+".mshx"))
+		if err != nil {
+			t.Fatalf("%s.obj was not converted: %v", name, err)
+		}
+		if want := convertFile(t, dir, name+".obj"); !bytes.Equal(got, want) {
+			t.Errorf("the batch output of %s.obj differs from converting it on its own", name)
+		}
+	}
+}
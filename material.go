@@ -0,0 +1,531 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Replace any characters in a material name which may be unsafe for file systems or engines.
+func SanitizeName(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune('_')
+		}
+	}
+	return sb.String()
+}
+
+// Return the name to use for a material, sanitizing it when requested and warning when
+// two different names sanitize to the same result.
+func (m *Mesh) MaterialName(name string) string {
+	if !*sanitizeNamesPtr {
+		return name
+	}
+	var safe string = SanitizeName(name)
+	if original, ok := m.sanitizedNames[safe]; ok && original != name {
+		Logf(LOG_WARN, "Warning: Material names %q and %q both sanitize to %q.\n", original, name, safe)
+	} else if !ok {
+		m.sanitizedNames[safe] = name
+		if safe != name {
+			Logf(LOG_VERBOSE, "Sanitized material name %q to %q\n", name, safe)
+		}
+	}
+	return safe
+}
+
+// Find the index of a named material. Unknown names are assigned a default material, added
+// the first time it is needed, so missing materials are visible rather than using material 0.
+func (m *Mesh) ResolveMaterial(name string) uint32 {
+	if idx, ok := m.materialMap[name]; ok {
+		return idx
+	}
+	if name == "" && len(m.materials) == 0 {
+		// Nothing else to draw the faces with, so this is not worth a warning.
+		Logf(LOG_VERBOSE, "Faces have no usemtl, assigning the default material.\n")
+	} else if name == "" {
+		Logf(LOG_WARN, "Warning: Face has no usemtl, assigning the default material.\n")
+	} else {
+		Logf(LOG_WARN, "Warning: Material %s is not defined, assigning the default material.\n", name)
+	}
+	idx, ok := m.materialMap[DEFAULT_MATERIAL_NAME]
+	if !ok {
+		m.materials = append(m.materials, Material{name: DEFAULT_MATERIAL_NAME, diffuse: [3]float32{1, 1, 1}})
+		idx = uint32(len(m.materials) - 1)
+		m.materialMap[DEFAULT_MATERIAL_NAME] = idx
+	}
+	// Remember the assignment so the warning is only given once per name.
+	m.materialMap[name] = idx
+	return idx
+}
+
+// Replace the material table with the material of the first face and point every face and
+// material name at it, so the mesh can be drawn in one call.
+func (m *Mesh) FlattenMaterials() {
+	if len(m.materials) <= 1 {
+		return
+	}
+	var first uint32 = 0
+	if len(m.faces) > 0 {
+		first = m.faces[0].materialID
+	}
+	kept := m.materials[first]
+	Logf(LOG_INFO, "Flattened %d materials into %s\n", len(m.materials), kept.name)
+	m.materials = []Material{kept}
+	for name := range m.materialMap {
+		m.materialMap[name] = 0
+	}
+	for i := range m.faces {
+		m.faces[i].materialID = 0
+		m.faces[i].materialName = kept.name
+	}
+}
+
+// Convert an sRGB encoded channel to linear with the piecewise sRGB transfer curve.
+func srgbToLinear(c float32) float32 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return float32(math.Pow((float64(c)+0.055)/1.055, 2.4))
+}
+
+// Encode a linear channel with the piecewise sRGB transfer curve, the inverse of srgbToLinear.
+func linearToSRGB(c float32) float32 {
+	if c <= 0.0031308 {
+		return c * 12.92
+	}
+	return float32(1.055*math.Pow(float64(c), 1/2.4) - 0.055)
+}
+
+// Convert the material colours authored in sRGB to linear, the scalar properties and the
+// transmission filter are left as they are.
+func (m *Mesh) LinearizeMaterials() {
+	for i := range m.materials {
+		for _, c := range []*[3]float32{&m.materials[i].diffuse, &m.materials[i].specular, &m.materials[i].ambient, &m.materials[i].emissive} {
+			for j := range c {
+				c[j] = srgbToLinear(c[j])
+			}
+		}
+	}
+	Logf(LOG_INFO, "Converted the colours of %d materials from sRGB to linear\n", len(m.materials))
+}
+
+// Reorder the material table, either by name or following the names listed in orderFileName.
+// Materials missing from the list follow on sorted by name, those used by a face before those
+// which are not, so adding an unused material to the MTL file never moves a used one. The
+// faces are resolved first so the default material is sorted with the rest, and every name in
+// the map, including ones resolved to the default, is moved to the new index.
+func (m *Mesh) SortMaterials(orderFileName string) error {
+	var rank map[string]int = make(map[string]int)
+	if orderFileName != "name" {
+		data, err := os.ReadFile(orderFileName)
+		if err != nil {
+			Logf(LOG_ERROR, "Error reading material order file %s: %v\n", orderFileName, err)
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			name := strings.TrimSpace(line)
+			if name == "" || name[0] == '#' {
+				continue
+			}
+			name = m.MaterialName(name)
+			if _, ok := m.materialMap[name]; !ok {
+				Logf(LOG_WARN, "Warning: Material %s in %s is not defined, ignoring.\n", name, orderFileName)
+				continue
+			}
+			if _, ok := rank[name]; !ok {
+				rank[name] = len(rank)
+			}
+		}
+	}
+
+	used := make([]bool, len(m.materials))
+	for i := range m.faces {
+		idx := m.ResolveMaterial(m.faces[i].materialName)
+		if int(idx) >= len(used) {
+			used = append(used, make([]bool, int(idx)+1-len(used))...)
+		}
+		used[idx] = true
+	}
+
+	order := make([]int, len(m.materials))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		ra, aListed := rank[m.materials[a].name]
+		rb, bListed := rank[m.materials[b].name]
+		switch {
+		case aListed && bListed:
+			return ra - rb
+		case aListed:
+			return -1
+		case bListed:
+			return 1
+		case used[a] != used[b]:
+			if used[a] {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(m.materials[a].name, m.materials[b].name)
+	})
+	remap := make([]uint32, len(m.materials))
+	sorted := make([]Material, len(m.materials))
+	for i, old := range order {
+		remap[old] = uint32(i)
+		sorted[i] = m.materials[old]
+	}
+	m.materials = sorted
+	for name, idx := range m.materialMap {
+		m.materialMap[name] = remap[idx]
+	}
+	Logf(LOG_VERBOSE, "Material order:")
+	for i := range m.materials {
+		Logf(LOG_VERBOSE, " %s", m.materials[i].name)
+	}
+	Logf(LOG_VERBOSE, "\n")
+	return nil
+}
+
+// Parse the colour of a Ka/Kd/Ks/Ke/Tf line given as 'r g b', a single 'r' used for all three
+// channels, or 'xyz x y z' which is converted from CIE XYZ to sRGB encoded like the RGB forms,
+// so -linearize treats them alike. Spectral curves from .rfl files are not supported.
+func ParseMaterialColor(lineParts []string) ([3]float32, error) {
+	var c [3]float32
+	if len(lineParts) > 1 && lineParts[1] == "spectral" {
+		return c, fmt.Errorf("spectral %s colours are not supported, only RGB and xyz", lineParts[0])
+	}
+	values := lineParts[1:]
+	if len(values) > 0 && values[0] == "xyz" {
+		values = values[1:]
+	}
+	if len(values) == 0 {
+		return c, fmt.Errorf("%s has no colour values", lineParts[0])
+	}
+	for i := 0; i < 3; i++ {
+		// A single value applies to every channel.
+		var value string = values[0]
+		if i < len(values) {
+			value = values[i]
+		}
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return c, fmt.Errorf("invalid %s colour value %q", lineParts[0], value)
+		}
+		c[i] = float32(f)
+	}
+	if lineParts[1] == "xyz" {
+		x, y, z := c[0], c[1], c[2]
+		c[0] = 3.2404542*x - 1.5371385*y - 0.4985314*z
+		c[1] = -0.9692660*x + 1.8760108*y + 0.0415560*z
+		c[2] = 0.0556434*x - 0.2040259*y + 1.0572252*z
+		for i := range c {
+			c[i] = linearToSRGB(c[i])
+		}
+	}
+	return c, nil
+}
+
+// Opens the material library named on an 'mtllib' line, after the name has been made relative
+// to the OBJ file. Replace it to read the libraries of an OBJ parsed from memory or a stream.
+var OpenMaterialFile func(materialFileName string) (io.ReadCloser, error) = func(materialFileName string) (io.ReadCloser, error) {
+	return os.Open(materialFileName)
+}
+
+func (m *Mesh) ProcessMaterialFile(materialFileName string, baseDir string) error {
+
+	// Relative paths are relative to the OBJ file, not the working directory.
+	if !filepath.IsAbs(materialFileName) {
+		materialFileName = filepath.Join(baseDir, materialFileName)
+	}
+
+	// Inputs merged together often share a library, read each one once.
+	if m.loadedMaterialFiles[materialFileName] {
+		return nil
+	}
+	m.loadedMaterialFiles[materialFileName] = true
+
+	// Open material file.
+	materialFile, err := OpenMaterialFile(materialFileName)
+	if err != nil {
+		Logf(LOG_ERROR, "Error opening material file %s: %v\n", materialFileName, err)
+		return err
+	}
+	defer materialFile.Close()
+	return m.ParseMaterialFile(materialFile, materialFileName)
+}
+
+// Read the materials of an MTL file, the name is only used in messages.
+func (m *Mesh) ParseMaterialFile(materialFile io.Reader, materialFileName string) error {
+	materialReader, err := DecompressInput(materialFile, materialFileName)
+	if err != nil {
+		return err
+	}
+
+	var inMaterial bool = false
+	var materialName string
+	var matIdx uint32
+	// 'd' and 'Tr' store the same property with opposite conventions, 'd' wins when both are given.
+	var hasDissolve, hasTr bool
+
+	var scanner LineScanner = NewLineScanner(materialReader)
+	for scanner.Scan() {
+		var line string = strings.Trim(StripComment(scanner.Text()), " \t")
+		// If the line is empty or only a comment, skip it.
+		if len(line) == 0 {
+			continue
+		}
+		// Any run of spaces or tabs separates tokens, normalise the line to single spaces
+		// so the Sscanf formats below match.
+		lineParts := strings.Fields(line)
+		line = strings.Join(lineParts, " ")
+		switch lineParts[0] {
+		case "newmtl":
+			inMaterial = true
+			hasDissolve, hasTr = false, false
+			materialName = m.MaterialName(strings.TrimSpace(line[len("newmtl"):]))
+			if !utf8.ValidString(materialName) {
+				Logf(LOG_WARN, "Warning: Material name %q in %s is not UTF-8, use -encoding to convert it.\n", materialName, materialFileName)
+			}
+			if idx, ok := m.materialMap[materialName]; ok {
+				// Later definitions are merged into earlier ones in place, the properties they set
+				// override the earlier values and the rest are kept.
+				Logf(LOG_WARN, "Warning: Material %s redefined in %s, merging it into the earlier definition.\n", materialName, materialFileName)
+				matIdx = idx
+			} else {
+				m.materials = append(m.materials, Material{name: materialName})
+				matIdx = uint32(len(m.materials) - 1)
+				m.materialMap[materialName] = matIdx
+			}
+			Logf(LOG_VERBOSE, "Defining Material %s\n", materialName)
+		case "Kd":
+			if inMaterial {
+				c, err := ParseMaterialColor(lineParts)
+				if err != nil {
+					Logf(LOG_ERROR, "Error: Material %s: %v.\n", materialName, err)
+					return err
+				}
+				Logf(LOG_VERBOSE, "Diffuse: %f %f %f\n", c[0], c[1], c[2])
+				m.materials[matIdx].diffuse = c
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Ke":
+			if inMaterial {
+				c, err := ParseMaterialColor(lineParts)
+				if err != nil {
+					Logf(LOG_ERROR, "Error: Material %s: %v.\n", materialName, err)
+					return err
+				}
+				Logf(LOG_VERBOSE, "Emissive: %f %f %f\n", c[0], c[1], c[2])
+				m.materials[matIdx].emissive = c
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Ka":
+			if inMaterial {
+				c, err := ParseMaterialColor(lineParts)
+				if err != nil {
+					Logf(LOG_ERROR, "Error: Material %s: %v.\n", materialName, err)
+					return err
+				}
+				Logf(LOG_VERBOSE, "Ambient: %f %f %f\n", c[0], c[1], c[2])
+				m.materials[matIdx].ambient = c
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Ks":
+			if inMaterial {
+				c, err := ParseMaterialColor(lineParts)
+				if err != nil {
+					Logf(LOG_ERROR, "Error: Material %s: %v.\n", materialName, err)
+					return err
+				}
+				Logf(LOG_VERBOSE, "Specular: %f %f %f\n", c[0], c[1], c[2])
+				m.materials[matIdx].specular = c
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Tf":
+			if inMaterial {
+				c, err := ParseMaterialColor(lineParts)
+				if err != nil {
+					Logf(LOG_ERROR, "Error: Material %s: %v.\n", materialName, err)
+					return err
+				}
+				Logf(LOG_VERBOSE, "Transmissive: %f %f %f\n", c[0], c[1], c[2])
+				m.materials[matIdx].transmissive = c
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Ns":
+			if inMaterial {
+				var power float32
+				fmt.Sscanf(line, "Ns %f", &power)
+				Logf(LOG_VERBOSE, "Specular Power: %f\n", power)
+				m.materials[matIdx].power = power
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "d":
+			if inMaterial {
+				var t float32
+				fmt.Sscanf(line, "d %f", &t)
+				Logf(LOG_VERBOSE, "Dissolve: %f\n", t)
+				if hasTr && math.Abs(float64(m.materials[matIdx].transparency-(1.0-t))) > 1e-6 {
+					Logf(LOG_WARN, "Warning: Material %s has d %g and Tr %g which disagree, using d.\n", materialName, t, m.materials[matIdx].transparency)
+				}
+				m.materials[matIdx].transparency = 1.0 - t
+				hasDissolve = true
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Tr":
+			if inMaterial {
+				var t float32
+				fmt.Sscanf(line, "Tr %f", &t)
+				Logf(LOG_VERBOSE, "Transparency: %f\n", t)
+				if hasDissolve {
+					if math.Abs(float64(m.materials[matIdx].transparency-t)) > 1e-6 {
+						Logf(LOG_WARN, "Warning: Material %s has d %g and Tr %g which disagree, using d.\n", materialName, 1.0-m.materials[matIdx].transparency, t)
+					}
+				} else {
+					m.materials[matIdx].transparency = t
+				}
+				hasTr = true
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Ni":
+			if inMaterial {
+				var t float32
+				fmt.Sscanf(line, "Ni %f", &t)
+				Logf(LOG_VERBOSE, "Refractivity: %f\n", t)
+				m.materials[matIdx].refractivity = t
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "illum":
+			if inMaterial {
+				var i uint32
+				fmt.Sscanf(line, "illum %d", &i)
+				Logf(LOG_VERBOSE, "Illumination Mode: %d\n", i)
+				m.materials[matIdx].illum = i
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Pr":
+			if inMaterial {
+				var r float32
+				fmt.Sscanf(line, "Pr %f", &r)
+				Logf(LOG_VERBOSE, "Roughness: %f\n", r)
+				m.materials[matIdx].roughness = r
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Pm":
+			if inMaterial {
+				var p float32
+				fmt.Sscanf(line, "Pm %f", &p)
+				Logf(LOG_VERBOSE, "Metallic: %f\n", p)
+				m.materials[matIdx].metallic = p
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Ps":
+			if inMaterial {
+				var p float32
+				fmt.Sscanf(line, "Ps %f", &p)
+				Logf(LOG_VERBOSE, "Sheen: %f\n", p)
+				m.materials[matIdx].sheen = p
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Pc":
+			if inMaterial {
+				var p float32
+				fmt.Sscanf(line, "Pc %f", &p)
+				Logf(LOG_VERBOSE, "Clearcoat Thickness: %f\n", p)
+				m.materials[matIdx].clearcoat_thickness = p
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "Pcr":
+			if inMaterial {
+				var p float32
+				fmt.Sscanf(line, "Pcr %f", &p)
+				Logf(LOG_VERBOSE, "Metallic: %f\n", p)
+				m.materials[matIdx].clearcoat_roughness = p
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "aniso":
+			if inMaterial {
+				var p float32
+				fmt.Sscanf(line, "aniso %f", &p)
+				Logf(LOG_VERBOSE, "Anisotropy: %f\n", p)
+				m.materials[matIdx].aniso = p
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "anisor":
+			if inMaterial {
+				var p float32
+				fmt.Sscanf(line, "anisor %f", &p)
+				Logf(LOG_VERBOSE, "Anisotropy: %f\n", p)
+				m.materials[matIdx].aniso_rotation = p
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		case "map_Kd":
+			if inMaterial {
+				// Taken from the line as it is, scanning with %s would replace bytes which are
+				// not UTF-8.
+				var txt string
+				if fields := strings.Fields(line); len(fields) > 1 {
+					txt = fields[1]
+				}
+				Logf(LOG_VERBOSE, "Texture Map: %s\n", txt)
+				m.materials[matIdx].texture = txt
+			} else {
+				Logf(LOG_ERROR, "Error: Material properties defined outside of material block.\n")
+				return errors.New("material properties defined outside of material block")
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		LogScanError(materialFileName, err)
+		return err
+	}
+
+	return nil
+}
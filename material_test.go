@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A triangle using each of the named materials in turn from in.mtl.
+func materialOBJ(names ...string) string {
+	var b strings.Builder
+	b.WriteString("mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\n")
+	for _, name := range names {
+		b.WriteString("usemtl " + name + "\nf 1 2 3\n")
+	}
+	return b.String()
+}
+
+// Convert an OBJ using the MTL source with the flags given, returning the file read back and
+// everything logged.
+func convertMaterials(t *testing.T, obj, mtl string, args ...string) (*MSHXFile, string) {
+	t.Helper()
+	return convertLogged(t, writeFiles(t, map[string]string{"in.obj": obj, "in.mtl": mtl}), args...)
+}
+
+func TestDissolveAndTransparency(t *testing.T) {
+	tests := []struct {
+		mtl          string
+		transparency float32
+		warn         bool
+	}{
+		{"newmtl glass\nd 0.3\nTr 0.7\n", 0.7, false},
+		{"newmtl glass\nTr 0.7\nd 0.3\n", 0.7, false},
+		{"newmtl glass\nd 0.3\nTr 0.2\n", 0.7, true},
+		{"newmtl glass\nTr 0.2\nd 0.3\n", 0.7, true},
+		{"newmtl glass\nTr 0.2\n", 0.2, false},
+	}
+	for _, test := range tests {
+		file, log := convertMaterials(t, materialOBJ("glass"), test.mtl)
+		if len(file.materials) != 1 {
+			t.Fatalf("got %d materials, want 1", len(file.materials))
+		}
+		if got := file.materials[0].transparency; !closeTo(float64(got), float64(test.transparency), 1e-6) {
+			t.Errorf("%q: transparency %g, want %g", test.mtl, got, test.transparency)
+		}
+		if warned := strings.Contains(log, "disagree"); warned != test.warn {
+			t.Errorf("%q: warned %v, want %v, log %q", test.mtl, warned, test.warn, log)
+		}
+	}
+}
+
+func TestMaterialColourForms(t *testing.T) {
+	tests := []struct {
+		kd   string
+		want [3]float32
+	}{
+		{"Kd 1 0.5 0.25", [3]float32{1, 0.5, 0.25}},
+		{"Kd 0.5", [3]float32{0.5, 0.5, 0.5}},
+		// The D65 white point.
+		{"Kd xyz 0.95047 1.0 1.08883", [3]float32{1, 1, 1}},
+		{"Kd xyz 0.5", [3]float32{0.7992, 0.7181, 0.7045}},
+	}
+	for _, test := range tests {
+		file, _ := convertMaterials(t, materialOBJ("m"), "newmtl m\n"+test.kd+"\n")
+		for i, c := range file.materials[0].diffuse {
+			if !closeTo(float64(c), float64(test.want[i]), 1e-3) {
+				t.Errorf("%q gave diffuse %v, want %v", test.kd, file.materials[0].diffuse, test.want)
+				break
+			}
+		}
+	}
+
+	// An xyz colour is linearized once, giving the linear sRGB of the matrix alone.
+	file, _ := convertMaterials(t, materialOBJ("m"), "newmtl m\nKd xyz 0.5\n", "-linearize")
+	for i, want := range [3]float64{0.6024, 0.4742, 0.4544} {
+		if c := file.materials[0].diffuse[i]; !closeTo(float64(c), want, 1e-3) {
+			t.Errorf("Kd xyz 0.5 with -linearize gave diffuse %v, want 0.6024 0.4742 0.4544", file.materials[0].diffuse)
+			break
+		}
+	}
+
+	for _, kd := range []string{"Kd spectral white.rfl", "Kd spectral white.rfl 2", "Kd red", "Kd"} {
+		dir := writeFiles(t, map[string]string{"in.obj": materialOBJ("m"), "in.mtl": "newmtl m\n" + kd + "\n"})
+		resetCommandLine()
+		var log bytes.Buffer
+		logOutput = &log
+		if err := Convert([]string{filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx")}); err == nil {
+			t.Errorf("%q converted without error", kd)
+		}
+		if !strings.Contains(log.String(), "Material m:") {
+			t.Errorf("%q: the material was not named in the log %q", kd, log.String())
+		}
+	}
+}
+
+func TestLinearizeConvertsColoursFromSRGB(t *testing.T) {
+	mtl := "newmtl grey\nKd 0.5 0.5 0.5\nKs 0.02 1 0\nKa 0.5\nKe 0 0 0.5\nTf 0.5 0.5 0.5\nNs 0.5\n"
+	file, _ := convertMaterials(t, materialOBJ("grey"), mtl, "-linearize")
+	m := file.materials[0]
+	tests := []struct {
+		name      string
+		got, want [3]float32
+	}{
+		{"diffuse", m.diffuse, [3]float32{0.2140411, 0.2140411, 0.2140411}},
+		// 0.02 is on the straight part of the curve.
+		{"specular", m.specular, [3]float32{0.02 / 12.92, 1, 0}},
+		{"ambient", m.ambient, [3]float32{0.2140411, 0.2140411, 0.2140411}},
+		{"emissive", m.emissive, [3]float32{0, 0, 0.2140411}},
+		{"transmissive", m.transmissive, [3]float32{0.5, 0.5, 0.5}},
+	}
+	for _, test := range tests {
+		for i := range test.got {
+			if !closeTo(float64(test.got[i]), float64(test.want[i]), 1e-6) {
+				t.Errorf("%s is %v, want %v", test.name, test.got, test.want)
+				break
+			}
+		}
+	}
+	if m.power != 0.5 {
+		t.Errorf("the specular power changed to %g", m.power)
+	}
+}
+
+func TestMaterialNamesRoundTrip(t *testing.T) {
+	names := []string{"red", "Steel Plate", "ünïcode", "a/b"}
+	var mtl strings.Builder
+	for _, name := range names {
+		mtl.WriteString("newmtl " + name + "\nKd 1 1 1\n")
+	}
+	file, _ := convertMaterials(t, materialOBJ(names...), mtl.String())
+	if file.header.version < 12 {
+		t.Fatalf("version %d has no material names", file.header.version)
+	}
+	if len(file.materials) != len(names) {
+		t.Fatalf("got %d materials, want %d", len(file.materials), len(names))
+	}
+	for i, name := range names {
+		if file.materials[i].name != name {
+			t.Errorf("material %d is named %q, want %q", i, file.materials[i].name, name)
+		}
+		if got := file.materials[file.faces[i].materialID].name; got != name {
+			t.Errorf("face %d uses %q, want %q", i, got, name)
+		}
+	}
+}
+
+func TestMaterialOrderKeepsUsedIDsStable(t *testing.T) {
+	used := "newmtl wood\nKd 1 0 0\nnewmtl brick\nKd 0 1 0\n"
+	// The unused materials sort before and between the used ones by name.
+	unused := "newmtl aaa\nKd 0 0 1\nnewmtl cloth\nKd 1 1 0\n"
+	obj := materialOBJ("wood", "brick")
+
+	pruned, _ := convertMaterials(t, obj, used, "-material-order", "name")
+	full, _ := convertMaterials(t, obj, unused+used, "-material-order", "name")
+	if len(full.materials) <= len(pruned.materials) {
+		t.Fatalf("got %d materials with the unused ones and %d without", len(full.materials), len(pruned.materials))
+	}
+	for i := range pruned.faces {
+		if pruned.faces[i].materialID != full.faces[i].materialID {
+			t.Errorf("face %d uses material %d without the unused materials and %d with them", i, pruned.faces[i].materialID, full.faces[i].materialID)
+		}
+		if a, b := pruned.materials[pruned.faces[i].materialID].name, full.materials[full.faces[i].materialID].name; a != b {
+			t.Errorf("face %d uses %s without the unused materials and %s with them", i, a, b)
+		}
+	}
+	want := []string{"brick", "wood", "aaa", "cloth"}
+	for i, m := range full.materials {
+		if m.name != want[i] {
+			t.Errorf("material %d is %s, want %s", i, m.name, want[i])
+		}
+	}
+}
+
+func TestDuplicateNewmtlMergesIntoEarlierMaterial(t *testing.T) {
+	mtl := "newmtl red\nKd 1 0 0\nNs 20\nnewmtl blue\nKd 0 0 1\nnewmtl red\nKs 0.5 0.5 0.5\nNs 40\n"
+	file, log := convertMaterials(t, materialOBJ("red", "blue"), mtl)
+	if len(file.materials) != 2 {
+		t.Fatalf("got %d materials, want red and blue once each", len(file.materials))
+	}
+	red := file.materials[file.faces[0].materialID]
+	if red.name != "red" || file.faces[0].materialID != 0 {
+		t.Errorf("the first face uses %s at %d, want red kept at 0", red.name, file.faces[0].materialID)
+	}
+	if red.diffuse != [3]float32{1, 0, 0} {
+		t.Errorf("red lost its first diffuse, got %v", red.diffuse)
+	}
+	if red.specular != [3]float32{0.5, 0.5, 0.5} || red.power != 40 {
+		t.Errorf("red has specular %v power %g, want the second block's 0.5 and 40", red.specular, red.power)
+	}
+	if !strings.Contains(log, "Material red redefined") {
+		t.Errorf("the redefinition was not reported, log %q", log)
+	}
+}
+
+func TestFlattenMaterialsLeavesOneMaterial(t *testing.T) {
+	mtl := "newmtl red\nKd 1 0 0\nnewmtl green\nKd 0 1 0\nnewmtl blue\nKd 0 0 1\n"
+	file, _ := convertMaterials(t, materialOBJ("green", "red", "blue", "green"), mtl, "-flatten-materials")
+	if len(file.materials) != 1 {
+		t.Fatalf("got %d materials, want 1", len(file.materials))
+	}
+	if m := file.materials[0]; m.name != "green" || m.diffuse != [3]float32{0, 1, 0} {
+		t.Errorf("kept %s with diffuse %v, want green, the first face's material", m.name, m.diffuse)
+	}
+	for i, f := range file.faces {
+		if f.materialID != 0 {
+			t.Errorf("face %d uses material %d, want 0", i, f.materialID)
+		}
+	}
+}
+
+func TestEncodingConvertsMaterialNamesToUTF8(t *testing.T) {
+	tests := []struct {
+		encoding string
+		name     string
+		want     string
+	}{
+		// é is 0xE9 in both, € is 0x80 in Windows-1252 only.
+		{"latin1", "Caf\xe9", "Café"},
+		{"windows-1252", "Caf\xe9 \x80", "Café €"},
+	}
+	for _, test := range tests {
+		file, _ := convertMaterials(t, materialOBJ(test.name), "newmtl "+test.name+"\nKd 1 0 0\n", "-encoding", test.encoding)
+		if len(file.materials) != 1 || file.materials[0].name != test.want {
+			t.Errorf("-encoding %s: got materials %v, want one named %q", test.encoding, file.materials, test.want)
+			continue
+		}
+		if file.materials[0].diffuse != [3]float32{1, 0, 0} {
+			t.Errorf("-encoding %s: the usemtl name did not match its newmtl", test.encoding)
+		}
+	}
+}
+
+func TestUsemapSplitsTheMaterial(t *testing.T) {
+	obj := "mtllib in.mtl\nv 0 0 0\nv 1 0 0\nv 0 1 0\nv 1 1 0\nusemtl wood\nusemap oak.png\nf 1 2 3\nusemap pine.png\nf 2 4 3\n"
+	mtl := "newmtl wood\nKd 0.5 0.25 0\nmap_Kd wood.png\n"
+	for _, args := range [][]string{{"-le"}, {"-le", "-stream"}} {
+		file, log := convertMaterials(t, obj, mtl, args...)
+		// wood itself is written too as every material read from the library is.
+		var split int = 0
+		for _, mat := range file.materials {
+			if strings.HasPrefix(mat.name, "wood@") {
+				split++
+			}
+		}
+		if split != 2 || len(file.faces) != 2 {
+			t.Fatalf("%v: got %d texture map materials and %d faces, want one for each texture map, log %q", args, split, len(file.faces), log)
+		}
+		for i, texture := range []string{"oak.png", "pine.png"} {
+			mat := file.materials[file.faces[i].materialID]
+			if mat.name != "wood@"+texture || mat.texture != texture {
+				t.Errorf("%v: face %d uses material %s with texture %s, want wood@%s with %s", args, i, mat.name, mat.texture, texture, texture)
+			}
+			if mat.diffuse != [3]float32{0.5, 0.25, 0} {
+				t.Errorf("%v: material %s has diffuse %v, want the 0.5 0.25 0 of wood", args, mat.name, mat.diffuse)
+			}
+		}
+	}
+}
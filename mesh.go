@@ -0,0 +1,107 @@
+package main
+
+import "time"
+
+// The geometry read from one or more OBJ files.
+type Geometry struct {
+	vertices      []Vertex
+	normals       []Normal
+	textureCoords []TextureCoord
+	faces         []Face
+	polylines     []Polyline
+	points        []Point
+}
+
+// Everything read or built while converting one file. Each conversion starts from a new Mesh
+// so nothing carries over from the previous file.
+type Mesh struct {
+	Geometry
+
+	// The OBJ file being read, for messages and to find its material files.
+	inputFileName string
+
+	curMaterialName string
+	curTextureMap   string
+	curObjectName   string
+	curMaterialIdx  uint32
+
+	materials      []Material
+	materialMap    map[string]uint32
+	sanitizedNames map[string]string
+	// Material files read so far, by path.
+	loadedMaterialFiles map[string]bool
+	// Material libraries named on 'mtllib' lines as they were written, for outputs which refer to them.
+	materialLibraries []string
+
+	boundSphere BoundSphere
+	boundBox    BoundBox
+
+	vertexType uint32
+	indexType  uint32
+	meshUnit   uint32
+	fileUnit   uint32
+
+	// Level of detail from the last 'lod' statement of the OBJ file, 0 when there was none
+	objLOD int
+
+	tangents        []Tangent
+	triangleStrips  []TriangleStrip
+	materialRanges  []MaterialRange
+	lodRanges       []LODRange
+	vertexSplits    []VertexSplit
+	baseVertexCount uint32
+
+	// Dequantized position = positionBias + q * positionScale, per axis, when vertexType has
+	// VERTEX_QUANTIZED set.
+	positionScale [3]float32
+	positionBias  [3]float32
+
+	meshStats MeshStats
+
+	// Status line shown with -progress.
+	progressPhase string
+	progressStart time.Time
+	progressLast  time.Time
+}
+
+// An empty mesh with the units not yet known.
+func NewMesh() *Mesh {
+	return &Mesh{
+		materialMap:         make(map[string]uint32),
+		sanitizedNames:      make(map[string]string),
+		loadedMaterialFiles: make(map[string]bool),
+		meshUnit:            UNIT_UNKNOWN,
+		fileUnit:            UNIT_UNKNOWN,
+	}
+}
+
+// Move the geometry read so far out of the mesh, leaving it empty for the next file.
+func (m *Mesh) TakeGeometry() Geometry {
+	g := m.Geometry
+	m.Geometry = Geometry{}
+	return g
+}
+
+// Put the geometry of the earlier files back in front of the file just read, moving the new
+// file's indices past the earlier vertices, normals and texture coords.
+func (m *Mesh) AppendGeometry(earlier Geometry) {
+	vertexBase, normalBase, uvBase := uint32(len(earlier.vertices)), uint32(len(earlier.normals)), uint32(len(earlier.textureCoords))
+	for i := range m.faces {
+		for j := range m.faces[i].v {
+			m.faces[i].v[j] += vertexBase
+		}
+		for j := range m.faces[i].n {
+			m.faces[i].n[j] += normalBase
+		}
+		for j := range m.faces[i].uv {
+			m.faces[i].uv[j] += uvBase
+		}
+	}
+	m.RemapElements(func(v uint32) uint32 { return v + vertexBase }, func(uv uint32) uint32 { return uv + uvBase })
+	m.vertices = append(earlier.vertices, m.vertices...)
+	m.normals = append(earlier.normals, m.normals...)
+	m.textureCoords = append(earlier.textureCoords, m.textureCoords...)
+	m.faces = append(earlier.faces, m.faces...)
+	m.polylines = append(earlier.polylines, m.polylines...)
+	m.points = append(earlier.points, m.points...)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"slices"
+)
+
+// Area weighted normal of a face, the length is twice the face area.
+func (m *Mesh) faceNormal(f *Face) (float64, float64, float64) {
+	var nx, ny, nz float64 = 0, 0, 0
+	a := m.vertices[f.v[0]]
+	for j := 1; j+1 < int(f.edges); j++ {
+		b, c := m.vertices[f.v[j]], m.vertices[f.v[j+1]]
+		x, y, z := crossProduct(float64(b.X-a.X), float64(b.Y-a.Y), float64(b.Z-a.Z), float64(c.X-a.X), float64(c.Y-a.Y), float64(c.Z-a.Z))
+		nx += x
+		ny += y
+		nz += z
+	}
+	return nx, ny, nz
+}
+
+// Replace the corner normals of a face with one flat normal from its own geometry, added as a
+// new normal. Faces without normals are left without them.
+func (m *Mesh) FlattenFaceNormals(f *Face) {
+	if len(f.n) == 0 {
+		return
+	}
+	nx, ny, nz := m.faceNormal(f)
+	n := Normal{X: float32(nx), Y: float32(ny), Z: float32(nz)}
+	if n.X != 0 || n.Y != 0 || n.Z != 0 {
+		n.normalize()
+	}
+	m.normals = append(m.normals, n)
+	for j := range f.n {
+		f.n[j] = uint32(len(m.normals) - 1)
+	}
+}
+
+// Find the representative of a set in a union-find forest, compressing the path as it goes.
+func findSet(parent []int, i int) int {
+	for parent[i] != i {
+		parent[i] = parent[parent[i]]
+		i = parent[i]
+	}
+	return i
+}
+
+// Replace the normals with ones generated from the face geometry. Faces which meet at an edge
+// with an angle below creaseAngle degrees share averaged normals along it, sharper edges keep
+// separate normals on each side.
+func (m *Mesh) GenerateNormals(creaseAngle float64) error {
+	if creaseAngle < 0 || creaseAngle > 180 {
+		Logf(LOG_ERROR, "Error: Crease angle must be between 0 and 180 degrees.\n")
+		return errors.New("invalid crease angle")
+	}
+	var threshold float64 = math.Cos(creaseAngle * math.Pi / 180)
+
+	// Every face corner starts with its own normal, corners are merged across smooth edges.
+	faceNormals := make([][3]float64, len(m.faces))
+	firstCorner := make([]int, len(m.faces)+1)
+	for i := range m.faces {
+		nx, ny, nz := m.faceNormal(&m.faces[i])
+		faceNormals[i] = [3]float64{nx, ny, nz}
+		firstCorner[i+1] = firstCorner[i] + int(m.faces[i].edges)
+	}
+	parent := make([]int, firstCorner[len(m.faces)])
+	for i := range parent {
+		parent[i] = i
+	}
+
+	// The faces using each undirected edge, along with the corner of each face at the edge start.
+	type edgeUse struct {
+		face, corner int
+	}
+	edgeFaces := make(map[Edge][]edgeUse)
+	for i := range m.faces {
+		for j := 0; j < int(m.faces[i].edges); j++ {
+			e := MakeEdge(m.faces[i].v[j], m.faces[i].v[(j+1)%int(m.faces[i].edges)])
+			edgeFaces[e] = append(edgeFaces[e], edgeUse{i, j})
+		}
+	}
+
+	// Corner of face f which uses vertex v.
+	cornerOf := func(f int, v uint32) int {
+		for j := 0; j < int(m.faces[f].edges); j++ {
+			if m.faces[f].v[j] == v {
+				return firstCorner[f] + j
+			}
+		}
+		return -1
+	}
+
+	// Visit the edges in a fixed order rather than map order so the output is reproducible.
+	sortedEdges := make([]Edge, 0, len(edgeFaces))
+	for e := range edgeFaces {
+		sortedEdges = append(sortedEdges, e)
+	}
+	slices.SortFunc(sortedEdges, func(x, y Edge) int {
+		if x.a != y.a {
+			return cmp.Compare(x.a, y.a)
+		}
+		return cmp.Compare(x.b, y.b)
+	})
+
+	var smoothEdges, creaseEdges int = 0, 0
+	for _, e := range sortedEdges {
+		uses := edgeFaces[e]
+		for k := 1; k < len(uses); k++ {
+			a, b := faceNormals[uses[0].face], faceNormals[uses[k].face]
+			la := math.Sqrt(dotProduct(a[0], a[1], a[2], a[0], a[1], a[2]))
+			lb := math.Sqrt(dotProduct(b[0], b[1], b[2], b[0], b[1], b[2]))
+			if la == 0 || lb == 0 || dotProduct(a[0], a[1], a[2], b[0], b[1], b[2])/(la*lb) < threshold {
+				creaseEdges++
+				continue
+			}
+			smoothEdges++
+			for _, v := range []uint32{e.a, e.b} {
+				c0, c1 := cornerOf(uses[0].face, v), cornerOf(uses[k].face, v)
+				parent[findSet(parent, c0)] = findSet(parent, c1)
+			}
+		}
+	}
+
+	// Each set of merged corners becomes one normal, the sum of the face normals around it
+	// accumulated in face index order.
+	sums := make(map[int][3]float64)
+	for i := range m.faces {
+		for j := 0; j < int(m.faces[i].edges); j++ {
+			root := findSet(parent, firstCorner[i]+j)
+			s := sums[root]
+			s[0] += faceNormals[i][0]
+			s[1] += faceNormals[i][1]
+			s[2] += faceNormals[i][2]
+			sums[root] = s
+		}
+	}
+	index := make(map[int]uint32)
+	m.normals = nil
+	for i := range m.faces {
+		m.faces[i].n = make([]uint32, m.faces[i].edges)
+		for j := 0; j < int(m.faces[i].edges); j++ {
+			root := findSet(parent, firstCorner[i]+j)
+			idx, ok := index[root]
+			if !ok {
+				s := sums[root]
+				// Corners of faces with no area have nothing to average and take +Z.
+				n := Normal{X: float32(s[0]), Y: float32(s[1]), Z: float32(s[2])}
+				n.normalize()
+				m.normals = append(m.normals, n)
+				idx = uint32(len(m.normals) - 1)
+				index[root] = idx
+			}
+			m.faces[i].n[j] = idx
+		}
+	}
+
+	Logf(LOG_INFO, "Generated %d normals with a %.1f degree crease angle, %d smooth and %d crease edges.\n", len(m.normals), creaseAngle, smoothEdges, creaseEdges)
+	return nil
+}
+
+// Cross product of two 3D vectors
+func crossProduct(ax, ay, az, bx, by, bz float64) (float64, float64, float64) {
+	return ay*bz - az*by, az*bx - ax*bz, ax*by - ay*bx
+}
+
+// Dot product of two 3D vectors
+func dotProduct(ax, ay, az, bx, by, bz float64) float64 {
+	return ax*bx + ay*by + az*bz
+}
+
+// Scale the normal to unit length. A zero length normal, as written by some exporters for
+// degenerate faces, has no direction so it is replaced with +Z instead of becoming NaN.
+func (n *Normal) normalize() {
+	var length float32 = float32(math.Sqrt(float64(n.X*n.X + n.Y*n.Y + n.Z*n.Z)))
+	if length < 1e-12 || math.IsNaN(float64(length)) {
+		n.X, n.Y, n.Z = 0, 0, 1
+		return
+	}
+	n.X /= length
+	n.Y /= length
+	n.Z /= length
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestGeneratedNormalsAreReproducible(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": gridOBJ(12)})
+	first := convertFile(t, dir, "in.obj", "-gennormals")
+	second := convertFile(t, dir, "in.obj", "-gennormals")
+	if !bytes.Equal(first, second) {
+		t.Fatal("generating the normals twice gave different output")
+	}
+
+	file := readOutput(t, first)
+	if len(file.normals) == 0 {
+		t.Fatal("no normals were generated")
+	}
+	for i, n := range file.normals {
+		length := math.Sqrt(float64(n.X*n.X + n.Y*n.Y + n.Z*n.Z))
+		if !closeTo(length, 1, 1e-5) {
+			t.Errorf("normal %d has length %g", i, length)
+		}
+	}
+}
+
+func TestNormalAngleThreshold(t *testing.T) {
+	// Two normals 1 degree apart about the diagonal, where per-component deltas misjudge the angle.
+	a := math.Pi / 180
+	d := 1 / math.Sqrt(2)
+	obj := fmt.Sprintf("v 0 0 0\nv 1 0 0\nv 0 1 0\nvn %g %g 0\nvn %g %g 0\nf 1//1 2//1 3//1\nf 1//2 2//2 3//2\n",
+		d, d, math.Cos(math.Pi/4+a), math.Sin(math.Pi/4+a))
+	tests := []struct {
+		angle string
+		want  int
+	}{
+		{"5", 1},
+		{"0.5", 2},
+	}
+	for _, test := range tests {
+		file := convertOBJ(t, obj, "-d", "-normalangle", test.angle)
+		if len(file.normals) != test.want {
+			t.Errorf("-normalangle %s kept %d normals, want %d", test.angle, len(file.normals), test.want)
+		}
+	}
+}
+
+// A closed cylinder of radius 1 along z, its side quads share the ring vertices with the
+// triangle fans of the caps.
+func cylinderOBJ(segments int) string {
+	var b strings.Builder
+	for _, z := range []int{0, 1} {
+		for i := 0; i < segments; i++ {
+			angle := 2 * math.Pi * float64(i) / float64(segments)
+			fmt.Fprintf(&b, "v %g %g %d\n", math.Cos(angle), math.Sin(angle), z)
+		}
+	}
+	bottom, top := 2*segments+1, 2*segments+2
+	fmt.Fprintf(&b, "v 0 0 0\nv 0 0 1\n")
+	for i := 1; i <= segments; i++ {
+		next := i%segments + 1
+		fmt.Fprintf(&b, "f %d %d %d %d\n", i, next, next+segments, i+segments)
+		fmt.Fprintf(&b, "f %d %d %d\n", bottom, next, i)
+		fmt.Fprintf(&b, "f %d %d %d\n", top, i+segments, next+segments)
+	}
+	return b.String()
+}
+
+func TestCreaseAngleKeepsCapsSharpAndSidesSmooth(t *testing.T) {
+	// Neighbouring sides meet at 22.5 degrees and the caps meet the sides at 90.
+	file := convertOBJ(t, cylinderOBJ(16), "-gennormals", "-creaseangle", "30")
+	for i, f := range file.faces {
+		onCap := f.edges == 3
+		for j := 0; j < int(f.edges); j++ {
+			v, n := file.vertices[f.v[j]], file.normals[f.n[j]]
+			if onCap {
+				if !closeTo(float64(n.X), 0, 1e-5) || !closeTo(float64(n.Y), 0, 1e-5) || !closeTo(math.Abs(float64(n.Z)), 1, 1e-5) {
+					t.Errorf("cap face %d corner %d has normal %g,%g,%g, want straight along z", i, j, n.X, n.Y, n.Z)
+				}
+			} else if !closeTo(float64(n.X), float64(v.X), 1e-5) || !closeTo(float64(n.Y), float64(v.Y), 1e-5) || !closeTo(float64(n.Z), 0, 1e-5) {
+				t.Errorf("side face %d corner %d at %g,%g has normal %g,%g,%g, want the smooth radial one", i, j, v.X, v.Y, n.X, n.Y, n.Z)
+			}
+		}
+	}
+}
+
+func TestZeroLengthNormalsBecomePlusZ(t *testing.T) {
+	n := Normal{}
+	n.normalize()
+	if n != (Normal{Z: 1}) {
+		t.Errorf("normalizing a zero normal gave %g,%g,%g, want 0,0,1", n.X, n.Y, n.Z)
+	}
+
+	// The OBJ normal has no length and the last face has no area to generate one from.
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nv 2 0 0\nvn 0 0 0\nf 1//1 2//1 3//1\nf 1//1 2//1 4//1\n"
+	for _, args := range [][]string{nil, {"-gennormals"}} {
+		file := convertOBJ(t, obj, args...)
+		for i, n := range file.normals {
+			if length := math.Sqrt(float64(n.X*n.X + n.Y*n.Y + n.Z*n.Z)); !closeTo(length, 1, 1e-5) {
+				t.Errorf("%v: normal %d is %g,%g,%g, want unit length", args, i, n.X, n.Y, n.Z)
+			}
+		}
+	}
+}
+
+func TestQuadNormalsFlattenBentQuads(t *testing.T) {
+	// Corner 3 is lifted, so the halves either side of the 1-3 diagonal face different ways.
+	bent := "v 0 0 0\nv 1 0 0\nv 1 1 1\nv 0 1 0\nvn 0 0 1\nf 1//1 2//1 3//1 4//1\n"
+	file := convertOBJ(t, bent, "-q", "3", "-quadnormals")
+	if len(file.faces) != 2 {
+		t.Fatalf("got %d faces, want the quad split in two", len(file.faces))
+	}
+	for i, f := range file.faces {
+		a, b, c := file.vertices[f.v[0]], file.vertices[f.v[1]], file.vertices[f.v[2]]
+		nx, ny, nz := crossProduct(float64(b.X-a.X), float64(b.Y-a.Y), float64(b.Z-a.Z), float64(c.X-a.X), float64(c.Y-a.Y), float64(c.Z-a.Z))
+		length := math.Sqrt(nx*nx + ny*ny + nz*nz)
+		for j := range f.n {
+			n := file.normals[f.n[j]]
+			if !closeTo(float64(n.X), nx/length, 1e-5) || !closeTo(float64(n.Y), ny/length, 1e-5) || !closeTo(float64(n.Z), nz/length, 1e-5) {
+				t.Errorf("face %d corner %d has normal %g,%g,%g, want the flat %g,%g,%g", i, j, n.X, n.Y, n.Z, nx/length, ny/length, nz/length)
+			}
+		}
+	}
+
+	// Without -quadnormals, or for a flat quad, the corners keep the OBJ normal.
+	flat := strings.Replace(bent, "v 1 1 1", "v 1 1 0", 1)
+	for _, c := range []struct {
+		obj  string
+		args []string
+	}{
+		{bent, []string{"-q", "3"}},
+		{flat, []string{"-q", "3", "-quadnormals"}},
+	} {
+		file := convertOBJ(t, c.obj, c.args...)
+		for i, f := range file.faces {
+			for j := range f.n {
+				if n := file.normals[f.n[j]]; n != (Normal{Z: 1}) {
+					t.Errorf("%v: face %d corner %d has normal %g,%g,%g, want 0,0,1", c.args, i, j, n.X, n.Y, n.Z)
+				}
+			}
+		}
+	}
+}
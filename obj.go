@@ -0,0 +1,578 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Reads an input a line at a time, bufio.Scanner is one.
+type LineScanner interface {
+	Scan() bool
+	Text() string
+	Err() error
+}
+
+// Create a line scanner which accepts lines up to -maxline MiB rather than bufio's 64KiB
+// default. The buffer starts small and only grows as long lines need it. With -maxline 0
+// the lines are read by a byteLineReader, which has no limit.
+func NewLineScanner(r io.Reader) LineScanner {
+	if *maxLinePtr == 0 {
+		return &byteLineReader{r: bufio.NewReaderSize(r, 1024*1024)}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), *maxLinePtr*1024*1024)
+	return scanner
+}
+
+// Reads lines of any length straight from a large read buffer, for huge files whose exporter
+// wrote whole meshes on a single line. The line buffer grows to fit the longest line and is
+// reused for the next, a trailing \r is dropped as bufio.ScanLines does.
+type byteLineReader struct {
+	r    *bufio.Reader
+	line []byte
+	err  error
+}
+
+func (l *byteLineReader) Scan() bool {
+	if l.err != nil {
+		return false
+	}
+	l.line = l.line[:0]
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		l.line = append(l.line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			l.err = err
+			if err != io.EOF || len(l.line) == 0 {
+				return false
+			}
+		}
+		break
+	}
+	l.line = bytes.TrimSuffix(l.line, []byte("\n"))
+	l.line = bytes.TrimSuffix(l.line, []byte("\r"))
+	return true
+}
+
+func (l *byteLineReader) Text() string {
+	return string(l.line)
+}
+
+func (l *byteLineReader) Err() error {
+	if l.err == io.EOF {
+		return nil
+	}
+	return l.err
+}
+
+// Log an error from a line scanner, suggesting -maxline when a line was too long.
+func LogScanError(fileName string, err error) {
+	if errors.Is(err, bufio.ErrTooLong) {
+		Logf(LOG_ERROR, "Error reading file %s: a line is longer than %d MiB, raise the limit with -maxline.\n", fileName, *maxLinePtr)
+		return
+	}
+	Logf(LOG_ERROR, "Error reading file %s: %v\n", fileName, err)
+}
+
+// Remove a comment from the first '#' outside double quotes to the end of the line, so
+// trailing comments such as 'Kd 1 1 1 # white' do not become extra tokens.
+func StripComment(line string) string {
+	var quoted bool = false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// Parse a 'v' line, a colour on the line sets the colour bit of the vertex type.
+func (m *Mesh) ParseVertex(line string, lineParts []string) Vertex {
+	var vertex Vertex = Vertex{0.0, 0.0, 0.0, 1.0, 1.0, 1.0, 1.0, 1.0, false, [3]float32{}, [3]float64{}}
+	if len(lineParts) == 4 {
+		fmt.Sscanf(line, "v %f %f %f", &vertex.X, &vertex.Y, &vertex.Z)
+	} else if len(lineParts) == 5 {
+		fmt.Sscanf(line, "v %f %f %f %f", &vertex.X, &vertex.Y, &vertex.Z, &vertex.W)
+		// Only store w when it carries something, most files which give it use 1.0.
+		if vertex.W != 1.0 {
+			m.vertexType |= VERTEX_W
+		}
+	} else if len(lineParts) == 7 {
+		m.vertexType |= VERTEX_COLOR
+		fmt.Sscanf(line, "v %f %f %f %f %f %f", &vertex.X, &vertex.Y, &vertex.Z, &vertex.R, &vertex.G, &vertex.B)
+	} else if len(lineParts) == 8 {
+		// Colour with an explicit alpha, v x y z r g b a
+		m.vertexType |= VERTEX_COLOR
+		fmt.Sscanf(line, "v %f %f %f %f %f %f %f", &vertex.X, &vertex.Y, &vertex.Z, &vertex.R, &vertex.G, &vertex.B, &vertex.A)
+	}
+	if *precisePtr && len(lineParts) >= 4 {
+		vertex.precise = parsePrecise(lineParts[1:4], vertex)
+	}
+	return vertex
+}
+
+// Parse x, y and z again as float64, falling back to the float value for anything unparsable.
+func parsePrecise(coords []string, v Vertex) [3]float64 {
+	p := [3]float64{float64(v.X), float64(v.Y), float64(v.Z)}
+	for i := range p {
+		if value, err := strconv.ParseFloat(coords[i], 64); err == nil {
+			p[i] = value
+		}
+	}
+	return p
+}
+
+// Set the position from double precision, keeping it as well with -precise.
+func (v *Vertex) setPosition(x, y, z float64) {
+	v.X, v.Y, v.Z = float32(x), float32(y), float32(z)
+	if *precisePtr {
+		v.precise = [3]float64{x, y, z}
+	}
+}
+
+// The position in the best precision available.
+func (v *Vertex) position() [3]float64 {
+	if *precisePtr {
+		return v.precise
+	}
+	return [3]float64{float64(v.X), float64(v.Y), float64(v.Z)}
+}
+
+// Parse a 'vt' line.
+func (m *Mesh) ParseTextureCoord(line string, lineParts []string) TextureCoord {
+	var textureCoord TextureCoord
+	textureCoord.flushed = false
+	if len(lineParts) == 2 {
+		fmt.Sscanf(line, "vt %f", &textureCoord.U)
+		textureCoord.V = 0.0
+	} else if len(lineParts) == 3 {
+		fmt.Sscanf(line, "vt %f %f", &textureCoord.U, &textureCoord.V)
+	} else if len(lineParts) == 4 {
+		fmt.Sscanf(line, "vt %f %f %f", &textureCoord.U, &textureCoord.V, &textureCoord.W)
+		// w defaults to 0, only store it when a file uses it.
+		if textureCoord.W != 0 {
+			m.vertexType |= UV_W
+		}
+	}
+	return textureCoord
+}
+
+// Parse a 'vn' line, the normal is re-normalized.
+func ParseNormal(line string) Normal {
+	var normal Normal
+	normal.flushed = false
+	fmt.Sscanf(line, "vn %f %f %f", &normal.X, &normal.Y, &normal.Z)
+	normal.W = 0.0
+	normal.normalize()
+	return normal
+}
+
+// Parse an 'f' line into a face, the material and object are left for the caller to fill in.
+func ParseFace(line string, lineParts []string, lineNumber int) (Face, error) {
+	var face Face
+	face.complete = false
+	if len(lineParts) == 4 {
+		face.edges = 3
+	} else if len(lineParts) == 5 {
+		face.edges = 4
+	} else {
+		Logf(LOG_ERROR, "Error: Only triangles and quads are supported.\n")
+		return face, errors.New("invalid face type")
+	}
+	for i := 1; i < len(lineParts); i++ {
+		vertParts := strings.Split(lineParts[i], "/")
+		if len(vertParts) >= 1 {
+			idx, err := strconv.Atoi(vertParts[0])
+			if err != nil {
+				return face, fmt.Errorf("invalid vertex index: %v", err)
+			}
+			face.v = append(face.v, uint32(idx)-1)
+		}
+		if len(vertParts) >= 2 && vertParts[1] != "" {
+			idx, err := strconv.Atoi(vertParts[1])
+			if err != nil {
+				return face, fmt.Errorf("invalid texture index: %v", err)
+			}
+			face.uv = append(face.uv, uint32(idx)-1)
+		}
+		if len(vertParts) == 3 && vertParts[2] != "" {
+			idx, err := strconv.Atoi(vertParts[2])
+			if err != nil {
+				return face, fmt.Errorf("invalid normal index: %v", err)
+			}
+			face.n = append(face.n, uint32(idx)-1)
+		}
+		if len(vertParts) > 3 {
+			return face, errors.New("invalid vertex index format on face")
+		}
+	}
+	// Every corner must supply the same attributes, otherwise the index lists are out of step.
+	if (len(face.uv) != 0 && len(face.uv) != int(face.edges)) || (len(face.n) != 0 && len(face.n) != int(face.edges)) {
+		Logf(LOG_ERROR, "Error: Face on line %d mixes corners with and without normals/texture coords: %s\n", lineNumber, line)
+		return face, fmt.Errorf("inconsistent face corner format on line %d", lineNumber)
+	}
+	face.line = lineNumber
+	return face, nil
+}
+
+// Parse an OBJ file from any reader, its mtllib lines are opened with OpenMaterialFile.
+func (m *Mesh) ProcessOBJFile(inputFile io.Reader) error {
+	// Read input file line by line.
+	var lineNumber int = 0
+	var scanner LineScanner = NewLineScanner(inputFile)
+	for scanner.Scan() {
+		lineNumber++
+		m.ProgressUpdate()
+		var line string = strings.Trim(scanner.Text(), " \t")
+
+		// Pick up a unit hint comment such as '# units = centimeters'.
+		if len(line) > 0 && line[0] == '#' {
+			key, value, found := strings.Cut(strings.TrimSpace(line[1:]), "=")
+			if found && strings.ToLower(strings.TrimSpace(key)) == "units" {
+				m.fileUnit = ParseUnit(value)
+				if m.fileUnit == UNIT_UNKNOWN {
+					Logf(LOG_WARN, "Warning: Unknown unit %s in OBJ file, ignoring.\n", strings.TrimSpace(value))
+				}
+			}
+		}
+
+		// If the line is empty or only a comment, skip it.
+		line = strings.Trim(StripComment(line), " \t")
+		if len(line) == 0 {
+			continue
+		}
+
+		// Split the line into tokens, and decide how to handle each line
+		// based on the first token which identifies the type of data on that line.
+		// Any run of spaces or tabs separates tokens, normalise the line to single spaces
+		// so the Sscanf formats below match.
+		lineParts := strings.Fields(line)
+		line = strings.Join(lineParts, " ")
+		switch lineParts[0] {
+		case "v":
+			var vertex Vertex = m.ParseVertex(line, lineParts)
+			m.vertices = append(m.vertices, vertex)
+			Logf(LOG_DEBUG, "Vertex %v\n", vertex)
+		case "vt":
+			var textureCoord TextureCoord = m.ParseTextureCoord(line, lineParts)
+			m.textureCoords = append(m.textureCoords, textureCoord)
+			Logf(LOG_DEBUG, "TextureCoord %v\n", textureCoord)
+		case "vn":
+			var normal Normal = ParseNormal(line)
+			m.normals = append(m.normals, normal)
+			Logf(LOG_DEBUG, "Normal %v\n", normal)
+		case "usemtl":
+			m.curMaterialName = m.MaterialName(strings.TrimSpace(line[len("usemtl"):]))
+			Logf(LOG_VERBOSE, "Using Material %s\n", m.curMaterialName)
+		case "usemap":
+			m.curTextureMap = ParseUseMap(line)
+			Logf(LOG_VERBOSE, "Using Texture Map %s\n", m.curTextureMap)
+		case "maplib":
+			// The texture libraries are not read, usemap names are stored as the texture path.
+			Logf(LOG_VERBOSE, "Texture libraries %s\n", strings.Join(lineParts[1:], " "))
+		case "o", "g":
+			if len(lineParts) > 1 {
+				m.curObjectName = lineParts[1]
+			} else {
+				m.curObjectName = ""
+			}
+			Logf(LOG_VERBOSE, "Object %s\n", m.curObjectName)
+		case "lod":
+			var level int
+			if len(lineParts) != 2 {
+				Logf(LOG_WARN, "Warning: Line %d: Malformed lod statement, ignoring it.\n", lineNumber)
+			} else if _, err := fmt.Sscanf(lineParts[1], "%d", &level); err != nil || level < 0 || level > 100 {
+				Logf(LOG_WARN, "Warning: Line %d: lod %s is not a level from 0 to 100, ignoring it.\n", lineNumber, lineParts[1])
+			} else {
+				m.objLOD = level
+				Logf(LOG_VERBOSE, "Level of detail %d\n", level)
+			}
+		case "bevel", "c_interp", "d_interp", "shadow_obj", "trace_obj":
+			// Rendering attributes only affect how a renderer draws the surface, the geometry is unchanged.
+			Logf(LOG_VERBOSE, "Ignoring rendering attribute %s\n", line)
+		case "mtllib":
+			for _, materialFileName := range lineParts[1:] {
+				if !slices.Contains(m.materialLibraries, materialFileName) {
+					m.materialLibraries = append(m.materialLibraries, materialFileName)
+				}
+				err := m.ProcessMaterialFile(materialFileName, filepath.Dir(m.inputFileName))
+				if err != nil {
+					Logf(LOG_ERROR, "Error processing material file: %v\n", err)
+					return err
+				}
+			}
+		case "f":
+			face, err := ParseFace(line, lineParts, lineNumber)
+			if err != nil {
+				return err
+			}
+			face.materialName = m.curMaterialName
+			face.textureMap = m.curTextureMap
+			face.objectName = m.curObjectName
+			m.faces = append(m.faces, face)
+		case "l":
+			polyline, err := ParseLineElement(line, lineParts, lineNumber, len(m.vertices), len(m.textureCoords))
+			if err != nil {
+				return err
+			}
+			polyline.objectName = m.curObjectName
+			m.polylines = append(m.polylines, polyline)
+		case "p":
+			elementPoints, err := ParsePointElement(line, lineParts, lineNumber, len(m.vertices))
+			if err != nil {
+				return err
+			}
+			for i := range elementPoints {
+				elementPoints[i].objectName = m.curObjectName
+			}
+			m.points = append(m.points, elementPoints...)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		LogScanError(m.inputFileName, err)
+		return err
+	}
+
+	// Fold the usemap textures into materials now every mtllib has been read.
+	for i := range m.faces {
+		if m.faces[i].textureMap != "" {
+			m.faces[i].materialName = m.TextureMapMaterial(m.faces[i].materialName, m.faces[i].textureMap)
+		}
+	}
+
+	return nil
+}
+
+// Parse a 'usemap' line, 'usemap off' or a bare 'usemap' stops using a texture map.
+func ParseUseMap(line string) string {
+	name := strings.TrimSpace(line[len("usemap"):])
+	if name == "off" {
+		return ""
+	}
+	return name
+}
+
+// Find or create the material for faces using textureMap with the material materialName. It is
+// a copy of the material, or of the default material if that is not defined, with the texture
+// replaced by textureMap, so usemap overrides the map_Kd of the current usemtl.
+func (m *Mesh) TextureMapMaterial(materialName string, textureMap string) string {
+	name := materialName + "@" + textureMap
+	if _, ok := m.materialMap[name]; ok {
+		return name
+	}
+	var mat Material = Material{diffuse: [3]float32{1, 1, 1}}
+	if idx, ok := m.materialMap[materialName]; ok {
+		mat = m.materials[idx]
+	} else if materialName != "" {
+		Logf(LOG_WARN, "Warning: Material %s is not defined, using the default material with texture map %s.\n", materialName, textureMap)
+	}
+	mat.name = name
+	mat.texture = textureMap
+	m.materials = append(m.materials, mat)
+	m.materialMap[name] = uint32(len(m.materials) - 1)
+	Logf(LOG_VERBOSE, "Defining Material %s for texture map %s\n", name, textureMap)
+	return name
+}
+
+// Read only the vertex positions from an OBJ file.
+func ReadOBJPositions(fileName string) ([]Vertex, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		Logf(LOG_ERROR, "Error opening file %s: %v\n", fileName, err)
+		return nil, err
+	}
+	defer file.Close()
+
+	var positions []Vertex
+	var scanner LineScanner = NewLineScanner(file)
+	for scanner.Scan() {
+		lineParts := strings.Fields(StripComment(scanner.Text()))
+		if len(lineParts) < 4 || lineParts[0] != "v" {
+			continue
+		}
+		var v Vertex
+		fmt.Sscanf(strings.Join(lineParts[1:4], " "), "%f %f %f", &v.X, &v.Y, &v.Z)
+		if *precisePtr {
+			v.precise = parsePrecise(lineParts[1:4], v)
+		}
+		positions = append(positions, v)
+	}
+	if err := scanner.Err(); err != nil {
+		LogScanError(fileName, err)
+		return nil, err
+	}
+	return positions, nil
+}
+
+// Store the offset of each vertex to its position in the second pose as its velocity.
+func (m *Mesh) ApplyPose2(fileName string) error {
+	pose2, err := ReadOBJPositions(fileName)
+	if err != nil {
+		return err
+	}
+	if len(pose2) != len(m.vertices) {
+		Logf(LOG_ERROR, "Error: Second pose has %d vertices but the mesh has %d.\n", len(pose2), len(m.vertices))
+		return errors.New("pose vertex counts do not match")
+	}
+	for i := range m.vertices {
+		m.vertices[i].velocity = [3]float32{pose2[i].X - m.vertices[i].X, pose2[i].Y - m.vertices[i].Y, pose2[i].Z - m.vertices[i].Z}
+		if *precisePtr {
+			// Small motions far from the origin are lost when both float positions are rounded.
+			for k := 0; k < 3; k++ {
+				m.vertices[i].velocity[k] = float32(pose2[i].precise[k] - m.vertices[i].precise[k])
+			}
+		}
+	}
+	m.vertexType |= VERTEX_VELOCITY
+	Logf(LOG_INFO, "Stored velocities from second pose %s\n", fileName)
+	return nil
+}
+
+// Check an index is within a stream of count entries. Out of range indices are an error unless
+// -clamp-indices selects clamp or wrap, in which case the index is corrected and true returned.
+func checkIndex(idx *uint32, count int, kind string, line int) (bool, error) {
+	if *idx < uint32(count) {
+		return false, nil
+	}
+	if *clampIndicesPtr == "error" || count == 0 {
+		Logf(LOG_ERROR, "Error: Face on line %d references %s %d, but only %d are defined.\n", line, kind, int32(*idx)+1, count)
+		return false, fmt.Errorf("face on line %d has out of range %s index", line, kind)
+	}
+	var fixed uint32
+	switch *clampIndicesPtr {
+	case "clamp":
+		fixed = uint32(count - 1)
+		if int32(*idx) < 0 {
+			fixed = 0
+		}
+	case "wrap":
+		fixed = *idx % uint32(count)
+	case "drop":
+		Logf(LOG_WARN, "Warning: Face on line %d references %s %d, but only %d are defined, dropping face.\n", line, kind, int32(*idx)+1, count)
+		return true, nil
+	}
+	Logf(LOG_WARN, "Warning: Face on line %d references %s %d, but only %d are defined, using %d.\n", line, kind, int32(*idx)+1, count, fixed+1)
+	*idx = fixed
+	return true, nil
+}
+
+// Check every face index refers to an entry that exists in the parsed data
+func (m *Mesh) ValidateFaceIndices() error {
+	var keep []Face
+	var fixedFaces, dropped int = 0, 0
+	for i := range m.faces {
+		var fixed bool = false
+		for j := 0; j < len(m.faces[i].v); j++ {
+			f, err := checkIndex(&m.faces[i].v[j], len(m.vertices), "vertex", m.faces[i].line)
+			if err != nil {
+				return err
+			}
+			fixed = fixed || f
+		}
+		for j := 0; j < len(m.faces[i].n); j++ {
+			f, err := checkIndex(&m.faces[i].n[j], len(m.normals), "normal", m.faces[i].line)
+			if err != nil {
+				return err
+			}
+			fixed = fixed || f
+		}
+		for j := 0; j < len(m.faces[i].uv); j++ {
+			f, err := checkIndex(&m.faces[i].uv[j], len(m.textureCoords), "texture coord", m.faces[i].line)
+			if err != nil {
+				return err
+			}
+			fixed = fixed || f
+		}
+		if fixed && *clampIndicesPtr == "drop" {
+			dropped++
+			continue
+		}
+		if fixed {
+			fixedFaces++
+			// Clamping can make a face reuse one of its own vertices.
+			var used map[uint32]bool = make(map[uint32]bool)
+			for j := 0; j < len(m.faces[i].v); j++ {
+				used[m.faces[i].v[j]] = true
+			}
+			if len(used) < len(m.faces[i].v) {
+				Logf(LOG_WARN, "Warning: Face on line %d is degenerate after correcting its indices.\n", m.faces[i].line)
+			}
+		}
+		keep = append(keep, m.faces[i])
+	}
+	if fixedFaces > 0 || dropped > 0 {
+		Logf(LOG_INFO, "Corrected %d faces and dropped %d faces with out of range indices.\n", fixedFaces, dropped)
+	}
+	m.faces = keep
+	return nil
+}
+
+// Normals and texture coords must be used by every face or by none, so that the index lists
+// written for each face match the streams in the header. Unused streams are dropped.
+func (m *Mesh) ValidateFaceAttributes() error {
+	var withNormals, withUVs int = 0, 0
+	for i := range m.faces {
+		if len(m.faces[i].n) > 0 {
+			withNormals++
+		}
+		if len(m.faces[i].uv) > 0 {
+			withUVs++
+		}
+	}
+	if withNormals != 0 && withNormals != len(m.faces) {
+		Logf(LOG_ERROR, "Error: %d of %d faces have normals, either all or no faces must have normals.\n", withNormals, len(m.faces))
+		return errors.New("faces mix normals and no normals")
+	}
+	if withUVs != 0 && withUVs != len(m.faces) {
+		Logf(LOG_ERROR, "Error: %d of %d faces have texture coords, either all or no faces must have texture coords.\n", withUVs, len(m.faces))
+		return errors.New("faces mix texture coords and no texture coords")
+	}
+	if withNormals == 0 && len(m.normals) > 0 {
+		Logf(LOG_WARN, "Warning: Normals are defined but not used by any face, discarding them.\n")
+		m.normals = nil
+	}
+	if withUVs == 0 && len(m.textureCoords) > 0 {
+		Logf(LOG_WARN, "Warning: Texture coords are defined but not used by any face, discarding them.\n")
+		m.textureCoords = nil
+		for i := range m.polylines {
+			m.polylines[i].uv = nil
+		}
+	}
+	return nil
+}
+
+// Keep only the faces belonging to one of the named objects
+func (m *Mesh) FilterObjects(names []string) error {
+	var keep []Face
+	for i := range m.faces {
+		if slices.Contains(names, m.faces[i].objectName) {
+			keep = append(keep, m.faces[i])
+		}
+	}
+	if len(keep) == 0 {
+		Logf(LOG_ERROR, "Error: None of the objects %v were found.\n", names)
+		return errors.New("no faces found for selected objects")
+	}
+	Logf(LOG_INFO, "Selected %d of %d faces from objects %v\n", len(keep), len(m.faces), names)
+	m.faces = keep
+	m.FilterElements(names)
+	m.PruneUnreferenced()
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import "slices"
+
+func Morton3D(x, y, z uint32) uint32 {
+	return interleaveBits(x) | (interleaveBits(y) << 1) | (interleaveBits(z) << 2)
+}
+
+func interleaveBits(x uint32) uint32 {
+	x = (x | (x << 16)) & 0x030000FF
+	x = (x | (x << 8)) & 0x0300F00F
+	x = (x | (x << 4)) & 0x030C30C3
+	x = (x | (x << 2)) & 0x09249249
+	return x
+}
+
+// Stable sort the faces front to back by the distance of their centroid along the view direction.
+func (m *Mesh) SortFacesByDepth(cam, dir [3]float32) {
+	depth := func(f *Face) float32 {
+		var d float32 = 0
+		for j := 0; j < int(f.edges); j++ {
+			v := m.vertices[f.v[j]]
+			d += (v.X-cam[0])*dir[0] + (v.Y-cam[1])*dir[1] + (v.Z-cam[2])*dir[2]
+		}
+		return d / float32(f.edges)
+	}
+	slices.SortStableFunc(m.faces, func(a, b Face) int {
+		da, db := depth(&a), depth(&b)
+		if da < db {
+			return -1
+		} else if da > db {
+			return 1
+		}
+		return 0
+	})
+	Logf(LOG_INFO, "Sorted faces front to back from %v along %v\n", cam, dir)
+}
+
+// Number of Morton grid cells along each axis, Morton3D interleaves 10 bits per axis.
+const MORTON_RESOLUTION uint32 = 1024
+
+// Map a centroid coordinate into a grid cell in [0, resolution-1], a zero extent maps to cell 0.
+func quantizeCentroid(c, min, max float32, resolution uint32) uint32 {
+	if max <= min {
+		return 0
+	}
+	var t float32 = (c - min) / (max - min) * float32(resolution)
+	if !(t > 0) {
+		return 0
+	}
+	if t >= float32(resolution-1) {
+		return resolution - 1
+	}
+	return uint32(t)
+}
+
+func (m *Mesh) OptimiseMesh(resolution uint32) {
+	// Quantize within a tight box around the vertices, the bounding sphere over-estimates the
+	// extents and may not have been generated
+	lo, hi := MinMax(m.vertices)
+	m.optimiseMeshInBox(resolution, lo, hi)
+}
+
+// Sort the faces by the Morton code of their centroids quantized within the box lo-hi, then
+// renumber the vertices, normals and texture coords in the order the faces use them.
+func (m *Mesh) optimiseMeshInBox(resolution uint32, lo, hi Vertex) {
+	resolution = min(max(resolution, 1), MORTON_RESOLUTION)
+	var extents = [6]float32{lo.X, lo.Y, lo.Z, hi.X, hi.Y, hi.Z}
+
+	for i := 0; i < len(m.faces); i++ {
+		// Find the centroid of the face
+		var cx float32 = 0.0
+		var cy float32 = 0.0
+		var cz float32 = 0.0
+		for j := 0; j < int(m.faces[i].edges); j++ {
+			cx += m.vertices[m.faces[i].v[j]].X
+			cy += m.vertices[m.faces[i].v[j]].Y
+			cz += m.vertices[m.faces[i].v[j]].Z
+		}
+		cx /= float32(m.faces[i].edges)
+		cy /= float32(m.faces[i].edges)
+		cz /= float32(m.faces[i].edges)
+
+		// Quantize the centroid within the mesh extents to the range [0 - resolution-1]
+		var icx uint32 = quantizeCentroid(cx, extents[0], extents[3], resolution)
+		var icy uint32 = quantizeCentroid(cy, extents[1], extents[4], resolution)
+		var icz uint32 = quantizeCentroid(cz, extents[2], extents[5], resolution)
+
+		m.faces[i].mortonCode = Morton3D(icx, icy, icz)
+	}
+
+	// Sort the faces based on their Morton Code
+	slices.SortFunc(m.faces, func(a, b Face) int {
+		if a.mortonCode < b.mortonCode {
+			return -1
+		} else if a.mortonCode > b.mortonCode {
+			return 1
+		}
+		return 0
+	})
+
+	// Remap face->vertex references, numbering the vertices in the order the sorted faces first
+	// use them. Every index is read before it is rewritten so old and new indices never mix.
+	var newVertices = []Vertex{}
+	var vertexRemap = make([]uint32, len(m.vertices))
+	for i := 0; i < len(m.faces); i++ {
+		for j := 0; j < int(m.faces[i].edges); j++ {
+			vidx := m.faces[i].v[j]
+			if !m.vertices[vidx].flushed {
+				vertexRemap[vidx] = uint32(len(newVertices))
+				newVertices = append(newVertices, m.vertices[vidx])
+				m.vertices[vidx].flushed = true
+			}
+			m.faces[i].v[j] = vertexRemap[vidx]
+		}
+	}
+	// Vertices only used by lines and points follow on after the face vertices.
+	m.ForEachElementVertex(func(v uint32) {
+		if !m.vertices[v].flushed {
+			vertexRemap[v] = uint32(len(newVertices))
+			newVertices = append(newVertices, m.vertices[v])
+			m.vertices[v].flushed = true
+		}
+	})
+	m.RemapElements(func(v uint32) uint32 { return vertexRemap[v] }, nil)
+	m.vertices = newVertices
+
+	// Remap face->normal references
+	var newNormals = []Normal{}
+	var normalRemap = make([]uint32, len(m.normals))
+	for i := 0; i < len(m.faces); i++ {
+		for j := 0; j < len(m.faces[i].n); j++ {
+			nidx := m.faces[i].n[j]
+			if !m.normals[nidx].flushed {
+				normalRemap[nidx] = uint32(len(newNormals))
+				newNormals = append(newNormals, m.normals[nidx])
+				m.normals[nidx].flushed = true
+			}
+			m.faces[i].n[j] = normalRemap[nidx]
+		}
+	}
+	m.normals = newNormals
+
+	// Remap face->uv references
+	var newTextureCoords = []TextureCoord{}
+	var uvRemap = make([]uint32, len(m.textureCoords))
+	for i := 0; i < len(m.faces); i++ {
+		for j := 0; j < len(m.faces[i].uv); j++ {
+			tidx := m.faces[i].uv[j]
+			if !m.textureCoords[tidx].flushed {
+				uvRemap[tidx] = uint32(len(newTextureCoords))
+				newTextureCoords = append(newTextureCoords, m.textureCoords[tidx])
+				m.textureCoords[tidx].flushed = true
+			}
+			m.faces[i].uv[j] = uvRemap[tidx]
+		}
+	}
+	m.ForEachElementUV(func(uv uint32) {
+		if !m.textureCoords[uv].flushed {
+			uvRemap[uv] = uint32(len(newTextureCoords))
+			newTextureCoords = append(newTextureCoords, m.textureCoords[uv])
+			m.textureCoords[uv].flushed = true
+		}
+	})
+	m.RemapElements(nil, func(uv uint32) uint32 { return uvRemap[uv] })
+	m.textureCoords = newTextureCoords
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Choose the byte order based on the flags
+func OutputByteOrder() binary.ByteOrder {
+	if *lePtr {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// Buffer the output while keeping a CRC32 of every byte written through the buffer.
+func newChecksumWriter(outputFile io.Writer) (*bufio.Writer, hash.Hash32) {
+	checksum := crc32.NewIEEE()
+	return bufio.NewWriter(io.MultiWriter(outputFile, checksum)), checksum
+}
+
+// Flush the buffered output and append the CRC32 of everything written before it.
+func writeChecksum(writer *bufio.Writer, checksum hash.Hash32, outputFile io.Writer, byteOrder binary.ByteOrder) error {
+	if err := writer.Flush(); err != nil {
+		Logf(LOG_ERROR, "Error flushing writer: %v\n", err)
+		return err
+	}
+	if err := binary.Write(outputFile, byteOrder, checksum.Sum32()); err != nil {
+		Logf(LOG_ERROR, "Error writing checksum: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+func (m *Mesh) writeHeader(writer *bufio.Writer, byteOrder binary.ByteOrder, vertexCount, normalCount, uvCount, faceCount, lineCount, pointCount uint32) {
+	binary.Write(writer, byteOrder, []byte("MSHX"))           // Magic header
+	binary.Write(writer, byteOrder, MSHX_VERSION)             // Version number
+	binary.Write(writer, byteOrder, vertexCount)              // Number of vertices
+	binary.Write(writer, byteOrder, normalCount)              // Number of normals
+	binary.Write(writer, byteOrder, uint32(len(m.tangents)))  // Number of tangent vectors
+	binary.Write(writer, byteOrder, uvCount)                  // Number of texture coordinates
+	binary.Write(writer, byteOrder, faceCount)                // Number of faces
+	binary.Write(writer, byteOrder, uint32(len(m.materials))) // Number of materials
+	binary.Write(writer, byteOrder, lineCount)                // Number of line elements
+	binary.Write(writer, byteOrder, pointCount)               // Number of point elements
+	binary.Write(writer, byteOrder, uint32(len(m.lodRanges))) // Number of levels of detail
+
+	binary.Write(writer, byteOrder, m.vertexType|FILE_CHECKSUM)
+	binary.Write(writer, byteOrder, m.indexType)
+	binary.Write(writer, byteOrder, m.meshUnit)
+
+	binary.Write(writer, byteOrder, m.boundSphere.center.X)
+	binary.Write(writer, byteOrder, m.boundSphere.center.Y)
+	binary.Write(writer, byteOrder, m.boundSphere.center.Z)
+	binary.Write(writer, byteOrder, m.boundSphere.radius)
+
+	binary.Write(writer, byteOrder, m.boundBox.min.X)
+	binary.Write(writer, byteOrder, m.boundBox.min.Y)
+	binary.Write(writer, byteOrder, m.boundBox.min.Z)
+	binary.Write(writer, byteOrder, m.boundBox.max.X)
+	binary.Write(writer, byteOrder, m.boundBox.max.Y)
+	binary.Write(writer, byteOrder, m.boundBox.max.Z)
+
+	if m.vertexType&VERTEX_QUANTIZED != 0 {
+		binary.Write(writer, byteOrder, m.positionScale)
+		binary.Write(writer, byteOrder, m.positionBias)
+	}
+}
+
+func (m *Mesh) writeVertex(writer *bufio.Writer, byteOrder binary.ByteOrder, v *Vertex) {
+	if m.vertexType&VERTEX_QUANTIZED != 0 {
+		binary.Write(writer, byteOrder, m.quantizePosition(v.X, 0))
+		binary.Write(writer, byteOrder, m.quantizePosition(v.Y, 1))
+		binary.Write(writer, byteOrder, m.quantizePosition(v.Z, 2))
+	} else {
+		binary.Write(writer, byteOrder, v.X)
+		binary.Write(writer, byteOrder, v.Y)
+		binary.Write(writer, byteOrder, v.Z)
+	}
+	if m.vertexType&VERTEX_W != 0 {
+		binary.Write(writer, byteOrder, v.W)
+	}
+	if m.vertexType&VERTEX_COLOR != 0 {
+		// Same channel order as the OBJ 'v x y z r g b a' line
+		binary.Write(writer, byteOrder, v.R)
+		binary.Write(writer, byteOrder, v.G)
+		binary.Write(writer, byteOrder, v.B)
+		binary.Write(writer, byteOrder, v.A)
+	}
+	if m.vertexType&VERTEX_VELOCITY != 0 {
+		binary.Write(writer, byteOrder, v.velocity)
+	}
+}
+
+func writeNormal(writer *bufio.Writer, byteOrder binary.ByteOrder, n *Normal) {
+	binary.Write(writer, byteOrder, n.X)
+	binary.Write(writer, byteOrder, n.Y)
+	binary.Write(writer, byteOrder, n.Z)
+}
+
+func (m *Mesh) writeTextureCoord(writer *bufio.Writer, byteOrder binary.ByteOrder, t *TextureCoord) {
+	binary.Write(writer, byteOrder, t.U)
+	binary.Write(writer, byteOrder, t.V)
+	if m.vertexType&UV_W != 0 {
+		binary.Write(writer, byteOrder, t.W)
+	}
+}
+
+func (m *Mesh) writeFace(writer *bufio.Writer, byteOrder binary.ByteOrder, f *Face) {
+	binary.Write(writer, byteOrder, f.edges)
+	for j := 0; j < int(f.edges); j++ {
+		binary.Write(writer, byteOrder, f.v[j])
+	}
+	if m.indexType == 0 {
+		for j := 0; j < len(f.n); j++ {
+			binary.Write(writer, byteOrder, f.n[j])
+		}
+		for j := 0; j < len(f.t); j++ {
+			binary.Write(writer, byteOrder, f.t[j])
+		}
+		for j := 0; j < len(f.uv); j++ {
+			binary.Write(writer, byteOrder, f.uv[j])
+		}
+	}
+	binary.Write(writer, byteOrder, f.materialID)
+}
+
+func (m *Mesh) writeMaterials(writer *bufio.Writer, byteOrder binary.ByteOrder) {
+	for i := 0; i < len(m.materials); i++ {
+		binary.Write(writer, byteOrder, m.materials[i].diffuse)
+		binary.Write(writer, byteOrder, m.materials[i].specular)
+		binary.Write(writer, byteOrder, m.materials[i].ambient)
+		binary.Write(writer, byteOrder, m.materials[i].transmissive)
+		binary.Write(writer, byteOrder, m.materials[i].emissive)
+		binary.Write(writer, byteOrder, m.materials[i].power)
+		binary.Write(writer, byteOrder, m.materials[i].transparency)
+		binary.Write(writer, byteOrder, m.materials[i].refractivity)
+		binary.Write(writer, byteOrder, m.materials[i].illum)
+		binary.Write(writer, byteOrder, m.materials[i].roughness)
+		binary.Write(writer, byteOrder, m.materials[i].metallic)
+		binary.Write(writer, byteOrder, m.materials[i].sheen)
+		binary.Write(writer, byteOrder, m.materials[i].clearcoat_thickness)
+		binary.Write(writer, byteOrder, m.materials[i].clearcoat_roughness)
+		binary.Write(writer, byteOrder, m.materials[i].aniso)
+		binary.Write(writer, byteOrder, m.materials[i].aniso_rotation)
+		binary.Write(writer, byteOrder, uint32(len(m.materials[i].texture)))
+		writer.WriteString(m.materials[i].texture)
+		binary.Write(writer, byteOrder, uint32(len(m.materials[i].name)))
+		writer.WriteString(m.materials[i].name)
+	}
+}
+
+// Write the mesh as an MSHX file. The buffered writer keeps the first error from the file and
+// fails every write after it, so the write calls are not checked one by one and the error is
+// reported once when the buffer is flushed.
+func (m *Mesh) WriteOutput(outputFile io.Writer) error {
+	writer, checksum := newChecksumWriter(outputFile)
+	byteOrder := OutputByteOrder()
+
+	var faceCount uint32 = uint32(len(m.faces))
+	if m.vertexType&TRIANGLE_STRIPS != 0 {
+		faceCount = uint32(len(m.triangleStrips))
+	}
+	m.writeHeader(writer, byteOrder, uint32(len(m.vertices)), uint32(len(m.normals)), uint32(len(m.textureCoords)), faceCount, uint32(len(m.polylines)), uint32(len(m.points)))
+
+	for i := 0; i < len(m.vertices); i++ {
+		m.writeVertex(writer, byteOrder, &m.vertices[i])
+		if m.indexType == INDEX_INTERLEAVED {
+			if len(m.normals) > 0 {
+				writeNormal(writer, byteOrder, &m.normals[i])
+			}
+			if len(m.textureCoords) > 0 {
+				m.writeTextureCoord(writer, byteOrder, &m.textureCoords[i])
+			}
+		}
+	}
+
+	if m.indexType != INDEX_INTERLEAVED {
+		for i := 0; i < len(m.normals); i++ {
+			writeNormal(writer, byteOrder, &m.normals[i])
+		}
+	}
+
+	for i := 0; i < len(m.tangents); i++ {
+		writeTangent(writer, byteOrder, &m.tangents[i])
+	}
+
+	if m.indexType != INDEX_INTERLEAVED {
+		for i := 0; i < len(m.textureCoords); i++ {
+			m.writeTextureCoord(writer, byteOrder, &m.textureCoords[i])
+		}
+	}
+
+	if m.vertexType&TRIANGLE_STRIPS != 0 {
+		for i := 0; i < len(m.triangleStrips); i++ {
+			writeTriangleStrip(writer, byteOrder, &m.triangleStrips[i])
+		}
+	} else {
+		for i := 0; i < len(m.faces); i++ {
+			m.writeFace(writer, byteOrder, &m.faces[i])
+		}
+	}
+
+	for i := 0; i < len(m.polylines); i++ {
+		m.writePolyline(writer, byteOrder, &m.polylines[i])
+	}
+
+	for i := 0; i < len(m.points); i++ {
+		writePoint(writer, byteOrder, &m.points[i])
+	}
+
+	m.writeMaterials(writer, byteOrder)
+
+	if m.materialRanges != nil {
+		m.writeMaterialRanges(writer, byteOrder)
+	}
+
+	if len(m.lodRanges) > 0 {
+		m.writeLODRanges(writer, byteOrder)
+	}
+
+	if m.vertexType&VERTEX_SPLITS != 0 {
+		writer.WriteString("VSPL")
+		binary.Write(writer, byteOrder, m.baseVertexCount)
+		binary.Write(writer, byteOrder, uint32(len(m.vertexSplits)))
+		for i := range m.vertexSplits {
+			binary.Write(writer, byteOrder, m.vertexSplits[i].source)
+			binary.Write(writer, byteOrder, m.vertexSplits[i].vertex)
+			binary.Write(writer, byteOrder, uint32(len(m.vertexSplits[i].corners)))
+			for _, c := range m.vertexSplits[i].corners {
+				binary.Write(writer, byteOrder, c.face)
+				binary.Write(writer, byteOrder, c.corner)
+			}
+			binary.Write(writer, byteOrder, uint32(len(m.vertexSplits[i].newFaces)))
+			for j := range m.vertexSplits[i].newFaces {
+				m.writeFace(writer, byteOrder, &m.vertexSplits[i].newFaces[j])
+			}
+		}
+	}
+
+	// Flush the writer to ensure all data is written to the file, followed by the checksum
+	return writeChecksum(writer, checksum, outputFile, byteOrder)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWriteOutputToBuffer(t *testing.T) {
+	resetCommandLine()
+	m := NewMesh()
+	*lePtr = true
+	for i := 0; i < 300; i++ {
+		m.vertices = append(m.vertices, Vertex{X: float32(i), Y: float32(i % 7), Z: float32(i % 3), W: 1})
+	}
+	for i := 0; i+2 < len(m.vertices); i += 3 {
+		m.faces = append(m.faces, Face{edges: 3, v: []uint32{uint32(i), uint32(i + 1), uint32(i + 2)}})
+	}
+	var buffer bytes.Buffer
+	if err := m.WriteOutput(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	file := readOutput(t, buffer.Bytes())
+	if len(file.vertices) != len(m.vertices) {
+		t.Fatalf("read back %d vertices, want %d", len(file.vertices), len(m.vertices))
+	}
+	for i, v := range file.vertices {
+		if v.X != m.vertices[i].X || v.Y != m.vertices[i].Y || v.Z != m.vertices[i].Z {
+			t.Errorf("vertex %d read back as %g,%g,%g, want %g,%g,%g", i, v.X, v.Y, v.Z, m.vertices[i].X, m.vertices[i].Y, m.vertices[i].Z)
+			break
+		}
+	}
+	if len(file.faces) != len(m.faces) {
+		t.Fatalf("read back %d faces, want %d", len(file.faces), len(m.faces))
+	}
+	for i := range m.faces {
+		if !slices.Equal(file.faces[i].v, m.faces[i].v) {
+			t.Errorf("face %d read back as %v, want %v", i, file.faces[i].v, m.faces[i].v)
+			break
+		}
+	}
+}
+
+var errDiskFull = errors.New("disk full")
+
+// A writer which takes limit bytes and then fails, as a file does when the disk fills.
+type failingWriter struct {
+	limit   int
+	written int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > w.limit {
+		n := w.limit - w.written
+		w.written = w.limit
+		return n, errDiskFull
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestWriteOutputReportsWriteErrors(t *testing.T) {
+	resetCommandLine()
+	*lePtr = true
+	m := loadDuplicatedMesh(3000)
+	size := &failingWriter{limit: 1 << 30}
+	if err := m.WriteOutput(size); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fail at the start, inside the buffered body and on the checksum at the very end.
+	for _, limit := range []int{0, 100, size.written / 2, size.written - 1} {
+		if err := m.WriteOutput(&failingWriter{limit: limit}); !errors.Is(err, errDiskFull) {
+			t.Errorf("failing after %d of %d bytes returned %v, want the write error", limit, size.written, err)
+		}
+	}
+	if err := m.WriteOutput(&failingWriter{limit: size.written}); err != nil {
+		t.Errorf("a writer with room for the whole file failed: %v", err)
+	}
+}
+
+func TestConvertFailsOnFullDisk(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full to write to")
+	}
+	dir := writeFiles(t, map[string]string{"in.obj": gridOBJ(40)})
+	resetCommandLine()
+	if err := Convert([]string{filepath.Join(dir, "in.obj"), "/dev/full"}); err == nil {
+		t.Error("converting onto a full disk succeeded")
+	}
+}
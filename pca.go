@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"math"
+)
+
+// Find the eigenvalues and eigenvectors of a symmetric 3x3 matrix using Jacobi rotations.
+// The eigenvectors are returned as the columns of the matrix.
+func JacobiEigen3(a [3][3]float64) (values [3]float64, vectors [3][3]float64) {
+	vectors = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for sweep := 0; sweep < 50; sweep++ {
+		off := a[0][1]*a[0][1] + a[0][2]*a[0][2] + a[1][2]*a[1][2]
+		if off < 1e-20 {
+			break
+		}
+		for p := 0; p < 2; p++ {
+			for q := p + 1; q < 3; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				// Apply the rotation J^T A J
+				for k := 0; k < 3; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p] = c*akp - s*akq
+					a[k][q] = s*akp + c*akq
+				}
+				for k := 0; k < 3; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k] = c*apk - s*aqk
+					a[q][k] = s*apk + c*aqk
+				}
+				for k := 0; k < 3; k++ {
+					vkp, vkq := vectors[k][p], vectors[k][q]
+					vectors[k][p] = c*vkp - s*vkq
+					vectors[k][q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+	return [3]float64{a[0][0], a[1][1], a[2][2]}, vectors
+}
+
+// Compute the principal axes of the vertex positions, ordered from largest to smallest variance.
+func PrincipalAxes(points []Vertex) (centroid [3]float64, axes [3][3]float64) {
+	for _, p := range points {
+		position := p.position()
+		centroid[0] += position[0]
+		centroid[1] += position[1]
+		centroid[2] += position[2]
+	}
+	for i := 0; i < 3; i++ {
+		centroid[i] /= float64(len(points))
+	}
+
+	var cov [3][3]float64
+	for _, p := range points {
+		position := p.position()
+		d := [3]float64{position[0] - centroid[0], position[1] - centroid[1], position[2] - centroid[2]}
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				cov[i][j] += d[i] * d[j]
+			}
+		}
+	}
+
+	values, vectors := JacobiEigen3(cov)
+	order := [3]int{0, 1, 2}
+	for i := 0; i < 3; i++ {
+		for j := i + 1; j < 3; j++ {
+			if values[order[j]] > values[order[i]] {
+				order[i], order[j] = order[j], order[i]
+			}
+		}
+	}
+	for i := 0; i < 3; i++ {
+		axes[i] = [3]float64{vectors[0][order[i]], vectors[1][order[i]], vectors[2][order[i]]}
+	}
+
+	// Keep the basis right handed so the mesh is rotated and not mirrored.
+	axes[2][0], axes[2][1], axes[2][2] = crossProduct(axes[0][0], axes[0][1], axes[0][2], axes[1][0], axes[1][1], axes[1][2])
+	return centroid, axes
+}
+
+// Rotate the mesh about its centroid so the largest principal axis lies along the given axis
+// (0=x, 1=y, 2=z), the remaining principal axes follow on cyclically.
+func (m *Mesh) AlignPCA(axis int) error {
+	if len(m.vertices) < 3 {
+		Logf(LOG_ERROR, "Error: PCA alignment requires at least 3 vertices.\n")
+		return errors.New("not enough vertices for PCA")
+	}
+	centroid, axes := PrincipalAxes(m.vertices)
+
+	// Row k of the rotation takes a point onto principal axis k, placed into the target slot.
+	var rotation [3][3]float64
+	for k := 0; k < 3; k++ {
+		rotation[(axis+k)%3] = axes[k]
+	}
+
+	for i := range m.vertices {
+		position := m.vertices[i].position()
+		d := [3]float64{position[0] - centroid[0], position[1] - centroid[1], position[2] - centroid[2]}
+		m.vertices[i].setPosition(dotProduct(rotation[0][0], rotation[0][1], rotation[0][2], d[0], d[1], d[2])+centroid[0],
+			dotProduct(rotation[1][0], rotation[1][1], rotation[1][2], d[0], d[1], d[2])+centroid[1],
+			dotProduct(rotation[2][0], rotation[2][1], rotation[2][2], d[0], d[1], d[2])+centroid[2])
+	}
+	for i := range m.vertices {
+		vx, vy, vz := float64(m.vertices[i].velocity[0]), float64(m.vertices[i].velocity[1]), float64(m.vertices[i].velocity[2])
+		m.vertices[i].velocity[0] = float32(dotProduct(rotation[0][0], rotation[0][1], rotation[0][2], vx, vy, vz))
+		m.vertices[i].velocity[1] = float32(dotProduct(rotation[1][0], rotation[1][1], rotation[1][2], vx, vy, vz))
+		m.vertices[i].velocity[2] = float32(dotProduct(rotation[2][0], rotation[2][1], rotation[2][2], vx, vy, vz))
+	}
+	for i := range m.normals {
+		nx, ny, nz := float64(m.normals[i].X), float64(m.normals[i].Y), float64(m.normals[i].Z)
+		m.normals[i].X = float32(dotProduct(rotation[0][0], rotation[0][1], rotation[0][2], nx, ny, nz))
+		m.normals[i].Y = float32(dotProduct(rotation[1][0], rotation[1][1], rotation[1][2], nx, ny, nz))
+		m.normals[i].Z = float32(dotProduct(rotation[2][0], rotation[2][1], rotation[2][2], nx, ny, nz))
+	}
+
+	Logf(LOG_INFO, "Aligned principal axes %v to %c\n", axes, 'x'+axis)
+	return nil
+}
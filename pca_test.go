@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// Points spread along dir with a little spread across it, centred on 1,2,3.
+func rodAlong(dir [3]float64) []Vertex {
+	length := math.Sqrt(dir[0]*dir[0] + dir[1]*dir[1] + dir[2]*dir[2])
+	var points []Vertex
+	for i := -10; i <= 10; i++ {
+		s := float64(i) / length
+		for _, o := range [][3]float64{{0.1, 0, 0}, {-0.1, 0, 0}, {0, 0.1, 0}, {0, -0.1, 0}} {
+			points = append(points, Vertex{X: float32(1 + dir[0]*s + o[0]), Y: float32(2 + dir[1]*s + o[1]), Z: float32(3 + dir[2]*s + o[2]), W: 1})
+		}
+	}
+	return points
+}
+
+func TestAlignPCAPutsPrincipalAxisOnX(t *testing.T) {
+	resetCommandLine()
+	m := NewMesh()
+	m.vertices = rodAlong([3]float64{1, 2, 3})
+	if err := m.AlignPCA(0); err != nil {
+		t.Fatal(err)
+	}
+
+	min, max := MinMax(m.vertices)
+	if max.X-min.X < 19 {
+		t.Errorf("the rod spans %g along x, want its length of 20", max.X-min.X)
+	}
+	if max.Y-min.Y > 1 || max.Z-min.Z > 1 {
+		t.Errorf("the rod spans %g along y and %g along z, want only its width", max.Y-min.Y, max.Z-min.Z)
+	}
+	// The rotation is about the centroid, which stays put.
+	centroid, _ := PrincipalAxes(m.vertices)
+	if !closeTo(centroid[0], 1, 1e-4) || !closeTo(centroid[1], 2, 1e-4) || !closeTo(centroid[2], 3, 1e-4) {
+		t.Errorf("centroid moved to %v, want 1,2,3", centroid)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Convert a colour channel in [0.0 - 1.0] to a PLY uchar.
+func plyColor(c float32) uint8 {
+	return uint8(math.Round(float64(min(max(c, 0), 1)) * 255))
+}
+
+// Write the mesh as a PLY file, ASCII or binary in the -le/-be byte order. PLY normals are
+// per-vertex, so each distinct vertex and normal pair becomes one PLY vertex, and quads are
+// split into triangles along the same diagonal as ConvertQuadToTriangles.
+func (m *Mesh) WritePLY(outputFile io.Writer, binaryFormat bool) error {
+	writer := bufio.NewWriter(outputFile)
+	byteOrder := OutputByteOrder()
+	hasNormals := len(m.normals) > 0
+	hasColor := m.vertexType&VERTEX_COLOR != 0
+
+	type corner struct {
+		v, n uint32
+	}
+	index := make(map[corner]uint32)
+	var corners []corner
+	var triangles [][3]uint32
+	for i := range m.faces {
+		f := &m.faces[i]
+		ids := make([]uint32, f.edges)
+		for j := 0; j < int(f.edges); j++ {
+			c := corner{f.v[j], 0}
+			if hasNormals && len(f.n) > 0 {
+				c.n = f.n[j]
+			}
+			idx, ok := index[c]
+			if !ok {
+				idx = uint32(len(corners))
+				index[c] = idx
+				corners = append(corners, c)
+			}
+			ids[j] = idx
+		}
+		var first int = 0
+		if f.edges == 4 && !m.quadDiagonalValid(f, 0) && m.quadDiagonalValid(f, 1) {
+			first = 1
+		}
+		for j := 1; j+1 < int(f.edges); j++ {
+			triangles = append(triangles, [3]uint32{ids[first], ids[(first+j)%int(f.edges)], ids[(first+j+1)%int(f.edges)]})
+		}
+	}
+	// Point elements become PLY vertices with no face, line elements have no PLY equivalent.
+	for i := range m.points {
+		c := corner{m.points[i].v, 0}
+		if _, ok := index[c]; !ok {
+			index[c] = uint32(len(corners))
+			corners = append(corners, c)
+		}
+	}
+	if len(m.polylines) > 0 {
+		Logf(LOG_WARN, "Warning: PLY output does not support line elements, skipping %d lines.\n", len(m.polylines))
+	}
+
+	format := "ascii"
+	if binaryFormat {
+		format = "binary_little_endian"
+		if byteOrder == binary.BigEndian {
+			format = "binary_big_endian"
+		}
+	}
+	fmt.Fprintf(writer, "ply\nformat %s 1.0\n", format)
+	fmt.Fprintf(writer, "element vertex %d\n", len(corners))
+	fmt.Fprintf(writer, "property float x\nproperty float y\nproperty float z\n")
+	if hasNormals {
+		fmt.Fprintf(writer, "property float nx\nproperty float ny\nproperty float nz\n")
+	}
+	if hasColor {
+		fmt.Fprintf(writer, "property uchar red\nproperty uchar green\nproperty uchar blue\nproperty uchar alpha\n")
+	}
+	fmt.Fprintf(writer, "element face %d\n", len(triangles))
+	fmt.Fprintf(writer, "property list uchar uint vertex_indices\nend_header\n")
+
+	for _, c := range corners {
+		v := m.vertices[c.v]
+		if binaryFormat {
+			binary.Write(writer, byteOrder, [3]float32{v.X, v.Y, v.Z})
+			if hasNormals {
+				binary.Write(writer, byteOrder, [3]float32{m.normals[c.n].X, m.normals[c.n].Y, m.normals[c.n].Z})
+			}
+			if hasColor {
+				binary.Write(writer, byteOrder, [4]uint8{plyColor(v.R), plyColor(v.G), plyColor(v.B), plyColor(v.A)})
+			}
+			continue
+		}
+		fmt.Fprintf(writer, "%g %g %g", v.X, v.Y, v.Z)
+		if hasNormals {
+			fmt.Fprintf(writer, " %g %g %g", m.normals[c.n].X, m.normals[c.n].Y, m.normals[c.n].Z)
+		}
+		if hasColor {
+			fmt.Fprintf(writer, " %d %d %d %d", plyColor(v.R), plyColor(v.G), plyColor(v.B), plyColor(v.A))
+		}
+		fmt.Fprintln(writer)
+	}
+	for _, t := range triangles {
+		if binaryFormat {
+			binary.Write(writer, byteOrder, uint8(3))
+			binary.Write(writer, byteOrder, t)
+			continue
+		}
+		fmt.Fprintf(writer, "3 %d %d %d\n", t[0], t[1], t[2])
+	}
+
+	if err := writer.Flush(); err != nil {
+		Logf(LOG_ERROR, "Error flushing writer: %v\n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Minimum time between progress line updates
+const PROGRESS_INTERVAL = 250 * time.Millisecond
+
+// Start a new phase of the conversion, the status line is always refreshed.
+func (m *Mesh) ProgressPhase(phase string) {
+	if !*progressPtr || logLevel < LOG_INFO {
+		return
+	}
+	if m.progressStart.IsZero() {
+		m.progressStart = time.Now()
+	}
+	m.progressPhase = phase
+	m.printProgress()
+}
+
+// Refresh the status line if enough time has passed since the last update.
+func (m *Mesh) ProgressUpdate() {
+	if !*progressPtr || logLevel < LOG_INFO || time.Since(m.progressLast) < PROGRESS_INTERVAL {
+		return
+	}
+	m.printProgress()
+}
+
+// Finish the status line so following output starts on a new line.
+func (m *Mesh) ProgressDone() {
+	if !*progressPtr || logLevel < LOG_INFO {
+		return
+	}
+	m.progressPhase = "done"
+	m.printProgress()
+	fmt.Fprintln(logOutput)
+}
+
+func (m *Mesh) printProgress() {
+	m.progressLast = time.Now()
+	fmt.Fprintf(logOutput, "\r%-12s vertices=%d normals=%d uvs=%d faces=%d elapsed=%.1fs   ", m.progressPhase, len(m.vertices), len(m.normals), len(m.textureCoords), len(m.faces), time.Since(m.progressStart).Seconds())
+}
@@ -0,0 +1,169 @@
+package main
+
+import "errors"
+
+// A corner of a face which was changed from the split vertex to the source vertex
+// when the edge was collapsed.
+type SplitCorner struct {
+	face   uint32
+	corner uint8
+}
+
+// The inverse of a half-edge collapse, applying the records in order refines
+// the base mesh back to the original mesh.
+type VertexSplit struct {
+	source   uint32
+	vertex   uint32
+	corners  []SplitCorner
+	newFaces []Face
+}
+
+type collapseRecord struct {
+	source  uint32
+	vertex  uint32
+	corners [][2]uint32
+	removed []Face
+	faceIDs []uint32
+}
+
+func copyFace(f Face) Face {
+	f.v = append([]uint32(nil), f.v...)
+	f.n = append([]uint32(nil), f.n...)
+	f.t = append([]uint32(nil), f.t...)
+	f.uv = append([]uint32(nil), f.uv...)
+	return f
+}
+
+// Decimate the mesh to at most targetFaces faces with the same quadric error collapses as
+// -decimate, keeping its boundaries and never folding a face over, then reorder the vertices
+// and faces so that the base mesh comes first and each vertex split appends one vertex and its
+// faces to the end.
+func (m *Mesh) BuildProgressiveMesh(targetFaces int) error {
+	for i := range m.faces {
+		if m.faces[i].edges != 3 {
+			Logf(LOG_ERROR, "Error: Progressive mesh output requires a triangle mesh, use -q 3 to convert quads.\n")
+			return errors.New("progressive mesh requires triangles")
+		}
+	}
+
+	original := make([]Face, len(m.faces))
+	for i := range m.faces {
+		original[i] = copyFace(m.faces[i])
+	}
+
+	// The kept vertex keeps its position, so splitting the removed one back out restores the
+	// original exactly.
+	var records []collapseRecord
+	_, err := m.collapseEdges(targetFaces, func(keep, remove uint32, corners [][2]uint32, removed []uint32) {
+		rec := collapseRecord{source: keep, vertex: remove, corners: corners, faceIDs: removed}
+		for _, fi := range removed {
+			rec.removed = append(rec.removed, copyFace(m.faces[fi]))
+		}
+		records = append(records, rec)
+	})
+	if err != nil {
+		return err
+	}
+	alive := make([]bool, len(original))
+	for i := range alive {
+		alive[i] = true
+	}
+	vertexRemoved := make([]bool, len(m.vertices))
+	for _, rec := range records {
+		vertexRemoved[rec.vertex] = true
+		for _, fi := range rec.faceIDs {
+			alive[fi] = false
+		}
+	}
+
+	// Base vertices first, then the removed vertices in the order they are split back in.
+	vertexRemap := make([]uint32, len(m.vertices))
+	var newVertices []Vertex
+	for i := range m.vertices {
+		if !vertexRemoved[i] {
+			vertexRemap[i] = uint32(len(newVertices))
+			newVertices = append(newVertices, m.vertices[i])
+		}
+	}
+	m.baseVertexCount = uint32(len(newVertices))
+	for i := len(records) - 1; i >= 0; i-- {
+		vertexRemap[records[i].vertex] = uint32(len(newVertices))
+		newVertices = append(newVertices, m.vertices[records[i].vertex])
+	}
+
+	// Base faces first, then the faces restored by each split in order. collapseEdges kept the
+	// base faces in their original order.
+	faceRemap := make([]uint32, len(original))
+	newFaces := m.faces
+	var base uint32 = 0
+	for i := range original {
+		if alive[i] {
+			faceRemap[i] = base
+			base++
+		}
+	}
+	var restored uint32 = uint32(len(newFaces))
+	for i := len(records) - 1; i >= 0; i-- {
+		for _, fi := range records[i].faceIDs {
+			faceRemap[fi] = restored
+			restored++
+		}
+	}
+	for i := range newFaces {
+		for j := 0; j < 3; j++ {
+			newFaces[i].v[j] = vertexRemap[newFaces[i].v[j]]
+		}
+	}
+
+	m.vertexSplits = nil
+	for i := len(records) - 1; i >= 0; i-- {
+		var split VertexSplit
+		split.source = vertexRemap[records[i].source]
+		split.vertex = vertexRemap[records[i].vertex]
+		for _, c := range records[i].corners {
+			split.corners = append(split.corners, SplitCorner{faceRemap[c[0]], uint8(c[1])})
+		}
+		for _, f := range records[i].removed {
+			for j := 0; j < 3; j++ {
+				f.v[j] = vertexRemap[f.v[j]]
+			}
+			split.newFaces = append(split.newFaces, f)
+		}
+		m.vertexSplits = append(m.vertexSplits, split)
+	}
+
+	// Sanity check that refining the base mesh gives back the original faces.
+	refined := ApplyVertexSplits(newFaces, m.vertexSplits)
+	for i := range original {
+		for j := 0; j < 3; j++ {
+			if refined[faceRemap[i]].v[j] != vertexRemap[original[i].v[j]] {
+				Logf(LOG_ERROR, "Error: Vertex splits do not reconstruct face %d.\n", i)
+				return errors.New("progressive mesh reconstruction failed")
+			}
+		}
+	}
+
+	Logf(LOG_INFO, "Progressive mesh: base %d faces / %d vertices, %d vertex splits.\n", len(newFaces), m.baseVertexCount, len(m.vertexSplits))
+	m.RemapElements(func(v uint32) uint32 { return vertexRemap[v] }, nil)
+	m.vertices = newVertices
+	m.faces = newFaces
+	m.vertexType |= VERTEX_SPLITS
+	return nil
+}
+
+// Apply the vertex splits to the base mesh, returning the refined face list.
+func ApplyVertexSplits(base []Face, splits []VertexSplit) []Face {
+	var result []Face
+	for i := range base {
+		result = append(result, copyFace(base[i]))
+	}
+	for _, split := range splits {
+		for _, c := range split.corners {
+			result[c.face].v[c.corner] = split.vertex
+		}
+		for _, f := range split.newFaces {
+			result = append(result, copyFace(f))
+		}
+	}
+	return result
+}
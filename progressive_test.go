@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// An OBJ of a flat n by n grid of quads split into triangles, with a little height so the
+// edges are not all the same length.
+func gridOBJ(n int) string {
+	var b strings.Builder
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			fmt.Fprintf(&b, "v %d %d %g\n", x, y, float64((x*7+y*3)%5)*0.1)
+		}
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			a := y*(n+1) + x + 1
+			fmt.Fprintf(&b, "f %d %d %d\n", a, a+1, a+n+2)
+			fmt.Fprintf(&b, "f %d %d %d\n", a, a+n+2, a+n+1)
+		}
+	}
+	return b.String()
+}
+
+// The triangles as the positions of their corners, each rotated to start at its smallest
+// corner so the same triangle compares equal whichever corner it was listed from.
+func trianglePositions(vertices []Vertex, faces []Face) []string {
+	var result []string
+	for _, f := range faces {
+		var t [3][3]float32
+		for j := 0; j < 3; j++ {
+			v := vertices[f.v[j]]
+			t[j] = [3]float32{v.X, v.Y, v.Z}
+		}
+		first := 0
+		for j := 1; j < 3; j++ {
+			if slices.Compare(t[j][:], t[first][:]) < 0 {
+				first = j
+			}
+		}
+		result = append(result, fmt.Sprint(t[first], t[(first+1)%3], t[(first+2)%3]))
+	}
+	slices.Sort(result)
+	return result
+}
+
+func TestProgressiveMeshReconstructsOriginal(t *testing.T) {
+	obj := gridOBJ(6)
+	original := convertOBJ(t, obj)
+	file := convertOBJ(t, obj, "-progressive", "0.25")
+
+	if file.header.vertexType&VERTEX_SPLITS == 0 {
+		t.Fatalf("vertexType 0x%08x does not have the vertex splits bit set", file.header.vertexType)
+	}
+	if len(file.faces) >= len(original.faces) || len(file.vertexSplits) == 0 {
+		t.Fatalf("base mesh has %d of %d faces and %d splits, want fewer faces and some splits", len(file.faces), len(original.faces), len(file.vertexSplits))
+	}
+	if file.baseVertexCount+uint32(len(file.vertexSplits)) != uint32(len(file.vertices)) {
+		t.Errorf("base vertex count %d plus %d splits does not add up to %d vertices", file.baseVertexCount, len(file.vertexSplits), len(file.vertices))
+	}
+	for _, f := range file.faces {
+		for _, v := range f.v {
+			if v >= file.baseVertexCount {
+				t.Fatalf("base face uses vertex %d beyond the %d base vertices", v, file.baseVertexCount)
+			}
+		}
+	}
+
+	refined := ApplyVertexSplits(file.faces, file.vertexSplits)
+	got := trianglePositions(file.vertices, refined)
+	want := trianglePositions(original.vertices, original.faces)
+	if !slices.Equal(got, want) {
+		t.Errorf("refined mesh has triangles\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestNoVertexSplitsWithoutProgressive(t *testing.T) {
+	file := convertOBJ(t, gridOBJ(2))
+	if file.header.vertexType&VERTEX_SPLITS != 0 || file.vertexSplits != nil {
+		t.Errorf("vertexType 0x%08x with %d splits, want no vertex splits", file.header.vertexType, len(file.vertexSplits))
+	}
+}
+
+func TestProgressiveBaseMeshKeepsBoundaryAndWinding(t *testing.T) {
+	const n = 6
+	file := convertOBJ(t, gridOBJ(n), "-progressive", "0.1")
+
+	// Every vertex on the edge of the grid stays in the base mesh.
+	for i, v := range file.vertices {
+		onBoundary := v.X == 0 || v.X == n || v.Y == 0 || v.Y == n
+		if onBoundary && uint32(i) >= file.baseVertexCount {
+			t.Errorf("boundary vertex %v is only added by a vertex split", v)
+		}
+	}
+	// The grid faces +z, so does every base face.
+	for i, f := range file.faces {
+		a, b, c := file.vertices[f.v[0]], file.vertices[f.v[1]], file.vertices[f.v[2]]
+		if z := (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X); z <= 0 {
+			t.Errorf("base face %d uses %v, which has been folded over", i, f.v)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Cross product of two 2D vectors (returns only the z-component)
+func crossProductZ(ax, ay, bx, by float64) float64 {
+	return ax*by - ay*bx
+}
+
+// Check if 4 points form a convex quadrilateral
+func isConvex(ax, ay, bx, by, cx, cy, dx, dy float64) bool {
+	// Compute edge vectors
+	v1x, v1y := bx-ax, by-ay
+	v2x, v2y := cx-bx, cy-by
+	v3x, v3y := dx-cx, dy-cy
+	v4x, v4y := ax-dx, ay-dy
+
+	// Compute cross products (only the z-component)
+	c1 := crossProductZ(v1x, v1y, v2x, v2y)
+	c2 := crossProductZ(v2x, v2y, v3x, v3y)
+	c3 := crossProductZ(v3x, v3y, v4x, v4y)
+	c4 := crossProductZ(v4x, v4y, v1x, v1y)
+
+	// All cross products must have the same sign
+	return (c1 > 0 && c2 > 0 && c3 > 0 && c4 > 0) || (c1 < 0 && c2 < 0 && c3 < 0 && c4 < 0)
+}
+
+// Dot product of the unit normals of the two halves of a quad split along the 0-2 diagonal,
+// 1 for a planar quad. A half with no area has no normal, so the quad counts as bent with 0.
+func (m *Mesh) quadHalvesDot(f *Face) float64 {
+	var abx float64 = float64(m.vertices[f.v[1]].X - m.vertices[f.v[0]].X)
+	var aby float64 = float64(m.vertices[f.v[1]].Y - m.vertices[f.v[0]].Y)
+	var abz float64 = float64(m.vertices[f.v[1]].Z - m.vertices[f.v[0]].Z)
+	var acx float64 = float64(m.vertices[f.v[2]].X - m.vertices[f.v[0]].X)
+	var acy float64 = float64(m.vertices[f.v[2]].Y - m.vertices[f.v[0]].Y)
+	var acz float64 = float64(m.vertices[f.v[2]].Z - m.vertices[f.v[0]].Z)
+	var adx float64 = float64(m.vertices[f.v[3]].X - m.vertices[f.v[0]].X)
+	var ady float64 = float64(m.vertices[f.v[3]].Y - m.vertices[f.v[0]].Y)
+	var adz float64 = float64(m.vertices[f.v[3]].Z - m.vertices[f.v[0]].Z)
+
+	// Compute cross product AB × AC and AC × AD
+	nx1, ny1, nz1 := crossProduct(abx, aby, abz, acx, acy, acz)
+	nx2, ny2, nz2 := crossProduct(acx, acy, acz, adx, ady, adz)
+	len1 := math.Sqrt(nx1*nx1 + ny1*ny1 + nz1*nz1)
+	len2 := math.Sqrt(nx2*nx2 + ny2*ny2 + nz2*nz2)
+	if len1 == 0 || len2 == 0 {
+		return 0
+	}
+	nx1 /= len1
+	ny1 /= len1
+	nz1 /= len1
+	nx2 /= len2
+	ny2 /= len2
+	nz2 /= len2
+
+	// Compute dot product (AB × AC) • (AC x AD)
+	return dotProduct(nx1, ny1, nz1, nx2, ny2, nz2)
+}
+
+// Check a quad is planar within -planartol.
+func (m *Mesh) quadPlanar(f *Face) bool {
+	return math.Abs(m.quadHalvesDot(f)) >= *planarTolPtr
+}
+
+func (m *Mesh) ValidateQuad(f *Face) error {
+	dot := m.quadHalvesDot(f)
+
+	if math.Abs(dot) < *planarTolPtr {
+		Logf(LOG_VERBOSE, "Quad face is not planar: %v\n", dot)
+		Logf(LOG_VERBOSE, "%f %f %f %f %f %f %f %f %f %f %f %f\n", m.vertices[f.v[0]].X, m.vertices[f.v[0]].Y, m.vertices[f.v[0]].Z,
+			m.vertices[f.v[1]].X, m.vertices[f.v[1]].Y, m.vertices[f.v[1]].Z,
+			m.vertices[f.v[2]].X, m.vertices[f.v[2]].Y, m.vertices[f.v[2]].Z,
+			m.vertices[f.v[3]].X, m.vertices[f.v[3]].Y, m.vertices[f.v[3]].Z)
+		deviation := math.Acos(math.Min(math.Abs(dot), 1)) * 180 / math.Pi
+		return fmt.Errorf("quad face is not planar, its halves differ by %.3f degrees (dot %.6f, -planartol %.6f)", deviation, math.Abs(dot), *planarTolPtr)
+	}
+
+	if !*noConvexPtr && !isConvex(float64(m.vertices[f.v[0]].X), float64(m.vertices[f.v[0]].Y),
+		float64(m.vertices[f.v[1]].X), float64(m.vertices[f.v[1]].Y),
+		float64(m.vertices[f.v[2]].X), float64(m.vertices[f.v[2]].Y),
+		float64(m.vertices[f.v[3]].X), float64(m.vertices[f.v[3]].Y)) {
+		Logf(LOG_VERBOSE, "Quad face is not convex: %v\n", f)
+		return errors.New("quad face is not convex")
+	}
+
+	return nil
+}
+
+func RemoveAtIndex[T any](s []T, index int) []T {
+	return slices.Delete(s, index, index+1) // Remove element at index
+}
+
+// Check splitting a quad along the diagonal from corner first gives two triangles with area
+// which both face the same way as the quad as a whole.
+func (m *Mesh) quadDiagonalValid(f *Face, first int) bool {
+	// Newell's method gives the quad normal even when the quad is concave.
+	var qx, qy, qz float64 = 0, 0, 0
+	for j := 0; j < 4; j++ {
+		a, b := m.vertices[f.v[j]], m.vertices[f.v[(j+1)%4]]
+		qx += float64((a.Y - b.Y) * (a.Z + b.Z))
+		qy += float64((a.Z - b.Z) * (a.X + b.X))
+		qz += float64((a.X - b.X) * (a.Y + b.Y))
+	}
+	for _, tri := range [2][3]int{{0, 1, 2}, {0, 2, 3}} {
+		a := m.vertices[f.v[(first+tri[0])%4]]
+		b := m.vertices[f.v[(first+tri[1])%4]]
+		c := m.vertices[f.v[(first+tri[2])%4]]
+		nx, ny, nz := crossProduct(float64(b.X-a.X), float64(b.Y-a.Y), float64(b.Z-a.Z), float64(c.X-a.X), float64(c.Y-a.Y), float64(c.Z-a.Z))
+		if nx == 0 && ny == 0 && nz == 0 {
+			return false
+		}
+		if dotProduct(nx, ny, nz, qx, qy, qz) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Rotate a corner list left by one, so corner 1 becomes corner 0.
+func rotateCorners(s []uint32) {
+	if len(s) == 4 {
+		s[0], s[1], s[2], s[3] = s[1], s[2], s[3], s[0]
+	}
+}
+
+func (m *Mesh) ConvertQuadToTriangles(f *Face) {
+	// Split along 0-2 unless that diagonal lies outside a concave quad, then use 1-3.
+	if !m.quadDiagonalValid(f, 0) && m.quadDiagonalValid(f, 1) {
+		rotateCorners(f.v)
+		rotateCorners(f.n)
+		rotateCorners(f.uv)
+		rotateCorners(f.t)
+	}
+	f.edges = 3
+	//0,1,2 - 0,2,3
+	var newFace Face
+	newFace.edges = 3
+	newFace.materialID = f.materialID
+	newFace.materialName = f.materialName
+	newFace.objectName = f.objectName
+	newFace.line = f.line
+	newFace.v = make([]uint32, 3)
+	newFace.v[0] = f.v[0]
+	newFace.v[1] = f.v[2]
+	newFace.v[2] = f.v[3]
+	if len(f.n) == 4 {
+		newFace.n = make([]uint32, 3)
+		newFace.n[0] = f.n[0]
+		newFace.n[1] = f.n[2]
+		newFace.n[2] = f.n[3]
+	}
+	if len(f.uv) == 4 {
+		newFace.uv = make([]uint32, 3)
+		newFace.uv[0] = f.uv[0]
+		newFace.uv[1] = f.uv[2]
+		newFace.uv[2] = f.uv[3]
+	}
+	if len(f.t) == 4 {
+		newFace.t = make([]uint32, 3)
+		newFace.t[0] = f.t[0]
+		newFace.t[1] = f.t[2]
+		newFace.t[2] = f.t[3]
+	}
+	f.v = RemoveAtIndex(f.v, 3)
+	if len(f.n) == 4 {
+		f.n = RemoveAtIndex(f.n, 3)
+	}
+	if len(f.uv) == 4 {
+		f.uv = RemoveAtIndex(f.uv, 3)
+	}
+	if len(f.t) == 4 {
+		f.t = RemoveAtIndex(f.t, 3)
+	}
+	// f points into faces, so it must be finished with before the append can move the array.
+	m.faces = append(m.faces, newFace)
+}
+
+func FakeQuadCheck(f *Face) {
+	// Check for a quad face that is actually a triangle.
+	var vertexUse map[uint32]int = make(map[uint32]int)
+	vertexUse[f.v[0]]++
+	vertexUse[f.v[1]]++
+	vertexUse[f.v[2]]++
+	vertexUse[f.v[3]]++
+	if len(vertexUse) == 3 {
+		Logf(LOG_WARN, "Fake Quad - Triangle face found: %v\n", f)
+	}
+}
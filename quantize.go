@@ -0,0 +1,35 @@
+package main
+
+import "math"
+
+// Switch the output to 16-bit positions normalized over the bounding box of the vertices.
+// The vertices keep their float positions and are quantized as they are written.
+func (m *Mesh) QuantizePositions() {
+	if len(m.vertices) == 0 {
+		return
+	}
+	lo := [3]float32{m.vertices[0].X, m.vertices[0].Y, m.vertices[0].Z}
+	hi := lo
+	for i := range m.vertices {
+		p := [3]float32{m.vertices[i].X, m.vertices[i].Y, m.vertices[i].Z}
+		for a := 0; a < 3; a++ {
+			lo[a] = min(lo[a], p[a])
+			hi[a] = max(hi[a], p[a])
+		}
+	}
+	for a := 0; a < 3; a++ {
+		m.positionBias[a] = lo[a]
+		m.positionScale[a] = (hi[a] - lo[a]) / math.MaxUint16
+	}
+	m.vertexType |= VERTEX_QUANTIZED
+	Logf(LOG_INFO, "Quantized positions to 16 bits, scale %v bias %v\n", m.positionScale, m.positionBias)
+}
+
+// Quantize one coordinate, a zero extent axis always stores 0.
+func (m *Mesh) quantizePosition(x float32, axis int) uint16 {
+	if m.positionScale[axis] == 0 {
+		return 0
+	}
+	q := math.Round(float64((x - m.positionBias[axis]) / m.positionScale[axis]))
+	return uint16(min(max(q, 0), math.MaxUint16))
+}
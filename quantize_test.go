@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestQuantizeErrorWithinOneStep(t *testing.T) {
+	var obj strings.Builder
+	points := randomPoints(300, 7)
+	for _, p := range points {
+		fmt.Fprintf(&obj, "v %g %g %g\n", p.X*10-3, p.Y*0.01, p.Z*1000)
+	}
+	for i := 1; i+2 <= len(points); i += 3 {
+		fmt.Fprintf(&obj, "f %d %d %d\n", i, i+1, i+2)
+	}
+	exact := convertOBJ(t, obj.String())
+	quantized := convertOBJ(t, obj.String(), "-quantize")
+	if quantized.header.vertexType&VERTEX_QUANTIZED == 0 {
+		t.Fatal("the output is not quantized")
+	}
+	if len(quantized.vertices) != len(exact.vertices) {
+		t.Fatalf("got %d quantized vertices, want %d", len(quantized.vertices), len(exact.vertices))
+	}
+
+	box := exact.header.box
+	extent := [3]float64{float64(box.max.X - box.min.X), float64(box.max.Y - box.min.Y), float64(box.max.Z - box.min.Z)}
+	for i, q := range quantized.vertices {
+		e := exact.vertices[i]
+		diff := [3]float64{math.Abs(float64(q.X - e.X)), math.Abs(float64(q.Y - e.Y)), math.Abs(float64(q.Z - e.Z))}
+		for a := range diff {
+			// One quantization step, with a little room for the float32 arithmetic.
+			if limit := extent[a] / math.MaxUint16 * 1.001; diff[a] > limit {
+				t.Errorf("vertex %d axis %d is off by %g, more than %g", i, a, diff[a], limit)
+			}
+		}
+	}
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+)
+
+// The newest MSHX version this tool writes and can read.
+const MSHX_VERSION uint32 = 15
+
+var ErrBadMagic = errors.New("not an MSHX file")
+var ErrUnsupportedVersion = errors.New("unsupported MSHX version")
+var ErrChecksum = errors.New("MSHX checksum does not match")
+
+type MSHXHeader struct {
+	version       uint32
+	byteOrder     binary.ByteOrder
+	vertexCount   uint32
+	normalCount   uint32
+	tangentCount  uint32
+	uvCount       uint32
+	faceCount     uint32
+	materialCount uint32
+	lineCount     uint32
+	pointCount    uint32
+	lodCount      uint32
+	vertexType    uint32
+	indexType     uint32
+	unit          uint32
+	sphere        BoundSphere
+	box           BoundBox
+	positionScale [3]float32
+	positionBias  [3]float32
+}
+
+// The contents of an MSHX file as read back by ReadMSHX.
+type MSHXFile struct {
+	header          MSHXHeader
+	vertices        []Vertex
+	normals         []Normal
+	tangents        []Tangent
+	textureCoords   []TextureCoord
+	faces           []Face
+	triangleStrips  []TriangleStrip
+	polylines       []Polyline
+	points          []Point
+	materials       []Material
+	materialRanges  []MaterialRange
+	lodRanges       []LODRange
+	baseVertexCount uint32
+	vertexSplits    []VertexSplit
+}
+
+// Source of MSHX data which knows how many bytes are left, so corrupt counts can be
+// caught before allocating for them.
+type mshxSource interface {
+	io.Reader
+	Len() int
+}
+
+// An mshxSource over a stream, the length is the file size when it is known.
+type streamSource struct {
+	r         *bufio.Reader
+	remaining int
+}
+
+func (s *streamSource) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.remaining -= n
+	return n, err
+}
+
+func (s *streamSource) Len() int {
+	return s.remaining
+}
+
+// Reads values in the file byte order, remembering the first error so the caller only
+// has to check once a whole section has been read.
+type mshxReader struct {
+	r         mshxSource
+	byteOrder binary.ByteOrder
+	err       error
+}
+
+func (m *mshxReader) read(data any) {
+	if m.err == nil {
+		m.err = binary.Read(m.r, m.byteOrder, data)
+	}
+}
+
+func (m *mshxReader) skip(n int64) {
+	if m.err == nil {
+		_, m.err = io.CopyN(io.Discard, m.r, n)
+		if m.err == io.EOF {
+			m.err = io.ErrUnexpectedEOF
+		}
+	}
+}
+
+func (m *mshxReader) uint32() uint32 {
+	var v uint32
+	m.read(&v)
+	return v
+}
+
+func (m *mshxReader) float32() float32 {
+	var v float32
+	m.read(&v)
+	return v
+}
+
+func (m *mshxReader) indices(count int) []uint32 {
+	if m.err != nil || count > m.r.Len()/4 {
+		if m.err == nil {
+			m.err = io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	v := make([]uint32, count)
+	m.read(v)
+	return v
+}
+
+func (m *mshxReader) string() string {
+	length := m.uint32()
+	if m.err != nil || int(length) > m.r.Len() {
+		if m.err == nil {
+			m.err = io.ErrUnexpectedEOF
+		}
+		return ""
+	}
+	b := make([]byte, length)
+	m.read(b)
+	return string(b)
+}
+
+// Read the header, the byte order is not stored so it is taken from whichever order gives
+// a small version number.
+func readMSHXHeader(data []byte) (MSHXHeader, error) {
+	var h MSHXHeader
+	if len(data) < 8 || string(data[:4]) != "MSHX" {
+		return h, ErrBadMagic
+	}
+	h.byteOrder = binary.LittleEndian
+	if binary.LittleEndian.Uint32(data[4:8]) > 0xFFFF {
+		h.byteOrder = binary.BigEndian
+	}
+	h.version = h.byteOrder.Uint32(data[4:8])
+	if h.version < 1 || h.version > MSHX_VERSION {
+		return h, fmt.Errorf("%w %d", ErrUnsupportedVersion, h.version)
+	}
+
+	m := &mshxReader{r: bytes.NewReader(data[8:]), byteOrder: h.byteOrder}
+	h.vertexCount = m.uint32()
+	h.normalCount = m.uint32()
+	h.tangentCount = m.uint32()
+	h.uvCount = m.uint32()
+	h.faceCount = m.uint32()
+	h.materialCount = m.uint32()
+	if h.version >= 7 {
+		h.lineCount = m.uint32()
+		h.pointCount = m.uint32()
+	}
+	if h.version >= 13 {
+		h.lodCount = m.uint32()
+	}
+	h.vertexType = m.uint32()
+	if h.version >= 3 {
+		h.indexType = m.uint32()
+	}
+	if h.version >= 4 {
+		h.unit = m.uint32()
+	}
+	h.sphere.center.X = m.float32()
+	h.sphere.center.Y = m.float32()
+	h.sphere.center.Z = m.float32()
+	h.sphere.radius = m.float32()
+	if h.version >= 2 {
+		h.box.min.X = m.float32()
+		h.box.min.Y = m.float32()
+		h.box.min.Z = m.float32()
+		h.box.max.X = m.float32()
+		h.box.max.Y = m.float32()
+		h.box.max.Z = m.float32()
+	}
+	if h.version >= 9 && h.vertexType&VERTEX_QUANTIZED != 0 {
+		m.read(&h.positionScale)
+		m.read(&h.positionBias)
+	}
+	if m.err != nil {
+		return h, fmt.Errorf("reading MSHX header: %w", m.err)
+	}
+	return h, nil
+}
+
+// Size of the header in bytes, which depends on the version and the vertex type.
+func mshxHeaderSize(h *MSHXHeader) int64 {
+	version := h.version
+	var size int64 = 4 + 4 + 6*4 + 4 + 4*4
+	if version >= 2 {
+		size += 6 * 4
+	}
+	if version >= 3 {
+		size += 4
+	}
+	if version >= 4 {
+		size += 4
+	}
+	if version >= 7 {
+		size += 2 * 4
+	}
+	if version >= 13 {
+		size += 4
+	}
+	if version >= 9 && h.vertexType&VERTEX_QUANTIZED != 0 {
+		size += 6 * 4
+	}
+	return size
+}
+
+func (m *mshxReader) face(h *MSHXHeader) Face {
+	var f Face
+	m.read(&f.edges)
+	f.v = m.indices(int(f.edges))
+	if h.indexType == 0 {
+		if h.normalCount > 0 {
+			f.n = m.indices(int(f.edges))
+		}
+		if h.tangentCount > 0 {
+			f.t = m.indices(int(f.edges))
+		}
+		if h.uvCount > 0 {
+			f.uv = m.indices(int(f.edges))
+		}
+	}
+	f.materialID = m.uint32()
+	return f
+}
+
+func (m *mshxReader) textureCoord(h *MSHXHeader, t *TextureCoord) {
+	t.U, t.V = m.float32(), m.float32()
+	if h.vertexType&UV_W != 0 && h.version >= 15 {
+		t.W = m.float32()
+	}
+}
+
+func (m *mshxReader) material(h *MSHXHeader) Material {
+	var mat Material
+	m.read(&mat.diffuse)
+	m.read(&mat.specular)
+	m.read(&mat.ambient)
+	m.read(&mat.transmissive)
+	m.read(&mat.emissive)
+	mat.power = m.float32()
+	mat.transparency = m.float32()
+	mat.refractivity = m.float32()
+	mat.illum = m.uint32()
+	mat.roughness = m.float32()
+	mat.metallic = m.float32()
+	mat.sheen = m.float32()
+	mat.clearcoat_thickness = m.float32()
+	mat.clearcoat_roughness = m.float32()
+	mat.aniso = m.float32()
+	mat.aniso_rotation = m.float32()
+	mat.texture = m.string()
+	if h.version >= 12 {
+		mat.name = m.string()
+	}
+	return mat
+}
+
+// Size in bytes of one vertex in the vertex section.
+func mshxVertexSize(h *MSHXHeader) int64 {
+	var size int64 = 3 * 4
+	if h.vertexType&VERTEX_QUANTIZED != 0 && h.version >= 9 {
+		size = 3 * 2
+	}
+	if h.vertexType&VERTEX_W != 0 && h.version >= 14 {
+		size += 4
+	}
+	if h.vertexType&VERTEX_COLOR != 0 {
+		size += 4 * 4
+	}
+	if h.vertexType&VERTEX_VELOCITY != 0 {
+		size += 3 * 4
+	}
+	if h.indexType == INDEX_INTERLEAVED {
+		if h.normalCount > 0 {
+			size += 3 * 4
+		}
+		if h.uvCount > 0 {
+			size += 2 * 4
+			if h.vertexType&UV_W != 0 && h.version >= 15 {
+				size += 4
+			}
+		}
+	}
+	return size
+}
+
+// Read the header and material table of an MSHX file, stepping over the vertex, face and
+// element data rather than loading it. Nothing after the materials is read, so the checksum
+// is not verified.
+func ReadMSHXSummary(r io.Reader) (*MSHXFile, error) {
+	source := &streamSource{r: bufio.NewReader(r), remaining: math.MaxInt32}
+	if magic, err := source.r.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// The uncompressed size is not known up front.
+		gzipReader, err := gzip.NewReader(source.r)
+		if err != nil {
+			return nil, fmt.Errorf("reading MSHX: %w", err)
+		}
+		source.r = bufio.NewReader(gzipReader)
+	} else if f, ok := r.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			source.remaining = int(info.Size())
+		}
+	}
+	data, _ := source.r.Peek(int(mshxHeaderSize(&MSHXHeader{version: MSHX_VERSION, vertexType: VERTEX_QUANTIZED})))
+	header, err := readMSHXHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &MSHXFile{header: header}
+	h := &file.header
+	m := &mshxReader{r: source, byteOrder: h.byteOrder}
+	m.skip(mshxHeaderSize(h))
+	m.skip(int64(h.vertexCount)*mshxVertexSize(h) + int64(h.tangentCount)*6*4)
+	if h.indexType != INDEX_INTERLEAVED {
+		var uvSize int64 = 2 * 4
+		if h.vertexType&UV_W != 0 && h.version >= 15 {
+			uvSize += 4
+		}
+		m.skip(int64(h.normalCount)*3*4 + int64(h.uvCount)*uvSize)
+	}
+	var streams int64 = 1
+	if h.indexType == 0 {
+		for _, count := range []uint32{h.normalCount, h.tangentCount, h.uvCount} {
+			if count > 0 {
+				streams++
+			}
+		}
+	}
+	for i := uint32(0); i < h.faceCount && m.err == nil; i++ {
+		if h.vertexType&TRIANGLE_STRIPS != 0 && h.version >= 11 {
+			m.skip(int64(m.uint32())*4 + 4)
+			continue
+		}
+		var edges uint8
+		m.read(&edges)
+		m.skip(int64(edges)*streams*4 + 4)
+	}
+	for i := uint32(0); i < h.lineCount && m.err == nil; i++ {
+		count := int64(m.uint32())
+		var hasUV uint8
+		m.read(&hasUV)
+		m.skip(count * 4 * (1 + int64(hasUV)))
+	}
+	m.skip(int64(h.pointCount) * 4)
+	for i := uint32(0); i < h.materialCount && m.err == nil; i++ {
+		file.materials = append(file.materials, m.material(h))
+	}
+	if m.err != nil {
+		return nil, fmt.Errorf("reading MSHX: %w", m.err)
+	}
+	return file, nil
+}
+
+// Read an MSHX file of any version up to MSHX_VERSION, checking the checksum when it has one.
+func ReadMSHX(r io.Reader) (*MSHXFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// Files written with -gzout are decompressed transparently.
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("reading MSHX: %w", err)
+		}
+		data, err = io.ReadAll(gzipReader)
+		if err != nil {
+			return nil, fmt.Errorf("reading MSHX: %w", err)
+		}
+	}
+	header, err := readMSHXHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.vertexType&FILE_CHECKSUM != 0 {
+		if len(data) < 4 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if crc32.ChecksumIEEE(data[:len(data)-4]) != header.byteOrder.Uint32(data[len(data)-4:]) {
+			return nil, ErrChecksum
+		}
+		data = data[:len(data)-4]
+	}
+
+	file := &MSHXFile{header: header}
+	body := bytes.NewReader(data)
+	body.Seek(mshxHeaderSize(&header), io.SeekStart)
+	m := &mshxReader{r: body, byteOrder: header.byteOrder}
+	h := &file.header
+
+	// Guard the allocations against counts larger than the file could hold.
+	if int64(h.vertexCount)+int64(h.normalCount)+int64(h.uvCount)+int64(h.faceCount) > int64(len(data)) {
+		return nil, fmt.Errorf("reading MSHX: %w", io.ErrUnexpectedEOF)
+	}
+
+	if h.indexType == INDEX_INTERLEAVED && (h.version < 10 || (h.normalCount != 0 && h.normalCount != h.vertexCount) || (h.uvCount != 0 && h.uvCount != h.vertexCount)) {
+		return nil, fmt.Errorf("reading MSHX: interleaved vertices with %d normals and %d texture coords for %d vertices", h.normalCount, h.uvCount, h.vertexCount)
+	}
+	file.vertices = make([]Vertex, h.vertexCount)
+	file.normals = make([]Normal, h.normalCount)
+	file.textureCoords = make([]TextureCoord, h.uvCount)
+	for i := range file.vertices {
+		v := &file.vertices[i]
+		if h.vertexType&VERTEX_QUANTIZED != 0 && h.version >= 9 {
+			var q [3]uint16
+			m.read(&q)
+			v.X = h.positionBias[0] + float32(q[0])*h.positionScale[0]
+			v.Y = h.positionBias[1] + float32(q[1])*h.positionScale[1]
+			v.Z = h.positionBias[2] + float32(q[2])*h.positionScale[2]
+			v.W = 1.0
+		} else {
+			v.X, v.Y, v.Z, v.W = m.float32(), m.float32(), m.float32(), 1.0
+		}
+		if h.vertexType&VERTEX_W != 0 && h.version >= 14 {
+			v.W = m.float32()
+		}
+		v.A, v.R, v.G, v.B = 1.0, 1.0, 1.0, 1.0
+		if h.vertexType&VERTEX_COLOR != 0 {
+			if h.version >= 6 {
+				v.R, v.G, v.B, v.A = m.float32(), m.float32(), m.float32(), m.float32()
+			} else {
+				v.A, v.R, v.G, v.B = m.float32(), m.float32(), m.float32(), m.float32()
+			}
+		}
+		if h.vertexType&VERTEX_VELOCITY != 0 {
+			m.read(&v.velocity)
+		}
+		// Interleaved vertex records carry their normal and texture coord [version 10+]
+		if h.indexType == INDEX_INTERLEAVED {
+			if h.normalCount > 0 {
+				n := &file.normals[i]
+				n.X, n.Y, n.Z = m.float32(), m.float32(), m.float32()
+			}
+			if h.uvCount > 0 {
+				m.textureCoord(h, &file.textureCoords[i])
+			}
+		}
+	}
+	if h.indexType != INDEX_INTERLEAVED {
+		for i := range file.normals {
+			file.normals[i].X, file.normals[i].Y, file.normals[i].Z = m.float32(), m.float32(), m.float32()
+		}
+	}
+	if int64(h.tangentCount)*6*4 > int64(m.r.Len()) {
+		return nil, fmt.Errorf("reading MSHX: %w", io.ErrUnexpectedEOF)
+	}
+	file.tangents = make([]Tangent, h.tangentCount)
+	for i := range file.tangents {
+		t := &file.tangents[i]
+		t.tan.X, t.tan.Y, t.tan.Z = m.float32(), m.float32(), m.float32()
+		t.bitan.X, t.bitan.Y, t.bitan.Z = m.float32(), m.float32(), m.float32()
+	}
+	if h.indexType != INDEX_INTERLEAVED {
+		for i := range file.textureCoords {
+			m.textureCoord(h, &file.textureCoords[i])
+		}
+	}
+	// With triangle strips the face records are strip records [version 11+]
+	if h.vertexType&TRIANGLE_STRIPS != 0 && h.version >= 11 {
+		file.triangleStrips = make([]TriangleStrip, h.faceCount)
+		for i := range file.triangleStrips {
+			file.triangleStrips[i].v = m.indices(int(m.uint32()))
+			file.triangleStrips[i].materialID = m.uint32()
+		}
+	} else {
+		file.faces = make([]Face, h.faceCount)
+		for i := range file.faces {
+			file.faces[i] = m.face(h)
+		}
+	}
+	for i := uint32(0); i < h.lineCount && m.err == nil; i++ {
+		var l Polyline
+		count := m.uint32()
+		var hasUV uint8
+		m.read(&hasUV)
+		l.v = m.indices(int(count))
+		if hasUV != 0 {
+			l.uv = m.indices(int(count))
+		}
+		file.polylines = append(file.polylines, l)
+	}
+	for i := uint32(0); i < h.pointCount && m.err == nil; i++ {
+		file.points = append(file.points, Point{v: m.uint32()})
+	}
+	for i := uint32(0); i < h.materialCount && m.err == nil; i++ {
+		file.materials = append(file.materials, m.material(h))
+	}
+
+	// Optional tagged sections follow the materials, material ranges [version 8+], levels of
+	// detail [version 13+] then the vertex splits of a progressive mesh, flagged in vertexType.
+	for m.err == nil && m.r.Len() >= 4 {
+		var tag [4]byte
+		m.read(&tag)
+		switch {
+		case string(tag[:]) == "MGRP" && h.version >= 8:
+			rangeCount := m.uint32()
+			for i := uint32(0); i < rangeCount && m.err == nil; i++ {
+				var r MaterialRange
+				r.firstFace = m.uint32()
+				r.faceCount = m.uint32()
+				file.materialRanges = append(file.materialRanges, r)
+			}
+		case string(tag[:]) == "LODS" && h.version >= 13:
+			for i := uint32(0); i < h.lodCount && m.err == nil; i++ {
+				var r LODRange
+				r.firstFace = m.uint32()
+				r.faceCount = m.uint32()
+				r.switchDistance = m.float32()
+				file.lodRanges = append(file.lodRanges, r)
+			}
+		case string(tag[:]) == "VSPL" && h.vertexType&VERTEX_SPLITS != 0:
+			file.baseVertexCount = m.uint32()
+			splitCount := m.uint32()
+			for i := uint32(0); i < splitCount && m.err == nil; i++ {
+				var split VertexSplit
+				split.source = m.uint32()
+				split.vertex = m.uint32()
+				cornerCount := m.uint32()
+				for j := uint32(0); j < cornerCount && m.err == nil; j++ {
+					var c SplitCorner
+					c.face = m.uint32()
+					m.read(&c.corner)
+					split.corners = append(split.corners, c)
+				}
+				newFaceCount := m.uint32()
+				for j := uint32(0); j < newFaceCount && m.err == nil; j++ {
+					split.newFaces = append(split.newFaces, m.face(h))
+				}
+				file.vertexSplits = append(file.vertexSplits, split)
+			}
+		default:
+			return nil, fmt.Errorf("reading MSHX: unknown section %q", tag[:])
+		}
+	}
+	if m.err != nil {
+		return nil, fmt.Errorf("reading MSHX: %w", m.err)
+	}
+	return file, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadBigEndianFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": cubeOBJ})
+	little := readOutput(t, convertFile(t, dir, "in.obj"))
+
+	resetCommandLine()
+	output := filepath.Join(dir, "big.mshx")
+	if err := Convert([]string{"-be", filepath.Join(dir, "in.obj"), output}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := readOutput(t, data)
+
+	if little.header.byteOrder != binary.LittleEndian || big.header.byteOrder != binary.BigEndian {
+		t.Errorf("read the -le file as %v and the -be file as %v", little.header.byteOrder, big.header.byteOrder)
+	}
+	if big.header.version != MSHX_VERSION {
+		t.Errorf("version %d, want %d", big.header.version, MSHX_VERSION)
+	}
+	if !slices.Equal(big.vertices, little.vertices) || !slices.Equal(big.normals, little.normals) {
+		t.Error("the big endian file has different vertices or normals")
+	}
+	if len(big.faces) != len(little.faces) {
+		t.Fatalf("got %d faces, want %d", len(big.faces), len(little.faces))
+	}
+	for i := range big.faces {
+		if !slices.Equal(big.faces[i].v, little.faces[i].v) {
+			t.Errorf("face %d uses %v, want %v", i, big.faces[i].v, little.faces[i].v)
+		}
+	}
+	if big.header.sphere != little.header.sphere {
+		t.Errorf("sphere %v, want %v", big.header.sphere, little.header.sphere)
+	}
+}
+
+func TestVertexColourRoundTrip(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": "v 0 0 0 1 0 0 0.5\nv 1 0 0 1 0 0 0.5\nv 0 1 0 1 0 0 0.5\nf 1 2 3\n"})
+	data := convertFile(t, dir, "in.obj")
+	file := readOutput(t, data)
+	if file.header.vertexType&VERTEX_COLOR == 0 {
+		t.Fatal("the output has no vertex colours")
+	}
+	for i, v := range file.vertices {
+		if v.R != 1 || v.G != 0 || v.B != 0 || v.A != 0.5 {
+			t.Errorf("vertex %d has colour r %g g %g b %g a %g, want 1 0 0 0.5", i, v.R, v.G, v.B, v.A)
+		}
+	}
+
+	// The reader could undo a swapped order, so look for the channels in the file itself.
+	var stored []byte
+	for _, f := range []float32{1, 0, 0, 0.5} {
+		stored = binary.LittleEndian.AppendUint32(stored, math.Float32bits(f))
+	}
+	if !bytes.Contains(data, stored) {
+		t.Error("the colour is not stored in r,g,b,a order")
+	}
+}
+
+func TestFlippedByteFailsChecksum(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": cubeOBJ})
+	data := convertFile(t, dir, "in.obj")
+	// Flip a byte of each part of the file in turn, the header, the body and the checksum.
+	for _, offset := range []int{8, len(data) / 2, len(data) - 1} {
+		corrupt := slices.Clone(data)
+		corrupt[offset] ^= 0x01
+		if _, err := ReadMSHX(bytes.NewReader(corrupt)); err == nil {
+			t.Errorf("flipping byte %d of %d went unnoticed", offset, len(data))
+		} else if offset != 8 && !errors.Is(err, ErrChecksum) {
+			t.Errorf("flipping byte %d gave %v, want a checksum error", offset, err)
+		}
+	}
+}
+
+func TestReadRejectsBadMagicAndFutureVersions(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": cubeOBJ})
+	data := convertFile(t, dir, "in.obj")
+
+	wrongMagic := slices.Clone(data)
+	copy(wrongMagic, "MSHY")
+	if _, err := ReadMSHX(bytes.NewReader(wrongMagic)); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("reading a file with magic MSHY gave %v, want %v", err, ErrBadMagic)
+	}
+	if _, err := ReadMSHX(bytes.NewReader([]byte("MSH"))); err == nil {
+		t.Error("reading a truncated magic succeeded")
+	}
+
+	future := slices.Clone(data)
+	binary.LittleEndian.PutUint32(future[4:], MSHX_VERSION+1)
+	if _, err := ReadMSHX(bytes.NewReader(future)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("reading version %d gave %v, want %v", MSHX_VERSION+1, err, ErrUnsupportedVersion)
+	}
+}
+
+func TestVertexWRoundTrip(t *testing.T) {
+	file := convertOBJ(t, "v 0 0 0 2\nv 1 0 0 0.5\nv 0 1 0\nf 1 2 3\n", "-keepunused")
+	if file.header.vertexType&VERTEX_W == 0 {
+		t.Fatal("the vertex w was not written")
+	}
+	for i, want := range []float32{2, 0.5, 1} {
+		if file.vertices[i].W != want {
+			t.Errorf("vertex %d has w %g, want %g", i, file.vertices[i].W, want)
+		}
+	}
+
+	// With every w at 1 nothing extra is written and the reader assumes 1.
+	plain := convertOBJ(t, "v 0 0 0 1\nv 1 0 0\nv 0 1 0\nf 1 2 3\n")
+	if plain.header.vertexType&VERTEX_W != 0 {
+		t.Error("w was written although every vertex has w 1")
+	}
+	for i, v := range plain.vertices {
+		if v.W != 1 {
+			t.Errorf("vertex %d has w %g, want 1", i, v.W)
+		}
+	}
+}
+
+func TestTextureCoordWRoundTrip(t *testing.T) {
+	file := convertOBJ(t, "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0 0.25\nvt 1 0 0.5\nvt 0 1\nf 1/1 2/2 3/3\n", "-keepunused")
+	if file.header.vertexType&UV_W == 0 {
+		t.Fatal("the texture coord w was not written")
+	}
+	want := []TextureCoord{{U: 0, V: 0, W: 0.25}, {U: 1, V: 0, W: 0.5}, {U: 0, V: 1, W: 0}}
+	for i := range want {
+		if got := file.textureCoords[i]; got.U != want[i].U || got.V != want[i].V || got.W != want[i].W {
+			t.Errorf("texture coord %d is %g,%g,%g, want %g,%g,%g", i, got.U, got.V, got.W, want[i].U, want[i].V, want[i].W)
+		}
+	}
+
+	if plain := convertOBJ(t, "v 0 0 0\nv 1 0 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 0 1\nf 1/1 2/2 3/3\n"); plain.header.vertexType&UV_W != 0 {
+		t.Error("w was written for texture coords with only u and v")
+	}
+}
+
+func TestGzipOutputRoundTrip(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": cubeOBJ})
+	plain := convertFile(t, dir, "in.obj")
+	compressed := convertFile(t, dir, "in.obj", "-gzout")
+	if len(compressed) < 2 || compressed[0] != 0x1f || compressed[1] != 0x8b {
+		t.Fatal("the -gzout output does not start with the gzip magic")
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inflated, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(inflated, plain) {
+		t.Error("the decompressed output differs from the uncompressed output")
+	}
+
+	file, want := readOutput(t, compressed), readOutput(t, plain)
+	if !slices.Equal(file.vertices, want.vertices) || len(file.faces) != len(want.faces) {
+		t.Error("reading the -gzout output gave a different mesh")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse a -smooth value given as "lambda,iterations".
+func ParseSmooth(s string) (float64, int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected lambda,iterations but got %q", s)
+	}
+	lambda, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || lambda <= 0 || lambda > 1 {
+		return 0, 0, fmt.Errorf("lambda %q must be above 0 and at most 1", parts[0])
+	}
+	iterations, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || iterations < 1 {
+		return 0, 0, fmt.Errorf("iterations %q must be at least 1", parts[1])
+	}
+	return lambda, iterations, nil
+}
+
+// Laplacian smoothing, each iteration moves every vertex lambda of the way towards the average
+// of the vertices it shares an edge with. Vertices on an open or non-manifold edge stay where
+// they are so the outline of the mesh does not shrink, as do vertices used by a line or point
+// element. Vertices split along a seam are not connected, so weld or dedupe them first.
+func (m *Mesh) SmoothMesh(lambda float64, iterations int) error {
+	if len(m.faces) == 0 {
+		Logf(LOG_WARN, "Warning: The mesh has no faces, -smooth is ignored.\n")
+		return nil
+	}
+	if lambda <= 0 || lambda > 1 || iterations < 1 {
+		return errors.New("invalid smoothing parameters")
+	}
+
+	edgeCount := make(map[Edge]int)
+	neighbours := make([][]uint32, len(m.vertices))
+	for i := range m.faces {
+		f := &m.faces[i]
+		for j := range f.v {
+			a, b := f.v[j], f.v[(j+1)%len(f.v)]
+			e := MakeEdge(a, b)
+			if edgeCount[e] == 0 {
+				neighbours[a] = append(neighbours[a], b)
+				neighbours[b] = append(neighbours[b], a)
+			}
+			edgeCount[e]++
+		}
+	}
+	locked := make([]bool, len(m.vertices))
+	for e, count := range edgeCount {
+		if count != 2 {
+			locked[e.a] = true
+			locked[e.b] = true
+		}
+	}
+	m.ForEachElementVertex(func(v uint32) { locked[v] = true })
+
+	var moved, kept int = 0, 0
+	for i := range m.vertices {
+		if len(neighbours[i]) == 0 {
+			continue
+		}
+		if locked[i] {
+			kept++
+		} else {
+			moved++
+		}
+	}
+
+	// Every vertex of an iteration moves from the positions of the previous one.
+	positions := make([][3]float64, len(m.vertices))
+	for iteration := 0; iteration < iterations; iteration++ {
+		for i := range m.vertices {
+			positions[i] = m.vertices[i].position()
+		}
+		for i := range m.vertices {
+			if locked[i] || len(neighbours[i]) == 0 {
+				continue
+			}
+			var average [3]float64
+			for _, n := range neighbours[i] {
+				for k := 0; k < 3; k++ {
+					average[k] += positions[n][k]
+				}
+			}
+			p := positions[i]
+			for k := 0; k < 3; k++ {
+				average[k] /= float64(len(neighbours[i]))
+				p[k] += lambda * (average[k] - p[k])
+			}
+			m.vertices[i].setPosition(p[0], p[1], p[2])
+		}
+	}
+	Logf(LOG_INFO, "Smoothed %d vertices with %d iterations of lambda %g, %d boundary vertices kept in place.\n", moved, iterations, lambda, kept)
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// A flat n by n grid of triangles which each have their own copy of their corners, every copy
+// jittered by up to 1e-5. The interior grid points are also lifted by up to 0.1.
+func noisyGridOBJ(n int, seed int64) string {
+	r := rand.New(rand.NewSource(seed))
+	lift := make([]float64, (n+1)*(n+1))
+	for y := 1; y < n; y++ {
+		for x := 1; x < n; x++ {
+			lift[y*(n+1)+x] = (r.Float64()*2 - 1) * 0.1
+		}
+	}
+	var b strings.Builder
+	var count int = 0
+	corner := func(x, y int) int {
+		jitter := func() float64 { return (r.Float64()*2 - 1) * 1e-5 }
+		fmt.Fprintf(&b, "v %g %g %g\n", float64(x)+jitter(), float64(y)+jitter(), lift[y*(n+1)+x])
+		count++
+		return count
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			a, c, d := corner(x, y), corner(x+1, y), corner(x+1, y+1)
+			fmt.Fprintf(&b, "f %d %d %d\n", a, c, d)
+			a, c, d = corner(x, y), corner(x+1, y+1), corner(x, y+1)
+			fmt.Fprintf(&b, "f %d %d %d\n", a, c, d)
+		}
+	}
+	return b.String()
+}
+
+func TestWeldAndSmoothNoisyGrid(t *testing.T) {
+	const n = 8
+	obj := noisyGridOBJ(n, 3)
+	var noise float64 = 0
+	for _, line := range strings.Split(obj, "\n") {
+		var x, y, z float64
+		if _, err := fmt.Sscanf(line, "v %g %g %g", &x, &y, &z); err == nil {
+			noise = max(noise, math.Abs(z))
+		}
+	}
+
+	welded := convertOBJ(t, obj, "-weld", "0.001")
+	if len(welded.vertices) != (n+1)*(n+1) {
+		t.Fatalf("welding left %d vertices, want one per grid point, %d", len(welded.vertices), (n+1)*(n+1))
+	}
+
+	smoothed := convertOBJ(t, obj, "-weld", "0.001", "-smooth", "0.5,20")
+	var worst float64 = 0
+	for i, v := range smoothed.vertices {
+		onBoundary := math.Round(float64(v.X)) == 0 || math.Round(float64(v.X)) == n || math.Round(float64(v.Y)) == 0 || math.Round(float64(v.Y)) == n
+		if onBoundary && v.Z != 0 {
+			t.Errorf("boundary vertex %d at %g,%g moved to z %g", i, v.X, v.Y, v.Z)
+		}
+		worst = max(worst, math.Abs(float64(v.Z)))
+	}
+	if worst > noise/4 {
+		t.Errorf("smoothing left the grid %g from flat, it started %g away", worst, noise)
+	}
+}
+
+func TestSmoothRelaxesDisplacedVertex(t *testing.T) {
+	// A flat 4 by 4 grid with the middle vertex lifted to z 1.
+	const n = 4
+	var b strings.Builder
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			var z int = 0
+			if x == n/2 && y == n/2 {
+				z = 1
+			}
+			fmt.Fprintf(&b, "v %d %d %d\n", x, y, z)
+		}
+	}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			a := y*(n+1) + x + 1
+			fmt.Fprintf(&b, "f %d %d %d\n", a, a+1, a+n+2)
+			fmt.Fprintf(&b, "f %d %d %d\n", a, a+n+2, a+n+1)
+		}
+	}
+
+	file := convertOBJ(t, b.String(), "-smooth", "0.5,1")
+	for i, v := range file.vertices {
+		x, y := i%(n+1), i/(n+1)
+		switch {
+		case x == n/2 && y == n/2:
+			// Its six neighbours are all at z 0 and centred on it, so it moves half way down.
+			if v.X != float32(x) || v.Y != float32(y) || v.Z != 0.5 {
+				t.Errorf("the displaced vertex moved to %g,%g,%g, want %d,%d,0.5", v.X, v.Y, v.Z, x, y)
+			}
+		case x == 0 || x == n || y == 0 || y == n:
+			if v.X != float32(x) || v.Y != float32(y) || v.Z != 0 {
+				t.Errorf("boundary vertex %d,%d moved to %g,%g,%g", x, y, v.X, v.Y, v.Z)
+			}
+		case (x-n/2)*(y-n/2) < 0:
+			// Across the diagonals from the displaced vertex, so not one of its neighbours.
+			if v.Z != 0 {
+				t.Errorf("interior vertex %d,%d which does not share an edge with the displaced one moved to z %g", x, y, v.Z)
+			}
+		case v.Z <= 0 || v.Z >= 0.5:
+			t.Errorf("interior vertex %d,%d next to the displaced one is at z %g, want it pulled part way up", x, y, v.Z)
+		}
+	}
+}
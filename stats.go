@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Figures gathered during a conversion for -stats.
+type MeshStats struct {
+	duplicateVertices int
+	duplicateNormals  int
+	duplicateUVs      int
+	duplicateFaces    int
+	strideBefore      int
+	strideAfter       int
+	acmrBefore        float64
+	acmrAfter         float64
+}
+
+// Sum of the index distance between consecutive face corners, lower values mean better
+// vertex cache locality.
+func (m *Mesh) StrideDistance() int {
+	var total int = 0
+	if len(m.faces) == 0 {
+		return total
+	}
+	var curIdx int = int(m.faces[0].v[0])
+	for i := 0; i < len(m.faces); i++ {
+		for j := 0; j < int(m.faces[i].edges); j++ {
+			total += int(math.Abs(float64(int(m.faces[i].v[j]) - curIdx)))
+			curIdx = int(m.faces[i].v[j])
+		}
+	}
+	return total
+}
+
+// Average cache miss ratio, the number of vertices transformed per triangle when the faces
+// are drawn in order through a FIFO post-transform cache of cacheSize entries. Quads are drawn
+// as two triangles. 0.5 is the best possible for a large regular mesh and 3 the worst.
+func (m *Mesh) SimulateVertexCache(cacheSize int) float64 {
+	var misses, triangles int = 0, 0
+	cache := make([]uint32, 0, cacheSize)
+	cached := make(map[uint32]bool)
+	use := func(v uint32) {
+		if cached[v] {
+			return
+		}
+		misses++
+		if len(cache) == cacheSize {
+			delete(cached, cache[0])
+			cache = cache[1:]
+		}
+		cache = append(cache, v)
+		cached[v] = true
+	}
+	for i := range m.faces {
+		for j := 1; j+1 < int(m.faces[i].edges); j++ {
+			use(m.faces[i].v[0])
+			use(m.faces[i].v[j])
+			use(m.faces[i].v[j+1])
+			triangles++
+		}
+	}
+	if triangles == 0 {
+		return 0
+	}
+	return float64(misses) / float64(triangles)
+}
+
+// Print a summary of the converted mesh as key=value lines.
+func (m *Mesh) PrintStats() {
+	var triangles, quads int = 0, 0
+	for i := range m.faces {
+		if m.faces[i].edges == 3 {
+			triangles++
+		} else {
+			quads++
+		}
+	}
+	fmt.Fprintf(logOutput, "vertices=%d\n", len(m.vertices))
+	fmt.Fprintf(logOutput, "normals=%d\n", len(m.normals))
+	fmt.Fprintf(logOutput, "uvs=%d\n", len(m.textureCoords))
+	fmt.Fprintf(logOutput, "faces=%d\n", len(m.faces))
+	fmt.Fprintf(logOutput, "triangles=%d\n", triangles)
+	fmt.Fprintf(logOutput, "quads=%d\n", quads)
+	fmt.Fprintf(logOutput, "lines=%d\n", len(m.polylines))
+	fmt.Fprintf(logOutput, "points=%d\n", len(m.points))
+	fmt.Fprintf(logOutput, "materials=%d\n", len(m.materials))
+	fmt.Fprintf(logOutput, "sphere_radius=%f\n", m.boundSphere.radius)
+	fmt.Fprintf(logOutput, "aabb_x=%f\n", m.boundBox.max.X-m.boundBox.min.X)
+	fmt.Fprintf(logOutput, "aabb_y=%f\n", m.boundBox.max.Y-m.boundBox.min.Y)
+	fmt.Fprintf(logOutput, "aabb_z=%f\n", m.boundBox.max.Z-m.boundBox.min.Z)
+	fmt.Fprintf(logOutput, "duplicate_vertices=%d\n", m.meshStats.duplicateVertices)
+	fmt.Fprintf(logOutput, "duplicate_normals=%d\n", m.meshStats.duplicateNormals)
+	fmt.Fprintf(logOutput, "duplicate_uvs=%d\n", m.meshStats.duplicateUVs)
+	fmt.Fprintf(logOutput, "duplicate_faces=%d\n", m.meshStats.duplicateFaces)
+	fmt.Fprintf(logOutput, "stride_before=%d\n", m.meshStats.strideBefore)
+	fmt.Fprintf(logOutput, "stride_after=%d\n", m.meshStats.strideAfter)
+	// The fraction of the stride distance left after optimising, below 1 is an improvement.
+	var strideRatio float64 = 1
+	if m.meshStats.strideBefore > 0 {
+		strideRatio = float64(m.meshStats.strideAfter) / float64(m.meshStats.strideBefore)
+	}
+	fmt.Fprintf(logOutput, "stride_ratio=%f\n", strideRatio)
+	fmt.Fprintf(logOutput, "acmr_before=%f\n", m.meshStats.acmrBefore)
+	fmt.Fprintf(logOutput, "acmr_after=%f\n", m.meshStats.acmrAfter)
+
+	// Triangles drawn with each material, heaviest first, quads count as two.
+	materialTriangles := make([]int, len(m.materials))
+	for i := range m.faces {
+		if id := m.faces[i].materialID; id < uint32(len(m.materials)) {
+			materialTriangles[id] += int(m.faces[i].edges) - 2
+		}
+	}
+	order := make([]int, len(m.materials))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return materialTriangles[b] - materialTriangles[a]
+	})
+	for _, id := range order {
+		fmt.Fprintf(logOutput, "material_%d_name=%s\n", id, m.materials[id].name)
+		fmt.Fprintf(logOutput, "material_%d_triangles=%d\n", id, materialTriangles[id])
+		fmt.Fprintf(logOutput, "material_%d_textured=%t\n", id, m.materials[id].texture != "")
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Flags which still apply when streaming, everything else needs the whole mesh in memory.
+var streamFlags = []string{"le", "be", "silent", "v", "vv", "stream", "maxline", "gzout", "keepunused", "encoding"}
+
+// Check no flags which need the whole mesh in memory were given with -stream.
+func CheckStreamFlags(inputFileName string) error {
+	var bad []string
+	convertFlags.Visit(func(f *flag.Flag) {
+		if !slices.Contains(streamFlags, f.Name) {
+			bad = append(bad, "-"+f.Name)
+		}
+	})
+	if len(bad) > 0 {
+		Logf(LOG_ERROR, "Error: -stream cannot be combined with %s.\n", strings.Join(bad, " "))
+		return errors.New("flags not supported when streaming")
+	}
+	if inputFileName == "-" {
+		Logf(LOG_ERROR, "Error: -stream reads the input several times so it cannot read from stdin.\n")
+		return errors.New("cannot stream from stdin")
+	}
+	return nil
+}
+
+// Call fn for each non-empty, non-comment line of the OBJ file from the start, with the
+// line normalised to single spaces.
+func (m *Mesh) scanOBJ(inputFile *os.File, fn func(lineNumber int, line string, lineParts []string) error) error {
+	if _, err := inputFile.Seek(0, io.SeekStart); err != nil {
+		Logf(LOG_ERROR, "Error rewinding file %s: %v\n", m.inputFileName, err)
+		return err
+	}
+	objReader, err := DecompressInput(inputFile, m.inputFileName)
+	if err != nil {
+		return err
+	}
+	var lineNumber int = 0
+	var scanner LineScanner = NewLineScanner(objReader)
+	for scanner.Scan() {
+		lineNumber++
+		lineParts := strings.Fields(StripComment(scanner.Text()))
+		if len(lineParts) == 0 {
+			continue
+		}
+		if err := fn(lineNumber, strings.Join(lineParts, " "), lineParts); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		LogScanError(m.inputFileName, err)
+		return err
+	}
+	return nil
+}
+
+// Convert without holding the mesh in memory. A first pass counts the elements, loads the
+// materials and grows the bounds, then one pass per section writes the vertices, normals,
+// texture coords, faces, lines and points in the order the MSHX layout needs them.
+// Nothing is pruned, so the output matches an in-memory conversion with -keepunused apart
+// from the bounding sphere, which is grown a vertex at a time instead of fitted to the
+// whole mesh. Normals or texture coords that no face uses are an error rather than dropped.
+func (m *Mesh) StreamConvert(inputFile *os.File, outputFile io.Writer) error {
+	var vertexCount, normalCount, uvCount, faceCount uint32 = 0, 0, 0, 0
+	var lineCount, pointCount uint32 = 0, 0
+	// The usemtl and usemap pairs used by faces, the usemap materials can only be made once
+	// every mtllib has been read.
+	type materialUse struct {
+		material, textureMap string
+	}
+	var usedMaterials []materialUse
+	var materialName, textureMap string
+	useName := func(use materialUse) string {
+		if use.textureMap != "" {
+			return m.TextureMapMaterial(use.material, use.textureMap)
+		}
+		return use.material
+	}
+	err := m.scanOBJ(inputFile, func(lineNumber int, line string, lineParts []string) error {
+		switch lineParts[0] {
+		case "v":
+			v := m.ParseVertex(line, lineParts)
+			if vertexCount == 0 {
+				m.boundBox.min, m.boundBox.max = v, v
+				m.boundSphere.center = Vertex{X: v.X, Y: v.Y, Z: v.Z, W: 1.0}
+				m.boundSphere.radius = 0
+			}
+			m.boundBox.min, m.boundBox.max = MinMax([]Vertex{m.boundBox.min, m.boundBox.max, v})
+
+			// Grow the sphere to hold each point as it arrives, as in the final step of Ritter's algorithm.
+			dist := Distance(m.boundSphere.center, v)
+			if dist > float64(m.boundSphere.radius) {
+				newRadius := (float64(m.boundSphere.radius) + dist) / 2
+				ratio := (newRadius - float64(m.boundSphere.radius)) / dist
+				m.boundSphere.center.X += float32(float64(v.X-m.boundSphere.center.X) * ratio)
+				m.boundSphere.center.Y += float32(float64(v.Y-m.boundSphere.center.Y) * ratio)
+				m.boundSphere.center.Z += float32(float64(v.Z-m.boundSphere.center.Z) * ratio)
+				m.boundSphere.radius = float32(newRadius)
+			}
+			vertexCount++
+		case "vn":
+			normalCount++
+		case "vt":
+			// Parsed for the vertex type flags it sets.
+			m.ParseTextureCoord(line, lineParts)
+			uvCount++
+		case "f":
+			if use := (materialUse{materialName, textureMap}); !slices.Contains(usedMaterials, use) {
+				usedMaterials = append(usedMaterials, use)
+			}
+			faceCount++
+		case "l":
+			lineCount++
+		case "p":
+			pointCount += uint32(len(lineParts) - 1)
+		case "usemtl":
+			materialName = m.MaterialName(strings.TrimSpace(line[len("usemtl"):]))
+		case "usemap":
+			textureMap = ParseUseMap(line)
+		case "mtllib":
+			for _, materialFileName := range lineParts[1:] {
+				if err := m.ProcessMaterialFile(materialFileName, filepath.Dir(m.inputFileName)); err != nil {
+					Logf(LOG_ERROR, "Error processing material file: %v\n", err)
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Resolve the materials now so any default material is counted in the header.
+	for _, use := range usedMaterials {
+		m.ResolveMaterial(useName(use))
+	}
+	Logf(LOG_INFO, "Streaming %d vertices, %d normals, %d texture coords, %d faces, %d lines, %d points.\n", vertexCount, normalCount, uvCount, faceCount, lineCount, pointCount)
+
+	writer, checksum := newChecksumWriter(outputFile)
+	byteOrder := OutputByteOrder()
+	m.writeHeader(writer, byteOrder, vertexCount, normalCount, uvCount, faceCount, lineCount, pointCount)
+
+	err = m.scanOBJ(inputFile, func(lineNumber int, line string, lineParts []string) error {
+		if lineParts[0] == "v" {
+			v := m.ParseVertex(line, lineParts)
+			m.writeVertex(writer, byteOrder, &v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = m.scanOBJ(inputFile, func(lineNumber int, line string, lineParts []string) error {
+		if lineParts[0] == "vn" {
+			n := ParseNormal(line)
+			writeNormal(writer, byteOrder, &n)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = m.scanOBJ(inputFile, func(lineNumber int, line string, lineParts []string) error {
+		if lineParts[0] == "vt" {
+			t := m.ParseTextureCoord(line, lineParts)
+			m.writeTextureCoord(writer, byteOrder, &t)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	materialName, textureMap = "", ""
+	err = m.scanOBJ(inputFile, func(lineNumber int, line string, lineParts []string) error {
+		switch lineParts[0] {
+		case "usemtl":
+			materialName = m.MaterialName(strings.TrimSpace(line[len("usemtl"):]))
+		case "usemap":
+			textureMap = ParseUseMap(line)
+		case "f":
+			face, err := ParseFace(line, lineParts, lineNumber)
+			if err != nil {
+				return err
+			}
+			// Every face must carry exactly the streams named in the header.
+			if (len(face.n) > 0) != (normalCount > 0) || (len(face.uv) > 0) != (uvCount > 0) {
+				Logf(LOG_ERROR, "Error: Face on line %d does not use the same normals/texture coords as the rest of the file.\n", lineNumber)
+				return errors.New("faces mix attribute streams")
+			}
+			for j := 0; j < int(face.edges); j++ {
+				if face.v[j] >= vertexCount || (len(face.n) > 0 && face.n[j] >= normalCount) || (len(face.uv) > 0 && face.uv[j] >= uvCount) {
+					Logf(LOG_ERROR, "Error: Face on line %d has an out of range index.\n", lineNumber)
+					return fmt.Errorf("face on line %d has out of range index", lineNumber)
+				}
+			}
+			face.materialID = m.ResolveMaterial(useName(materialUse{materialName, textureMap}))
+			m.writeFace(writer, byteOrder, &face)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if lineCount > 0 {
+		// Relative indices count back from the vertices and texture coords read so far.
+		var vertexSeen, uvSeen int = 0, 0
+		err = m.scanOBJ(inputFile, func(lineNumber int, line string, lineParts []string) error {
+			switch lineParts[0] {
+			case "v":
+				vertexSeen++
+			case "vt":
+				uvSeen++
+			case "l":
+				polyline, err := ParseLineElement(line, lineParts, lineNumber, vertexSeen, uvSeen)
+				if err != nil {
+					return err
+				}
+				for j := range polyline.v {
+					if polyline.v[j] >= vertexCount || (len(polyline.uv) > 0 && polyline.uv[j] >= uvCount) {
+						Logf(LOG_ERROR, "Error: Line element on line %d has an out of range index.\n", lineNumber)
+						return fmt.Errorf("line element on line %d has out of range index", lineNumber)
+					}
+				}
+				m.writePolyline(writer, byteOrder, &polyline)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if pointCount > 0 {
+		var vertexSeen int = 0
+		err = m.scanOBJ(inputFile, func(lineNumber int, line string, lineParts []string) error {
+			switch lineParts[0] {
+			case "v":
+				vertexSeen++
+			case "p":
+				elementPoints, err := ParsePointElement(line, lineParts, lineNumber, vertexSeen)
+				if err != nil {
+					return err
+				}
+				for j := range elementPoints {
+					if elementPoints[j].v >= vertexCount {
+						Logf(LOG_ERROR, "Error: Point element on line %d has an out of range index.\n", lineNumber)
+						return fmt.Errorf("point element on line %d has out of range index", lineNumber)
+					}
+					writePoint(writer, byteOrder, &elementPoints[j])
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	m.writeMaterials(writer, byteOrder)
+
+	return writeChecksum(writer, checksum, outputFile, byteOrder)
+}
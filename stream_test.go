@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStreamMatchesInMemoryKeepUnused(t *testing.T) {
+	// Vertex 9 is not used by any face, both conversions keep it.
+	dir := writeFiles(t, map[string]string{"in.obj": cubeOBJ + "v 5 5 5\n"})
+	memory := readOutput(t, convertFile(t, dir, "in.obj", "-keepunused"))
+	stream := readOutput(t, convertFile(t, dir, "in.obj", "-stream"))
+
+	if len(stream.vertices) != 9 {
+		t.Errorf("streaming wrote %d vertices, want all 9", len(stream.vertices))
+	}
+	if !slices.Equal(stream.vertices, memory.vertices) || !slices.Equal(stream.normals, memory.normals) {
+		t.Error("streaming wrote different vertices or normals")
+	}
+	if len(stream.faces) != len(memory.faces) {
+		t.Fatalf("streaming wrote %d faces, want %d", len(stream.faces), len(memory.faces))
+	}
+	for i := range stream.faces {
+		if !slices.Equal(stream.faces[i].v, memory.faces[i].v) || !slices.Equal(stream.faces[i].n, memory.faces[i].n) {
+			t.Errorf("streamed face %d uses %v/%v, want %v/%v", i, stream.faces[i].v, stream.faces[i].n, memory.faces[i].v, memory.faces[i].n)
+		}
+	}
+	if stream.header.box != memory.header.box {
+		t.Errorf("streamed box %v, want %v", stream.header.box, memory.header.box)
+	}
+	// The streamed sphere is only grown, so it need not match but must still hold the mesh.
+	for i, v := range stream.vertices {
+		if d := Distance(stream.header.sphere.center, v); d > float64(stream.header.sphere.radius)*1.0001 {
+			t.Errorf("vertex %d is %g from the streamed sphere centre, outside radius %g", i, d, stream.header.sphere.radius)
+		}
+	}
+
+	// Without -keepunused the in-memory conversion prunes the vertex, streaming never does.
+	if pruned := readOutput(t, convertFile(t, dir, "in.obj")); len(pruned.vertices) != 8 {
+		t.Errorf("the in-memory conversion wrote %d vertices, want the unused one pruned", len(pruned.vertices))
+	}
+}
+
+func TestStreamRejectsUnusedNormals(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"in.obj": "v 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nf 1 2 3\n"})
+	if file := readOutput(t, convertFile(t, dir, "in.obj")); len(file.normals) != 0 {
+		t.Errorf("the in-memory conversion kept %d unused normals", len(file.normals))
+	}
+	resetCommandLine()
+	if err := Convert([]string{"-stream", filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx")}); err == nil {
+		t.Error("streaming a file with unused normals succeeded")
+	}
+}
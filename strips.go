@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+)
+
+// A triangle strip, triangle k uses v[k],v[k+1],v[k+2] with the first two swapped for odd k
+// so every triangle keeps the winding of the face it came from.
+type TriangleStrip struct {
+	v          []uint32
+	materialID uint32
+}
+
+// Greedily join the triangles into strips, starting each strip from the first unused triangle
+// in face order and extending it across shared edges while the next triangle is unused and has
+// the same material. Each start is tried in all three rotations and the longest strip kept.
+// The faces must be triangles using a single index stream.
+func (m *Mesh) BuildTriangleStrips() error {
+	for i := range m.faces {
+		if m.faces[i].edges != 3 {
+			Logf(LOG_ERROR, "Error: Triangle strips require a triangle mesh, use -q 3 to convert quads.\n")
+			return errors.New("triangle strips require triangles")
+		}
+	}
+
+	// The triangle using each directed edge, the neighbour across an edge uses it reversed.
+	edgeFace := make(map[[2]uint32]int)
+	for i := range m.faces {
+		for j := 0; j < 3; j++ {
+			e := [2]uint32{m.faces[i].v[j], m.faces[i].v[(j+1)%3]}
+			if _, ok := edgeFace[e]; !ok {
+				edgeFace[e] = i
+			}
+		}
+	}
+
+	used := make([]bool, len(m.faces))
+	grow := func(start int, rotation int) ([]uint32, []int) {
+		f := &m.faces[start]
+		strip := []uint32{f.v[rotation], f.v[(rotation+1)%3], f.v[(rotation+2)%3]}
+		members := []int{start}
+		inStrip := map[int]bool{start: true}
+		for {
+			p, q := strip[len(strip)-2], strip[len(strip)-1]
+			e := [2]uint32{p, q}
+			if (len(strip)-2)%2 == 1 {
+				e = [2]uint32{q, p}
+			}
+			next, ok := edgeFace[e]
+			if !ok || used[next] || inStrip[next] || m.faces[next].materialID != f.materialID {
+				break
+			}
+			var r uint32
+			for j := 0; j < 3; j++ {
+				if m.faces[next].v[j] == e[0] {
+					r = m.faces[next].v[(j+2)%3]
+				}
+			}
+			strip = append(strip, r)
+			members = append(members, next)
+			inStrip[next] = true
+		}
+		return strip, members
+	}
+
+	m.triangleStrips = nil
+	var indexCount int = 0
+	for i := range m.faces {
+		if used[i] {
+			continue
+		}
+		var best []uint32
+		var bestMembers []int
+		for rotation := 0; rotation < 3; rotation++ {
+			strip, members := grow(i, rotation)
+			if len(strip) > len(best) {
+				best, bestMembers = strip, members
+			}
+		}
+		for _, member := range bestMembers {
+			used[member] = true
+		}
+		m.triangleStrips = append(m.triangleStrips, TriangleStrip{v: best, materialID: m.faces[i].materialID})
+		indexCount += len(best)
+	}
+
+	// Material ranges count strips rather than faces once the faces are replaced.
+	if m.materialRanges != nil {
+		m.materialRanges = make([]MaterialRange, len(m.materials))
+		for i := range m.triangleStrips {
+			id := m.triangleStrips[i].materialID
+			if id >= uint32(len(m.materialRanges)) {
+				continue
+			}
+			if m.materialRanges[id].faceCount == 0 {
+				m.materialRanges[id].firstFace = uint32(i)
+			}
+			m.materialRanges[id].faceCount++
+		}
+	}
+	Logf(LOG_INFO, "Built %d triangle strips from %d triangles, %d indices instead of %d\n", len(m.triangleStrips), len(m.faces), indexCount, len(m.faces)*3)
+	return nil
+}
+
+func writeTriangleStrip(writer *bufio.Writer, byteOrder binary.ByteOrder, s *TriangleStrip) {
+	binary.Write(writer, byteOrder, uint32(len(s.v)))
+	binary.Write(writer, byteOrder, s.v)
+	binary.Write(writer, byteOrder, s.materialID)
+}
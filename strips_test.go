@@ -0,0 +1,40 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTriangleStripsExpandToTheFaces(t *testing.T) {
+	original := convertOBJ(t, gridOBJ(6))
+	file := convertOBJ(t, gridOBJ(6), "-triangulate-strip")
+
+	// Expand the strips back into triangles, swapping the first two corners at odd positions.
+	var faces []Face
+	var oddTriangles int = 0
+	for _, s := range file.triangleStrips {
+		for k := 0; k+2 < len(s.v); k++ {
+			f := Face{edges: 3, materialID: s.materialID}
+			f.v = []uint32{s.v[k], s.v[k+1], s.v[k+2]}
+			if k%2 == 1 {
+				f.v[0], f.v[1] = f.v[1], f.v[0]
+				oddTriangles++
+			}
+			faces = append(faces, f)
+		}
+	}
+	if oddTriangles == 0 {
+		t.Fatalf("no strip has more than one triangle, %d strips were written", len(file.triangleStrips))
+	}
+	if len(file.triangleStrips) >= len(original.faces) {
+		t.Errorf("%d strips for %d triangles", len(file.triangleStrips), len(original.faces))
+	}
+
+	// The same triangles with the same winding, in any order.
+	want, got := trianglePositions(original.vertices, original.faces), trianglePositions(file.vertices, faces)
+	slices.Sort(want)
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("the strips expand to\n%v\nwant the faces\n%v", got, want)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Generate a tangent and bitangent for every distinct normal and texture coord pair used by a
+// face corner, from the texture coord gradients of the faces around it. Each face corner gets a
+// t index laid out like its n index. With a single index stream the tangents are per-vertex and
+// the t indices equal the vertex indices.
+func (m *Mesh) GenerateTangents() error {
+	if len(m.faces) == 0 {
+		return nil
+	}
+	if len(m.normals) == 0 || len(m.textureCoords) == 0 {
+		Logf(LOG_ERROR, "Error: Tangents need both normals and texture coords, use -gennormals if the OBJ has no normals.\n")
+		return errors.New("tangents need normals and texture coords")
+	}
+
+	type corner struct {
+		n, uv uint32
+	}
+	index := make(map[corner]uint32)
+	var keys []corner
+	for i := range m.faces {
+		f := &m.faces[i]
+		f.t = make([]uint32, f.edges)
+		for j := 0; j < int(f.edges); j++ {
+			c := corner{f.n[j], f.uv[j]}
+			if m.indexType != INDEX_SEPARATE {
+				c = corner{f.v[j], f.v[j]}
+			}
+			idx, ok := index[c]
+			if !ok {
+				idx = uint32(len(keys))
+				index[c] = idx
+				keys = append(keys, c)
+			}
+			f.t[j] = idx
+		}
+	}
+	if m.indexType != INDEX_SEPARATE {
+		// Per-vertex tangents, so the t index is the vertex index like n and uv.
+		keys = make([]corner, len(m.vertices))
+		for i := range keys {
+			keys[i] = corner{uint32(i), uint32(i)}
+		}
+		for i := range m.faces {
+			copy(m.faces[i].t, m.faces[i].v)
+		}
+	}
+
+	// Sum the texture space axes of every triangle of each face into its corners.
+	tan := make([][3]float64, len(keys))
+	bitan := make([][3]float64, len(keys))
+	for i := range m.faces {
+		f := &m.faces[i]
+		for j := 1; j+1 < int(f.edges); j++ {
+			c := [3]int{0, j, j + 1}
+			p0, p1, p2 := m.vertices[f.v[c[0]]], m.vertices[f.v[c[1]]], m.vertices[f.v[c[2]]]
+			t0, t1, t2 := m.textureCoords[f.uv[c[0]]], m.textureCoords[f.uv[c[1]]], m.textureCoords[f.uv[c[2]]]
+			e1 := [3]float64{float64(p1.X - p0.X), float64(p1.Y - p0.Y), float64(p1.Z - p0.Z)}
+			e2 := [3]float64{float64(p2.X - p0.X), float64(p2.Y - p0.Y), float64(p2.Z - p0.Z)}
+			du1, dv1 := float64(t1.U-t0.U), float64(t1.V-t0.V)
+			du2, dv2 := float64(t2.U-t0.U), float64(t2.V-t0.V)
+			det := du1*dv2 - du2*dv1
+			if math.Abs(det) < 1e-12 {
+				continue
+			}
+			for k := 0; k < 3; k++ {
+				t := (e1[k]*dv2 - e2[k]*dv1) / det
+				b := (e2[k]*du1 - e1[k]*du2) / det
+				for _, corner := range c {
+					tan[f.t[corner]][k] += t
+					bitan[f.t[corner]][k] += b
+				}
+			}
+		}
+	}
+
+	// Make each tangent perpendicular to its normal, the bitangent completes a frame with the
+	// handedness of the texture mapping.
+	m.tangents = make([]Tangent, len(keys))
+	for i, key := range keys {
+		n := m.normals[key.n]
+		nx, ny, nz := float64(n.X), float64(n.Y), float64(n.Z)
+		t := tan[i]
+		d := dotProduct(nx, ny, nz, t[0], t[1], t[2])
+		tx, ty, tz := t[0]-nx*d, t[1]-ny*d, t[2]-nz*d
+		if dotProduct(tx, ty, tz, tx, ty, tz) < 1e-24 {
+			// No usable texture gradient, pick any direction perpendicular to the normal.
+			if math.Abs(nx) < 0.9 {
+				tx, ty, tz = crossProduct(nx, ny, nz, 1, 0, 0)
+			} else {
+				tx, ty, tz = crossProduct(nx, ny, nz, 0, 1, 0)
+			}
+		}
+		tangent := Normal{X: float32(tx), Y: float32(ty), Z: float32(tz)}
+		tangent.normalize()
+		bx, by, bz := crossProduct(nx, ny, nz, float64(tangent.X), float64(tangent.Y), float64(tangent.Z))
+		if dotProduct(bx, by, bz, bitan[i][0], bitan[i][1], bitan[i][2]) < 0 {
+			bx, by, bz = -bx, -by, -bz
+		}
+		m.tangents[i].tan = tangent
+		m.tangents[i].bitan = Normal{X: float32(bx), Y: float32(by), Z: float32(bz)}
+	}
+	Logf(LOG_INFO, "Generated %d tangents\n", len(m.tangents))
+	return nil
+}
+
+func writeTangent(writer *bufio.Writer, byteOrder binary.ByteOrder, t *Tangent) {
+	writeNormal(writer, byteOrder, &t.tan)
+	writeNormal(writer, byteOrder, &t.bitan)
+}
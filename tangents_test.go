@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTangentIndicesFollowNormalsAndTextureCoords(t *testing.T) {
+	// A unit square in the xy plane with u along x and v along y, the two triangles share
+	// corners 1 and 3 but corner 3 uses a second copy of the normal in the second triangle.
+	obj := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 1 1\nvt 0 1\nvn 0 0 1\nvn 0 0 1\n" +
+		"f 1/1/1 2/2/1 3/3/1\nf 1/1/1 3/3/2 4/4/1\n"
+	file := convertOBJ(t, obj, "-gentangents", "-keepunused")
+	if len(file.tangents) == 0 {
+		t.Fatal("no tangents were written")
+	}
+
+	type corner struct{ n, uv uint32 }
+	tangentOf := make(map[corner]uint32)
+	cornerOf := make(map[uint32]corner)
+	for i, f := range file.faces {
+		if len(f.t) != len(f.n) {
+			t.Fatalf("face %d has %d tangent indices for %d normal indices", i, len(f.t), len(f.n))
+		}
+		for j := range f.t {
+			c := corner{f.n[j], f.uv[j]}
+			if idx, ok := tangentOf[c]; ok && idx != f.t[j] {
+				t.Errorf("face %d corner %d uses tangent %d, another corner with the same normal and texture coord uses %d", i, j, f.t[j], idx)
+			}
+			if other, ok := cornerOf[f.t[j]]; ok && other != c {
+				t.Errorf("tangent %d is shared by corners with normal/uv %v and %v", f.t[j], other, c)
+			}
+			tangentOf[c], cornerOf[f.t[j]] = f.t[j], c
+		}
+	}
+	if len(file.tangents) != len(tangentOf) {
+		t.Errorf("got %d tangents for %d distinct corners", len(file.tangents), len(tangentOf))
+	}
+
+	for i, tangent := range file.tangents {
+		if !closeTo(float64(tangent.tan.X), 1, 1e-5) || math.Abs(float64(tangent.tan.Y)) > 1e-5 || math.Abs(float64(tangent.tan.Z)) > 1e-5 {
+			t.Errorf("tangent %d is %v, want along u, which is +x", i, tangent.tan)
+		}
+		if !closeTo(float64(tangent.bitan.Y), 1, 1e-5) || math.Abs(float64(tangent.bitan.X)) > 1e-5 || math.Abs(float64(tangent.bitan.Z)) > 1e-5 {
+			t.Errorf("bitangent %d is %v, want along v, which is +y", i, tangent.bitan)
+		}
+	}
+
+	// With one index stream the tangents are per-vertex and indexed by the vertex indices.
+	unified := convertOBJ(t, obj, "-gentangents", "-unify")
+	if len(unified.tangents) != len(unified.vertices) {
+		t.Errorf("got %d unified tangents for %d vertices", len(unified.tangents), len(unified.vertices))
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// An undirected edge between two vertices, a is always the lower index.
+type Edge struct {
+	a, b uint32
+}
+
+func MakeEdge(a, b uint32) Edge {
+	if a > b {
+		a, b = b, a
+	}
+	return Edge{a, b}
+}
+
+// Count the number of faces which use each undirected edge.
+func (m *Mesh) EdgeFaceCounts() map[Edge]int {
+	counts := make(map[Edge]int)
+	for i := range m.faces {
+		for j := 0; j < int(m.faces[i].edges); j++ {
+			counts[MakeEdge(m.faces[i].v[j], m.faces[i].v[(j+1)%int(m.faces[i].edges)])]++
+		}
+	}
+	return counts
+}
+
+type BoundaryLoop struct {
+	vertices []uint32
+	length   float64
+	closed   bool
+}
+
+// Find the edges used by only one face and link them into loops following the face winding.
+func (m *Mesh) FindBoundaryLoops() []BoundaryLoop {
+	counts := m.EdgeFaceCounts()
+
+	// Directed boundary edges keyed by their start vertex.
+	next := make(map[uint32][]uint32)
+	var starts []uint32
+	for i := range m.faces {
+		for j := 0; j < int(m.faces[i].edges); j++ {
+			a, b := m.faces[i].v[j], m.faces[i].v[(j+1)%int(m.faces[i].edges)]
+			if counts[MakeEdge(a, b)] == 1 {
+				next[a] = append(next[a], b)
+				starts = append(starts, a)
+			}
+		}
+	}
+	slices.Sort(starts)
+
+	var loops []BoundaryLoop
+	for _, start := range starts {
+		if len(next[start]) == 0 {
+			continue
+		}
+		var loop BoundaryLoop
+		var cur uint32 = start
+		for len(next[cur]) > 0 {
+			to := next[cur][0]
+			next[cur] = next[cur][1:]
+			loop.vertices = append(loop.vertices, cur)
+			loop.length += Distance(m.vertices[cur], m.vertices[to])
+			cur = to
+			if cur == start {
+				loop.closed = true
+				break
+			}
+		}
+		loops = append(loops, loop)
+	}
+	return loops
+}
+
+// Report whether the mesh is watertight and describe each hole.
+func (m *Mesh) ReportHoles() {
+	loops := m.FindBoundaryLoops()
+	if len(loops) == 0 {
+		fmt.Fprintln(logOutput, "Mesh is watertight, no boundary edges found.")
+		return
+	}
+	fmt.Fprintf(logOutput, "Mesh is not watertight, found %d boundary loops:\n", len(loops))
+	for i, loop := range loops {
+		var state string = "closed"
+		if !loop.closed {
+			state = "open (non-manifold boundary)"
+		}
+		fmt.Fprintf(logOutput, "  Loop %d: %d vertices, %d edges, length %f, %s, vertices %v\n", i, len(loop.vertices), len(loop.vertices), loop.length, state, loop.vertices)
+	}
+}
+
+// Drop faces which use the same vertices in the same winding as an earlier face, starting
+// from any corner. Faces with the opposite winding are kept as they face the other way.
+func (m *Mesh) RemoveDuplicateFaces() {
+	seen := make(map[[4]uint32]bool)
+	var keep []Face
+	for i := range m.faces {
+		f := &m.faces[i]
+		var first int = 0
+		for j := 1; j < int(f.edges); j++ {
+			if f.v[j] < f.v[first] {
+				first = j
+			}
+		}
+		// Unused slots hold an index no vertex can have so triangles never match quads.
+		var key [4]uint32 = [4]uint32{math.MaxUint32, math.MaxUint32, math.MaxUint32, math.MaxUint32}
+		for k := 0; k < int(f.edges); k++ {
+			key[k] = f.v[(first+k)%int(f.edges)]
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keep = append(keep, *f)
+	}
+	m.meshStats.duplicateFaces = len(m.faces) - len(keep)
+	Logf(LOG_INFO, "Removed %d duplicate faces.\n", m.meshStats.duplicateFaces)
+	m.faces = keep
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Convert the OBJ source with -holes and return what was reported.
+func reportHoles(t *testing.T, obj string) string {
+	t.Helper()
+	dir := writeFiles(t, map[string]string{"in.obj": obj})
+	resetCommandLine()
+	var log bytes.Buffer
+	logOutput = &log
+	if err := Convert([]string{"-holes", filepath.Join(dir, "in.obj"), filepath.Join(dir, "out.mshx")}); err != nil {
+		t.Fatal(err)
+	}
+	return log.String()
+}
+
+func TestHolesInTriangleAndClosedCube(t *testing.T) {
+	log := reportHoles(t, "v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n")
+	if !strings.Contains(log, "found 1 boundary loops") || !strings.Contains(log, "Loop 0: 3 vertices, 3 edges") {
+		t.Errorf("a lone triangle should have one hole of three edges, log was %q", log)
+	}
+	if !strings.Contains(log, ", closed,") {
+		t.Errorf("the triangle's boundary should be a closed loop, log was %q", log)
+	}
+
+	log = reportHoles(t, cubeOBJ)
+	if !strings.Contains(log, "Mesh is watertight") || strings.Contains(log, "boundary loops") {
+		t.Errorf("the closed cube should have no holes, log was %q", log)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strings"
+)
+
+// Look up a unit by name, returning UNIT_UNKNOWN if it is not recognised.
+func ParseUnit(name string) uint32 {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "mm", "millimeter", "millimeters", "millimetre", "millimetres":
+		return UNIT_MM
+	case "cm", "centimeter", "centimeters", "centimetre", "centimetres":
+		return UNIT_CM
+	case "m", "meter", "meters", "metre", "metres":
+		return UNIT_M
+	case "in", "inch", "inches":
+		return UNIT_INCH
+	case "ft", "foot", "feet":
+		return UNIT_FOOT
+	}
+	return UNIT_UNKNOWN
+}
+
+// Scale all vertex positions, normals are transformed by the inverse scale and re-normalized
+// so they stay perpendicular to the surface under non-uniform scaling.
+func (m *Mesh) ScaleMesh(sx, sy, sz float32) {
+	for i := range m.vertices {
+		p := m.vertices[i].position()
+		m.vertices[i].setPosition(p[0]*float64(sx), p[1]*float64(sy), p[2]*float64(sz))
+		m.vertices[i].velocity[0] *= sx
+		m.vertices[i].velocity[1] *= sy
+		m.vertices[i].velocity[2] *= sz
+	}
+	if sx != sy || sy != sz {
+		for i := range m.normals {
+			m.normals[i].X /= sx
+			m.normals[i].Y /= sy
+			m.normals[i].Z /= sz
+			m.normals[i].normalize()
+		}
+	}
+	Logf(LOG_INFO, "Scaled mesh by %f %f %f\n", sx, sy, sz)
+}
+
+// Offset all vertex positions.
+func (m *Mesh) TranslateMesh(tx, ty, tz float64) {
+	for i := range m.vertices {
+		if *precisePtr {
+			p := m.vertices[i].precise
+			m.vertices[i].setPosition(p[0]+tx, p[1]+ty, p[2]+tz)
+			continue
+		}
+		m.vertices[i].X += float32(tx)
+		m.vertices[i].Y += float32(ty)
+		m.vertices[i].Z += float32(tz)
+	}
+	Logf(LOG_INFO, "Translated mesh by %f %f %f\n", tx, ty, tz)
+}
+
+// Move the centre of the bounding box to the origin.
+func (m *Mesh) CenterMesh() {
+	if *precisePtr && len(m.vertices) > 0 {
+		min, max := m.preciseMinMax()
+		m.TranslateMesh(-(min[0]+max[0])/2, -(min[1]+max[1])/2, -(min[2]+max[2])/2)
+		return
+	}
+	min, max := MinMax(m.vertices)
+	m.TranslateMesh(float64(-(min.X+max.X)/2), float64(-(min.Y+max.Y)/2), float64(-(min.Z+max.Z)/2))
+}
+
+// Move the centre of the bottom of the bounding box to the origin, so the lowest point along the
+// up axis (1=y, 2=z) sits at 0 and the mesh is centred on the other two axes.
+func (m *Mesh) CenterMeshToBase(up int) {
+	if len(m.vertices) == 0 {
+		return
+	}
+	var offset [3]float64
+	if *precisePtr {
+		min, max := m.preciseMinMax()
+		for k := 0; k < 3; k++ {
+			offset[k] = -(min[k] + max[k]) / 2
+		}
+		offset[up] = -min[up]
+	} else {
+		min, max := MinMax(m.vertices)
+		offset = [3]float64{float64(-(min.X + max.X) / 2), float64(-(min.Y + max.Y) / 2), float64(-(min.Z + max.Z) / 2)}
+		offset[up] = -float64([3]float32{min.X, min.Y, min.Z}[up])
+	}
+	m.TranslateMesh(offset[0], offset[1], offset[2])
+}
+
+// The bounding box of the double precision positions kept with -precise.
+func (m *Mesh) preciseMinMax() (min, max [3]float64) {
+	min, max = m.vertices[0].precise, m.vertices[0].precise
+	for i := range m.vertices {
+		for k := 0; k < 3; k++ {
+			min[k] = math.Min(min[k], m.vertices[i].precise[k])
+			max[k] = math.Max(max[k], m.vertices[i].precise[k])
+		}
+	}
+	return min, max
+}
+
+// Rotate the mesh from Y-up to Z-up, (x, y, z) becomes (x, -z, y). This is a rotation rather
+// than a mirror so the face winding is unchanged.
+func (m *Mesh) YUpToZUp() {
+	for i := range m.vertices {
+		m.vertices[i].Y, m.vertices[i].Z = -m.vertices[i].Z, m.vertices[i].Y
+		m.vertices[i].precise[1], m.vertices[i].precise[2] = -m.vertices[i].precise[2], m.vertices[i].precise[1]
+		m.vertices[i].velocity[1], m.vertices[i].velocity[2] = -m.vertices[i].velocity[2], m.vertices[i].velocity[1]
+	}
+	for i := range m.normals {
+		m.normals[i].Y, m.normals[i].Z = -m.normals[i].Z, m.normals[i].Y
+	}
+	Logf(LOG_INFO, "Converted mesh from Y-up to Z-up\n")
+}
+
+// Reverse the corner order of every face, so front faces become back faces, and flip the
+// normals so they still point out of the front face.
+func (m *Mesh) FlipWinding() {
+	for i := range m.faces {
+		slices.Reverse(m.faces[i].v)
+		slices.Reverse(m.faces[i].n)
+		slices.Reverse(m.faces[i].uv)
+	}
+	for i := range m.normals {
+		m.normals[i].X = -m.normals[i].X
+		m.normals[i].Y = -m.normals[i].Y
+		m.normals[i].Z = -m.normals[i].Z
+	}
+	Logf(LOG_INFO, "Flipped the winding of %d faces\n", len(m.faces))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// The unit cube moved by x,y,z.
+func offsetCube(x, y, z float32) string {
+	var b strings.Builder
+	for _, line := range strings.Split(cubeOBJ, "\n") {
+		var vx, vy, vz float32
+		if _, err := fmt.Sscanf(line, "v %g %g %g", &vx, &vy, &vz); err == nil {
+			fmt.Fprintf(&b, "v %g %g %g\n", vx+x, vy+y, vz+z)
+		} else if line != "" {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+func TestCenterMovesSymmetricMeshToOrigin(t *testing.T) {
+	file := convertOBJ(t, offsetCube(3, -2, 5), "-center")
+
+	box := file.header.box
+	if box.min != (Vertex{X: -0.5, Y: -0.5, Z: -0.5}) || box.max != (Vertex{X: 0.5, Y: 0.5, Z: 0.5}) {
+		t.Errorf("box is %v to %v, want -0.5 to 0.5 on every axis", box.min, box.max)
+	}
+	for i, v := range file.vertices {
+		if (v.X != 0.5 && v.X != -0.5) || (v.Y != 0.5 && v.Y != -0.5) || (v.Z != 0.5 && v.Z != -0.5) {
+			t.Errorf("vertex %d is %g,%g,%g, want a corner of the centred cube", i, v.X, v.Y, v.Z)
+		}
+	}
+	c := file.header.sphere.center
+	if !closeTo(float64(c.X), 0, 1e-6) || !closeTo(float64(c.Y), 0, 1e-6) || !closeTo(float64(c.Z), 0, 1e-6) {
+		t.Errorf("sphere centre %g,%g,%g, want the origin", c.X, c.Y, c.Z)
+	}
+}
+
+func TestUnitsCentimetresToMetres(t *testing.T) {
+	obj := "v 0 0 0\nv 100 0 0\nv 0 50 -20\nf 1 2 3\n"
+	for _, c := range []struct {
+		obj  string
+		args []string
+	}{
+		{obj, []string{"-from-unit", "cm", "-to-unit", "m"}},
+		{"# units = centimeters\n" + obj, []string{"-to-unit", "m"}},
+	} {
+		file := convertOBJ(t, c.obj, c.args...)
+		if file.header.unit != UNIT_M {
+			t.Errorf("%v: header unit %d, want metres", c.args, file.header.unit)
+		}
+		want := []Vertex{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 0}, {X: 0, Y: 0.5, Z: -0.2}}
+		for i, v := range file.vertices {
+			if !closeTo(float64(v.X), float64(want[i].X), 1e-6) || !closeTo(float64(v.Y), float64(want[i].Y), 1e-6) || !closeTo(float64(v.Z), float64(want[i].Z), 1e-6) {
+				t.Errorf("%v: vertex %d is %g,%g,%g, want a hundredth of the input", c.args, i, v.X, v.Y, v.Z)
+			}
+		}
+	}
+}
+
+// The z component of the face's geometric normal, positive when it winds counter-clockwise
+// seen from +z.
+func windingZ(file *MSHXFile, f *Face) float32 {
+	a, b, c := file.vertices[f.v[0]], file.vertices[f.v[1]], file.vertices[f.v[2]]
+	return (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+}
+
+func TestFlipWindingMakesCounterClockwiseClockwise(t *testing.T) {
+	obj := "v 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nf 1//1 2//1 3//1\n"
+	file := convertOBJ(t, obj)
+	if z := windingZ(file, &file.faces[0]); z <= 0 {
+		t.Fatalf("the face should start counter-clockwise, winding %g", z)
+	}
+
+	file = convertOBJ(t, obj, "-flipwinding")
+	if z := windingZ(file, &file.faces[0]); z >= 0 {
+		t.Errorf("-flipwinding left the face counter-clockwise, winding %g", z)
+	}
+	if n := file.normals[file.faces[0].n[0]]; n.X != 0 || n.Y != 0 || n.Z != -1 {
+		t.Errorf("-flipwinding left the normal at %g,%g,%g, want 0,0,-1", n.X, n.Y, n.Z)
+	}
+}
+
+func TestPreciseKeepsSmallDetailFarFromOrigin(t *testing.T) {
+	// A 1cm triangle a million units out, float32 steps there are 6cm apart.
+	obj := "v 1000000.003 2000000.003 -1000000.003\nv 1000000.013 2000000.003 -1000000.003\nv 1000000.003 2000000.013 -1000000.003\nf 1 2 3\n"
+	want := []Vertex{{X: -0.005, Y: -0.005}, {X: 0.005, Y: -0.005}, {X: -0.005, Y: 0.005}}
+
+	file := convertOBJ(t, obj, "-precise", "-center")
+	for i, v := range file.vertices {
+		if !closeTo(float64(v.X), float64(want[i].X), 1e-6) || !closeTo(float64(v.Y), float64(want[i].Y), 1e-6) || !closeTo(float64(v.Z), 0, 1e-6) {
+			t.Errorf("vertex %d is %g,%g,%g, want %g,%g,0", i, v.X, v.Y, v.Z, want[i].X, want[i].Y)
+		}
+	}
+
+	// Without -precise the positions are rounded to float32 as they are read and the detail is lost.
+	file = convertOBJ(t, obj, "-center", "-keepunused")
+	var worst float64 = 0
+	for i, v := range file.vertices {
+		worst = max(worst, math.Abs(float64(v.X-want[i].X)), math.Abs(float64(v.Y-want[i].Y)))
+	}
+	if worst < 1e-3 {
+		t.Errorf("the float32 conversion is within %g, so the test does not show what -precise keeps", worst)
+	}
+}
+
+func TestCenterOriginToBase(t *testing.T) {
+	// The cube spans y 2 to 4 after being doubled in size.
+	obj := offsetCube(3, 1, -5)
+	file := convertOBJ(t, obj, "-scale", "2", "-center-origin-to-base")
+	box := file.header.box
+	if box.min != (Vertex{X: -1, Y: 0, Z: -1}) || box.max != (Vertex{X: 1, Y: 2, Z: 1}) {
+		t.Errorf("box is %v to %v, want -1,0,-1 to 1,2,1", box.min, box.max)
+	}
+
+	// With -yzup the base is along z instead.
+	file = convertOBJ(t, obj, "-scale", "2", "-yzup", "-center-origin-to-base")
+	if box := file.header.box; box.min.Z != 0 || box.min.X != -box.max.X || box.min.Y != -box.max.Y {
+		t.Errorf("-yzup box is %v to %v, want the lowest z at 0 and centred on x and y", box.min, box.max)
+	}
+}
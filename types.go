@@ -1,77 +1,130 @@
-package main
-
-type Vertex struct {
-	X, Y, Z, W float32
-	A, R, G, B float32
-	flushed    bool
-}
-
-type Normal struct {
-	X, Y, Z, W float32
-	flushed    bool
-}
-
-type TextureCoord struct {
-	U, V, W float32
-	flushed bool
-}
-
-type Tangent struct {
-	tan, bitan Normal
-	flushed    bool
-}
-
-type BoundSphere struct {
-	center Vertex
-	radius float32
-}
-
-const FindVertexScore_CacheDecayPower float32 = 1.5
-const FindVertexScore_LastTriScore float32 = 0.75
-const FindVertexScore_ValenceBoostScale float32 = 2.0
-const FindVertexScore_ValenceBoostPower float32 = 0.5
-
-type Face struct {
-	edges        uint8
-	v            []uint32
-	n            []uint32
-	t            []uint32
-	uv           []uint32
-	materialID   uint32
-	materialName string
-	mortonCode   uint32
-	complete     bool
-}
-
-const ILLUM0 uint32 = 0   // Color on and Ambient off
-const ILLUM1 uint32 = 1   // Color on and Ambient on
-const ILLUM2 uint32 = 2   // Highlight on
-const ILLUM3 uint32 = 3   // Reflection on and Ray trace on
-const ILLUM4 uint32 = 4   // Transparency: Glass on, Reflection: Ray trace on
-const ILLUM5 uint32 = 5   // Reflection: Fresnel on and Ray trace on
-const ILLUM6 uint32 = 6   // Transparency: Refraction on, Reflection: Fresnel off and Ray trace on
-const ILLUM7 uint32 = 7   // Transparency: Refraction on, Reflection: Fresnel on and Ray trace on
-const ILLUM8 uint32 = 8   // Reflection on and Ray trace off
-const ILLUM9 uint32 = 9   // Transparency: Glass on, Reflection: Ray trace off
-const ILLUM10 uint32 = 10 // Casts shadows onto invisible surfaces
-
-type Material struct {
-	name                string
-	diffuse             [3]float32
-	specular            [3]float32
-	ambient             [3]float32
-	transmissive        [3]float32
-	emissive            [3]float32
-	power               float32
-	transparency        float32
-	refractivity        float32
-	illum               uint32
-	roughness           float32
-	metallic            float32
-	sheen               float32
-	clearcoat_thickness float32
-	clearcoat_roughness float32
-	aniso               float32
-	aniso_rotation      float32
-	texture             string
-}
+package main
+
+type Vertex struct {
+	X, Y, Z, W float32
+	A, R, G, B float32
+	flushed    bool
+	velocity   [3]float32
+	precise    [3]float64 // x, y, z in double precision, only kept with -precise
+}
+
+// Bits of the vertexType header field
+const VERTEX_COLOR uint32 = 1     // r,g,b,a follow the position
+const VERTEX_VELOCITY uint32 = 2  // vx,vy,vz follow the position and colour
+const VERTEX_QUANTIZED uint32 = 4 // positions are uint16 x,y,z scaled by the header scale and bias
+const VERTEX_W uint32 = 8         // a float w follows the position
+const UV_W uint32 = 16            // texture coords are u,v,w rather than u,v
+
+// Set in the vertexType header field when a CRC32 of the rest of the file follows the last section
+const FILE_CHECKSUM uint32 = 0x80000000
+
+// Values of the indexType header field
+const INDEX_SEPARATE uint32 = 0    // faces index vertices, normals and texture coords separately
+const INDEX_UNIFIED uint32 = 1     // normals and texture coords are per-vertex and use the vertex index
+const INDEX_INTERLEAVED uint32 = 2 // as unified, with the normal and texture coord inside each vertex record
+
+// Set in the vertexType header field when the faces section holds triangle strips
+const TRIANGLE_STRIPS uint32 = 0x20000000
+
+// Set in the vertexType header field when the bounding sphere was not generated and its fields are zero
+const NO_BOUND_SPHERE uint32 = 0x40000000
+
+// Set in the vertexType header field when a VSPL section of progressive mesh vertex splits follows
+const VERTEX_SPLITS uint32 = 0x10000000
+
+type Normal struct {
+	X, Y, Z, W float32
+	flushed    bool
+}
+
+type TextureCoord struct {
+	U, V, W float32
+	flushed bool
+}
+
+type Tangent struct {
+	tan, bitan Normal
+	flushed    bool
+}
+
+type BoundSphere struct {
+	center Vertex
+	radius float32
+}
+
+type BoundBox struct {
+	min Vertex
+	max Vertex
+}
+
+const FindVertexScore_CacheDecayPower float32 = 1.5
+const FindVertexScore_LastTriScore float32 = 0.75
+const FindVertexScore_ValenceBoostScale float32 = 2.0
+const FindVertexScore_ValenceBoostPower float32 = 0.5
+
+type Face struct {
+	edges        uint8
+	v            []uint32
+	n            []uint32
+	t            []uint32
+	uv           []uint32
+	materialID   uint32
+	materialName string
+	textureMap   string
+	objectName   string
+	mortonCode   uint32
+	complete     bool
+	line         int
+}
+
+const ILLUM0 uint32 = 0   // Color on and Ambient off
+const ILLUM1 uint32 = 1   // Color on and Ambient on
+const ILLUM2 uint32 = 2   // Highlight on
+const ILLUM3 uint32 = 3   // Reflection on and Ray trace on
+const ILLUM4 uint32 = 4   // Transparency: Glass on, Reflection: Ray trace on
+const ILLUM5 uint32 = 5   // Reflection: Fresnel on and Ray trace on
+const ILLUM6 uint32 = 6   // Transparency: Refraction on, Reflection: Fresnel off and Ray trace on
+const ILLUM7 uint32 = 7   // Transparency: Refraction on, Reflection: Fresnel on and Ray trace on
+const ILLUM8 uint32 = 8   // Reflection on and Ray trace off
+const ILLUM9 uint32 = 9   // Transparency: Glass on, Reflection: Ray trace off
+const ILLUM10 uint32 = 10 // Casts shadows onto invisible surfaces
+
+const UNIT_UNKNOWN uint32 = 0
+const UNIT_MM uint32 = 1
+const UNIT_CM uint32 = 2
+const UNIT_M uint32 = 3
+const UNIT_INCH uint32 = 4
+const UNIT_FOOT uint32 = 5
+
+// Length of each unit in meters
+var unitMeters = map[uint32]float64{
+	UNIT_MM:   0.001,
+	UNIT_CM:   0.01,
+	UNIT_M:    1.0,
+	UNIT_INCH: 0.0254,
+	UNIT_FOOT: 0.3048,
+}
+
+// Name of the material used for faces whose material is not defined
+const DEFAULT_MATERIAL_NAME string = "mshx_default"
+
+type Material struct {
+	name                string
+	diffuse             [3]float32
+	specular            [3]float32
+	ambient             [3]float32
+	transmissive        [3]float32
+	emissive            [3]float32
+	power               float32
+	transparency        float32
+	refractivity        float32
+	illum               uint32
+	roughness           float32
+	metallic            float32
+	sheen               float32
+	clearcoat_thickness float32
+	clearcoat_roughness float32
+	aniso               float32
+	aniso_rotation      float32
+	texture             string
+}
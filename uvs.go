@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"math"
+)
+
+// Position of a vertex along one axis, normalized over the bounding box to [0.0 - 1.0].
+func boxCoord(v Vertex, axis int, min, max Vertex) float32 {
+	lo, hi := [3]float32{min.X, min.Y, min.Z}[axis], [3]float32{max.X, max.Y, max.Z}[axis]
+	if hi <= lo {
+		return 0
+	}
+	return ([3]float32{v.X, v.Y, v.Z}[axis] - lo) / (hi - lo)
+}
+
+// Give a mesh without texture coords simple projected ones in [0.0 - 1.0] over its bounding box.
+// planar projects every vertex along the axis the mesh is thinnest on, box projects each face
+// along the axis its normal is closest to, so a vertex gets one texture coord per axis it is
+// projected along.
+func (m *Mesh) GenerateUVs(mode string) error {
+	if mode != "planar" && mode != "box" {
+		Logf(LOG_ERROR, "Error: Unknown -genuv projection %s, use planar or box.\n", mode)
+		return errors.New("invalid uv projection")
+	}
+	if len(m.textureCoords) > 0 {
+		Logf(LOG_WARN, "Warning: The mesh already has texture coords, -genuv is ignored.\n")
+		return nil
+	}
+	if len(m.vertices) == 0 {
+		return nil
+	}
+	min, max := MinMax(m.vertices)
+	size := [3]float32{max.X - min.X, max.Y - min.Y, max.Z - min.Z}
+
+	// The projection axis is dropped, the other two become u and v in x, y, z order.
+	project := func(v Vertex, axis int) TextureCoord {
+		u, w := (axis+1)%3, (axis+2)%3
+		if u > w {
+			u, w = w, u
+		}
+		return TextureCoord{U: boxCoord(v, u, min, max), V: boxCoord(v, w, min, max)}
+	}
+
+	var thinnest int = 0
+	if size[1] < size[thinnest] {
+		thinnest = 1
+	}
+	if size[2] < size[thinnest] {
+		thinnest = 2
+	}
+
+	type key struct {
+		v    uint32
+		axis int
+	}
+	index := make(map[key]uint32)
+	for i := range m.faces {
+		f := &m.faces[i]
+		var axis int = thinnest
+		if mode == "box" {
+			axis = 0
+			nx, ny, nz := m.faceNormal(f)
+			n := [3]float64{math.Abs(nx), math.Abs(ny), math.Abs(nz)}
+			if n[1] > n[axis] {
+				axis = 1
+			}
+			if n[2] > n[axis] {
+				axis = 2
+			}
+		}
+		f.uv = make([]uint32, f.edges)
+		for j := 0; j < int(f.edges); j++ {
+			k := key{f.v[j], axis}
+			idx, ok := index[k]
+			if !ok {
+				m.textureCoords = append(m.textureCoords, project(m.vertices[f.v[j]], axis))
+				idx = uint32(len(m.textureCoords) - 1)
+				index[k] = idx
+			}
+			f.uv[j] = idx
+		}
+	}
+	Logf(LOG_INFO, "Generated %d %s projected texture coords.\n", len(m.textureCoords), mode)
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestBoxUVsOfCubeCoverUnitSquare(t *testing.T) {
+	file := convertOBJ(t, offsetCube(3, -2, 5), "-genuv", "box")
+	if len(file.textureCoords) == 0 {
+		t.Fatal("no texture coords were generated")
+	}
+	for i, uv := range file.textureCoords {
+		if uv.U < 0 || uv.U > 1 || uv.V < 0 || uv.V > 1 {
+			t.Errorf("texture coord %d is %g,%g, outside 0 to 1", i, uv.U, uv.V)
+		}
+	}
+	// Each side of the cube is projected along its own axis, so it covers the whole square.
+	for i, f := range file.faces {
+		corners := make(map[[2]float32]bool)
+		for _, idx := range f.uv {
+			uv := file.textureCoords[idx]
+			corners[[2]float32{uv.U, uv.V}] = true
+		}
+		for _, want := range [][2]float32{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+			if !corners[want] {
+				t.Errorf("face %d has texture coords %v, missing corner %v", i, corners, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"math"
+)
+
+// Check a single index list against the number of defined elements, reporting each bad index.
+func validateIndices(line int, indices []uint32, count int, kind string) int {
+	var problems int = 0
+	for _, idx := range indices {
+		if idx >= uint32(count) {
+			Logf(LOG_WARN, "Line %d: references %s %d, but only %d are defined.\n", line, kind, int32(idx)+1, count)
+			problems++
+		}
+	}
+	return problems
+}
+
+// Report whether a face repeats a vertex or has no area.
+func (m *Mesh) degenerateFace(f *Face) bool {
+	for j := 0; j < int(f.edges); j++ {
+		for k := j + 1; k < int(f.edges); k++ {
+			if f.v[j] == f.v[k] {
+				return true
+			}
+		}
+	}
+	var area float64 = 0
+	a := m.vertices[f.v[0]]
+	for j := 1; j+1 < int(f.edges); j++ {
+		b, c := m.vertices[f.v[j]], m.vertices[f.v[j+1]]
+		x, y, z := crossProduct(float64(b.X-a.X), float64(b.Y-a.Y), float64(b.Z-a.Z), float64(c.X-a.X), float64(c.Y-a.Y), float64(c.Z-a.Z))
+		area += math.Sqrt(x*x+y*y+z*z) / 2
+	}
+	return area <= 1e-12
+}
+
+// Check the parsed mesh for out of range indices, mixed attribute streams, invalid quads and
+// degenerate faces, reporting every problem rather than stopping at the first.
+func (m *Mesh) ValidateMesh() error {
+	var problems, badIndices, badQuads, degenerate int = 0, 0, 0, 0
+	var withNormals, withUVs int = 0, 0
+	for i := range m.faces {
+		f := &m.faces[i]
+		if len(f.n) > 0 {
+			withNormals++
+		}
+		if len(f.uv) > 0 {
+			withUVs++
+		}
+		bad := validateIndices(f.line, f.v, len(m.vertices), "vertex") +
+			validateIndices(f.line, f.n, len(m.normals), "normal") +
+			validateIndices(f.line, f.uv, len(m.textureCoords), "texture coord")
+		if bad > 0 {
+			badIndices++
+			continue
+		}
+		if m.degenerateFace(f) {
+			Logf(LOG_WARN, "Line %d: face is degenerate.\n", f.line)
+			degenerate++
+			continue
+		}
+		if f.edges == 4 {
+			if err := m.ValidateQuad(f); err != nil {
+				Logf(LOG_WARN, "Line %d: %v.\n", f.line, err)
+				badQuads++
+			}
+		}
+	}
+	problems = badIndices + badQuads + degenerate
+	for i := range m.polylines {
+		if validateIndices(m.polylines[i].line, m.polylines[i].v, len(m.vertices), "vertex")+
+			validateIndices(m.polylines[i].line, m.polylines[i].uv, len(m.textureCoords), "texture coord") > 0 {
+			problems++
+		}
+	}
+	for i := range m.points {
+		if validateIndices(m.points[i].line, []uint32{m.points[i].v}, len(m.vertices), "vertex") > 0 {
+			problems++
+		}
+	}
+	if withNormals != 0 && withNormals != len(m.faces) {
+		Logf(LOG_WARN, "%d of %d faces have normals, either all or no faces must have normals.\n", withNormals, len(m.faces))
+		problems++
+	}
+	if withUVs != 0 && withUVs != len(m.faces) {
+		Logf(LOG_WARN, "%d of %d faces have texture coords, either all or no faces must have texture coords.\n", withUVs, len(m.faces))
+		problems++
+	}
+
+	Logf(LOG_INFO, "Validated %d vertices, %d normals, %d texture coords, %d faces, %d lines, %d points.\n", len(m.vertices), len(m.normals), len(m.textureCoords), len(m.faces), len(m.polylines), len(m.points))
+	Logf(LOG_INFO, "Faces with out of range indices: %d\n", badIndices)
+	Logf(LOG_INFO, "Degenerate faces: %d\n", degenerate)
+	Logf(LOG_INFO, "Invalid quads: %d\n", badQuads)
+	if problems > 0 {
+		Logf(LOG_ERROR, "Error: Validation found %d problems.\n", problems)
+		return errors.New("mesh failed validation")
+	}
+	Logf(LOG_INFO, "No problems found.\n")
+	return nil
+}